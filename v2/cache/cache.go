@@ -25,10 +25,12 @@ import (
 
 const (
 	ErrCannotRetrieve = iota + 1
+	ErrInvalidOptions
 )
 
 var errorMessages = errors.Messages{
 	ErrCannotRetrieve: "cannot retrieve cached value: %v",
+	ErrInvalidOptions: "invalid cache option %q: %v",
 }
 
 //--------------------
@@ -37,13 +39,20 @@ var errorMessages = errors.Messages{
 
 type cacheManagerChange struct {
 	register bool
-	value    *cachedValue
+	value    managedValue
+}
+
+// managedValue is a cached value of any type
+// cleaned by the manager.
+type managedValue interface {
+	// checkCleaning clears the value if its ttl is exceeded.
+	checkCleaning(now time.Time)
 }
 
 // cacheManager stores references and sets the values
 // to nil periodically.
 type cacheManager struct {
-	values  []*cachedValue
+	values  map[managedValue]bool
 	changec chan *cacheManagerChange
 	loop    loop.Loop
 }
@@ -51,7 +60,7 @@ type cacheManager struct {
 // newCacheManager creates a new manager.
 func newCacheManager() *cacheManager {
 	m := &cacheManager{
-		values:  []*cachedValue{},
+		values:  make(map[managedValue]bool),
 		changec: make(chan *cacheManagerChange),
 	}
 	m.loop = loop.Go(m.backendLoop)
@@ -59,12 +68,12 @@ func newCacheManager() *cacheManager {
 }
 
 // register a cached value.
-func (m *cacheManager) register(v *cachedValue) {
+func (m *cacheManager) register(v managedValue) {
 	m.changec <- &cacheManagerChange{true, v}
 }
 
 // unRegister a cached value.
-func (m *cacheManager) unregister(v *cachedValue) {
+func (m *cacheManager) unregister(v managedValue) {
 	m.changec <- &cacheManagerChange{false, v}
 }
 
@@ -77,9 +86,9 @@ func (m *cacheManager) backendLoop(l loop.Loop) error {
 			return nil
 		case c := <-m.changec:
 			if c.register {
-				m.doRegister(c.value)
+				m.values[c.value] = true
 			} else {
-				m.doUnregister(c.value)
+				delete(m.values, c.value)
 			}
 		case <-ticker.C:
 			m.doCleaning()
@@ -87,34 +96,11 @@ func (m *cacheManager) backendLoop(l loop.Loop) error {
 	}
 }
 
-// doRegister performs the registration.
-func (m *cacheManager) doRegister(v *cachedValue) {
-	// Look for a free space.
-	for i := range m.values {
-		if m.values[i] == nil {
-			v.id = i
-			m.values[i] = v
-			return
-		}
-	}
-	// None found, append.
-	i := len(m.values)
-	v.id = i
-	m.values = append(m.values, v)
-}
-
-// doUnregister performs the unregistration.
-func (m *cacheManager) doUnregister(v *cachedValue) {
-	m.values[v.id] = nil
-}
-
 // doCleaning cleans the cached values.
 func (m *cacheManager) doCleaning() {
 	now := time.Now()
-	for _, v := range m.values {
-		if v != nil {
-			v.checkCleaning(now)
-		}
+	for v := range m.values {
+		v.checkCleaning(now)
 	}
 }
 
@@ -125,10 +111,11 @@ var cache = newCacheManager()
 // CACHED VALUE
 //--------------------
 
-type CachedValue interface {
+// TypedValue provides a lazy loaded value of type T.
+type TypedValue[T any] interface {
 	// Value returns the cached value. If an error occurred
 	// during retrieval that will be returned too.
-	Value() (v interface{}, err error)
+	Value() (v T, err error)
 
 	// Clear clears the cached value so that it will be
 	// retrieved again when Value() is called the next time.
@@ -138,83 +125,116 @@ type CachedValue interface {
 	Remove()
 }
 
-// RetrievalFunc is the signature of a function responsible for the retrieval
-// of the cached value from somewhere else in the system, e.g. a database.
-type RetrievalFunc func() (interface{}, error)
-
-// cachedValue implements the CachedValue interface.
-type cachedValue struct {
-	mux           sync.Mutex
-	id            int
-	value         interface{}
-	retrievalFunc RetrievalFunc
-	ttl           time.Duration
-	lastAccess    time.Time
+// typedValue implements the TypedValue interface.
+type typedValue[T any] struct {
+	mux        sync.Mutex
+	value      T
+	valid      bool
+	retrieve   func() (T, error)
+	ttl        time.Duration
+	lastAccess time.Time
 }
 
-// NewCachedValue creates a new cache. The retrieval func is
+// New creates a new cached value of type T. The retrieval func is
 // responsible for the retrieval of the value while ttl defines
-// how long the value is valid.
-func NewCachedValue(r RetrievalFunc, ttl time.Duration) CachedValue {
-	v := &cachedValue{
-		retrievalFunc: r,
-		ttl:           ttl,
-		lastAccess:    time.Now(),
+// how long the value is valid. Nil and zero values are cached
+// like any other.
+func New[T any](retrieve func() (T, error), ttl time.Duration) TypedValue[T] {
+	v := &typedValue[T]{
+		retrieve:   retrieve,
+		ttl:        ttl,
+		lastAccess: time.Now(),
 	}
 	cache.register(v)
 	return v
 }
 
-// Value implements the CachedValue interface.
-func (v *cachedValue) Value() (value interface{}, err error) {
+// Value implements the TypedValue interface.
+func (v *typedValue[T]) Value() (value T, err error) {
 	v.mux.Lock()
 	defer v.mux.Unlock()
 	defer func() {
 		if r := recover(); r != nil {
-			value = nil
+			var zero T
+			value = zero
 			err = errors.New(ErrCannotRetrieve, errorMessages, r)
 		}
 	}()
-	if v.value != nil {
-		if time.Now().Sub(v.lastAccess) > v.ttl {
-			v.value = nil
-		}
+	if v.valid && time.Now().Sub(v.lastAccess) > v.ttl {
+		v.reset()
 	}
-	if v.value == nil {
-		if v.value, err = v.retrievalFunc(); err != nil {
-			v.value = nil
-			return nil, err
+	if !v.valid {
+		if v.value, err = v.retrieve(); err != nil {
+			v.reset()
+			return v.value, err
 		}
+		v.valid = true
 	}
 	v.lastAccess = time.Now()
 	return v.value, nil
 }
 
-// Clear implements the CachedValue interface.
-func (v *cachedValue) Clear() {
+// Clear implements the TypedValue interface.
+func (v *typedValue[T]) Clear() {
 	v.mux.Lock()
 	defer v.mux.Unlock()
-	v.value = nil
+	v.reset()
 }
 
-// Remove implements the CachedValue interface.
-func (v *cachedValue) Remove() {
+// Remove implements the TypedValue interface.
+func (v *typedValue[T]) Remove() {
 	v.mux.Lock()
 	defer v.mux.Unlock()
 	cache.unregister(v)
-	v.value = nil
-	v.retrievalFunc = nil
+	v.reset()
+	v.retrieve = nil
 }
 
 // checkCleaning checks if the timespan between now and the last
 // access is largen than the time to live. In this case the value
 // is cleared.
-func (v *cachedValue) checkCleaning(now time.Time) {
+func (v *typedValue[T]) checkCleaning(now time.Time) {
 	v.mux.Lock()
 	defer v.mux.Unlock()
 	if now.Sub(v.lastAccess) > v.ttl {
-		v.value = nil
+		v.reset()
 	}
 }
 
+// reset drops the value, so that it will be retrieved again.
+func (v *typedValue[T]) reset() {
+	var zero T
+	v.value = zero
+	v.valid = false
+}
+
+//--------------------
+// UNTYPED CACHED VALUE
+//--------------------
+
+// CachedValue provides a lazy loaded value of any type.
+type CachedValue interface {
+	// Value returns the cached value. If an error occurred
+	// during retrieval that will be returned too.
+	Value() (v interface{}, err error)
+
+	// Clear clears the cached value so that it will be
+	// retrieved again when Value() is called the next time.
+	Clear()
+
+	// Remove removes this cached value from the cache.
+	Remove()
+}
+
+// RetrievalFunc is the signature of a function responsible for the retrieval
+// of the cached value from somewhere else in the system, e.g. a database.
+type RetrievalFunc func() (interface{}, error)
+
+// NewCachedValue creates a new cache. The retrieval func is
+// responsible for the retrieval of the value while ttl defines
+// how long the value is valid. It's the untyped variant of New().
+func NewCachedValue(r RetrievalFunc, ttl time.Duration) CachedValue {
+	return New[interface{}](r, ttl)
+}
+
 // EOF
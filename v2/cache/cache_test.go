@@ -13,6 +13,7 @@ package cache_test
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -48,6 +49,65 @@ func TestNormalRetrieve(t *testing.T) {
 	assert.Equal(retrieve(), 3)
 }
 
+// Test the retrieving of typed values.
+func TestTypedRetrieve(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	// Environment.
+	ctr := 0
+	count := func() (string, error) {
+		ctr++
+		return fmt.Sprintf("value %d", ctr), nil
+	}
+	cv := cache.New(count, 25*time.Millisecond)
+	defer cv.Remove()
+	retrieve := func() string { v, _ := cv.Value(); return v }
+
+	// Asserts.
+	assert.Equal(retrieve(), "value 1")
+	assert.Equal(retrieve(), "value 1")
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(retrieve(), "value 2")
+	cv.Clear()
+	assert.Equal(retrieve(), "value 3")
+}
+
+// Test the caching of nil and zero values.
+func TestNilRetrieve(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	// Environment.
+	ctr := 0
+	nilfunc := func() (interface{}, error) {
+		ctr++
+		return nil, nil
+	}
+	cv := cache.NewCachedValue(nilfunc, time.Minute)
+	defer cv.Remove()
+	zerofunc := func() (int, error) {
+		ctr++
+		return 0, nil
+	}
+	zcv := cache.New(zerofunc, time.Minute)
+	defer zcv.Remove()
+
+	// Asserts.
+	v, err := cv.Value()
+	assert.Nil(err)
+	assert.Nil(v)
+	v, err = cv.Value()
+	assert.Nil(err)
+	assert.Nil(v)
+	assert.Equal(ctr, 1)
+	z, err := zcv.Value()
+	assert.Nil(err)
+	assert.Equal(z, 0)
+	z, err = zcv.Value()
+	assert.Nil(err)
+	assert.Equal(z, 0)
+	assert.Equal(ctr, 2)
+}
+
 // Test the retrieving with an error.
 func TestRetrieveError(t *testing.T) {
 	assert := asserts.NewTestingAssertion(t, true)
@@ -88,4 +148,344 @@ func TestRetrievePanic(t *testing.T) {
 	assert.ErrorMatch(retrieve(), `\[E.*\] cannot retrieve cached value: ouch 3`)
 }
 
+// Test the getting of keyed values.
+func TestKeyedGet(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	// Environment.
+	c, err := cache.NewCache(&cache.Options[string]{})
+	assert.Nil(err)
+	ld := newLoader()
+
+	// Asserts.
+	v, err := c.Get("a", ld.load)
+	assert.Nil(err)
+	assert.Equal(v, "a 1")
+	v, err = c.Get("a", ld.load)
+	assert.Nil(err)
+	assert.Equal(v, "a 1")
+	v, err = c.Get("b", ld.load)
+	assert.Nil(err)
+	assert.Equal(v, "b 1")
+	c.Put("c", "c 0", 0)
+	v, err = c.Get("c", ld.load)
+	assert.Nil(err)
+	assert.Equal(v, "c 0")
+	assert.Equal(c.Len(), 3)
+	c.Remove("a")
+	v, err = c.Get("a", ld.load)
+	assert.Nil(err)
+	assert.Equal(v, "a 2")
+	c.Clear()
+	assert.Equal(c.Len(), 0)
+
+	m := c.Metrics()
+	assert.Equal(m.Hits, int64(2))
+	assert.Equal(m.Misses, int64(3))
+	assert.Equal(m.Loads, int64(3))
+	assert.True(m.LoadTime > 0)
+}
+
+// Test the expiration of keyed values.
+func TestKeyedTTL(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	// Environment.
+	c, err := cache.NewCache(&cache.Options[string]{TTL: time.Minute})
+	assert.Nil(err)
+	ld := newLoader()
+	short := func(key string) (string, time.Duration, error) {
+		v, _, err := ld.load(key)
+		return v, 25 * time.Millisecond, err
+	}
+
+	// Asserts.
+	c.Get("a", ld.load)
+	c.Get("b", short)
+	time.Sleep(100 * time.Millisecond)
+	v, _ := c.Get("a", ld.load)
+	assert.Equal(v, "a 1")
+	v, _ = c.Get("b", short)
+	assert.Equal(v, "b 2")
+	assert.Equal(c.Metrics().Expirations, int64(1))
+}
+
+// Test the LRU eviction.
+func TestKeyedLRU(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	// Environment.
+	c, err := cache.NewCache(&cache.Options[string]{
+		MaxEntries: 3,
+		Policy:     cache.LRU,
+		Shards:     1,
+	})
+	assert.Nil(err)
+	ld := newLoader()
+
+	// Asserts.
+	c.Get("a", ld.load)
+	c.Get("b", ld.load)
+	c.Get("c", ld.load)
+	c.Get("a", ld.load)
+	c.Get("d", ld.load)
+	assert.Equal(c.Len(), 3)
+	assert.Equal(c.Metrics().Evictions, int64(1))
+	v, _ := c.Get("a", ld.load)
+	assert.Equal(v, "a 1")
+	v, _ = c.Get("b", ld.load)
+	assert.Equal(v, "b 2")
+}
+
+// Test the LFU eviction.
+func TestKeyedLFU(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	// Environment.
+	c, err := cache.NewCache(&cache.Options[string]{
+		MaxEntries: 3,
+		Policy:     cache.LFU,
+		Shards:     1,
+	})
+	assert.Nil(err)
+	ld := newLoader()
+
+	// Asserts.
+	c.Get("a", ld.load)
+	c.Get("a", ld.load)
+	c.Get("b", ld.load)
+	c.Get("b", ld.load)
+	c.Get("c", ld.load)
+	c.Get("d", ld.load)
+	assert.Equal(c.Len(), 3)
+	v, _ := c.Get("a", ld.load)
+	assert.Equal(v, "a 1")
+	v, _ = c.Get("b", ld.load)
+	assert.Equal(v, "b 1")
+	v, _ = c.Get("c", ld.load)
+	assert.Equal(v, "c 2")
+	c.Get("c", ld.load)
+	c.Get("c", ld.load)
+	c.Get("e", ld.load)
+	v, _ = c.Get("e", ld.load)
+	assert.Equal(v, "e 1")
+}
+
+// Test the W-TinyLFU eviction keeping frequent
+// values during a scan.
+func TestKeyedTinyLFU(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	// Environment.
+	c, err := cache.NewCache(&cache.Options[string]{
+		MaxEntries: 10,
+		Policy:     cache.TinyLFU,
+		Shards:     1,
+	})
+	assert.Nil(err)
+	ld := newLoader()
+	hot := []string{"h0", "h1", "h2", "h3", "h4"}
+
+	// Asserts.
+	for _, key := range hot {
+		for i := 0; i < 5; i++ {
+			c.Get(key, ld.load)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		c.Get(fmt.Sprintf("s%d", i), ld.load)
+	}
+	assert.Equal(c.Len(), 10)
+	for _, key := range hot {
+		v, _ := c.Get(key, ld.load)
+		assert.Equal(v, key+" 1")
+	}
+}
+
+// Test the eviction by cost.
+func TestKeyedCost(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	// Environment.
+	c, err := cache.NewCache(&cache.Options[string]{
+		MaxCost: 10,
+		Cost:    func(key, value string) int64 { return int64(len(value)) },
+		Shards:  1,
+	})
+	assert.Nil(err)
+
+	// Asserts.
+	c.Put("a", "12345", 0)
+	c.Put("b", "12345", 0)
+	assert.Equal(c.Len(), 2)
+	c.Put("c", "1", 0)
+	assert.Equal(c.Len(), 2)
+	c.Put("d", "1234567890X", 0)
+	assert.Equal(c.Len(), 2)
+	c.Put("b", "1234567890X", 0)
+	assert.Equal(c.Len(), 1)
+	m := c.Metrics()
+	assert.Equal(m.Evictions, int64(1))
+	assert.Equal(m.Rejections, int64(2))
+}
+
+// Test the division of the limits between the shards.
+func TestKeyedShardLimits(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	// Environment.
+	c, err := cache.NewCache(&cache.Options[string]{
+		MaxEntries: 10,
+		Shards:     3,
+	})
+	assert.Nil(err)
+	ld := newLoader()
+
+	// Asserts.
+	for i := 0; i < 100; i++ {
+		c.Get(fmt.Sprintf("k%d", i), ld.load)
+	}
+	assert.Equal(c.Len(), 10)
+}
+
+// Test concurrent loading of the same key.
+func TestKeyedConcurrentLoad(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	// Environment.
+	c, err := cache.NewCache(&cache.Options[int]{})
+	assert.Nil(err)
+	var mux sync.Mutex
+	ctr := 0
+	slow := func(key string) (int, time.Duration, error) {
+		time.Sleep(50 * time.Millisecond)
+		mux.Lock()
+		defer mux.Unlock()
+		ctr++
+		return ctr, 0, nil
+	}
+
+	// Asserts.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.Get("slow", slow)
+			assert.Nil(err)
+			assert.Equal(v, 1)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(c.Metrics().Loads, int64(1))
+}
+
+// Test changing keys while they are loaded.
+func TestKeyedLoadInvalidation(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	// Environment.
+	c, err := cache.NewCache(&cache.Options[string]{})
+	assert.Nil(err)
+	ld := newLoader()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	blocked := func(key string) (string, time.Duration, error) {
+		started <- struct{}{}
+		<-release
+		return ld.load(key)
+	}
+	getBlocked := func(key string, change func()) string {
+		done := make(chan string)
+		go func() {
+			v, err := c.Get(key, blocked)
+			assert.Nil(err)
+			done <- v
+		}()
+		<-started
+		change()
+		release <- struct{}{}
+		return <-done
+	}
+
+	// Asserts.
+	v := getBlocked("a", func() { c.Remove("a") })
+	assert.Equal(v, "a 1")
+	assert.Equal(c.Len(), 0)
+	v, _ = c.Get("a", ld.load)
+	assert.Equal(v, "a 2")
+
+	v = getBlocked("b", func() { c.Put("b", "b 0", 0) })
+	assert.Equal(v, "b 1")
+	v, _ = c.Get("b", ld.load)
+	assert.Equal(v, "b 0")
+
+	v = getBlocked("c", c.Clear)
+	assert.Equal(v, "c 1")
+	assert.Equal(c.Len(), 0)
+}
+
+// Test the loading with errors and panics.
+func TestKeyedLoadErrors(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	// Environment.
+	c, err := cache.NewCache(&cache.Options[int]{})
+	assert.Nil(err)
+	ctr := 0
+	efunc := func(key string) (int, time.Duration, error) {
+		ctr++
+		return 0, 0, fmt.Errorf("ouch %d", ctr)
+	}
+	pfunc := func(key string) (int, time.Duration, error) {
+		panic("ouch")
+	}
+
+	// Asserts.
+	_, err = c.Get("error", efunc)
+	assert.ErrorMatch(err, "ouch 1")
+	_, err = c.Get("error", efunc)
+	assert.ErrorMatch(err, "ouch 2")
+	_, err = c.Get("panic", pfunc)
+	assert.ErrorMatch(err, `\[E.*\] cannot retrieve cached value: ouch`)
+	assert.Equal(c.Len(), 0)
+	assert.Equal(c.Metrics().LoadErrors, int64(3))
+}
+
+// Test invalid options.
+func TestKeyedInvalidOptions(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	_, err := cache.NewCache(&cache.Options[string]{MaxCost: 10})
+	assert.ErrorMatch(err, `.*invalid cache option "cost".*`)
+	_, err = cache.NewCache(&cache.Options[string]{Policy: cache.Policy(99)})
+	assert.ErrorMatch(err, `.*invalid cache option "policy".*`)
+	_, err = cache.NewCache(&cache.Options[string]{Shards: -1})
+	assert.ErrorMatch(err, `.*invalid cache option "shards".*`)
+	c, err := cache.NewCache[string](nil)
+	assert.Nil(err)
+	assert.NotNil(c)
+}
+
+//--------------------
+// HELPER
+//--------------------
+
+// loader counts the loads per key.
+type loader struct {
+	mux    sync.Mutex
+	counts map[string]int
+}
+
+func newLoader() *loader {
+	return &loader{counts: make(map[string]int)}
+}
+
+func (l *loader) load(key string) (string, time.Duration, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.counts[key]++
+	return fmt.Sprintf("%s %d", key, l.counts[key]), 0, nil
+}
+
 // EOF
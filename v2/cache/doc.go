@@ -7,7 +7,14 @@
 
 // Cache provides a caching for individual lazy loaded values.
 //
-// The retrieval function and the timeout have to be specified.
+// The retrieval function and the timeout have to be specified. New()
+// creates typed values, NewCachedValue() untyped ones wrapping them.
+//
+// NewCache() creates a keyed cache loading values with a loader per
+// call of Get(). The number and the cost of the entries can be limited,
+// exceeding entries are evicted by LRU, LFU, or W-TinyLFU. The cache is
+// divided into shards with own locks for concurrent access and reports
+// metrics like hits, misses, evictions, and the load time.
 package cache
 
 // EOF
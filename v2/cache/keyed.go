@@ -0,0 +1,389 @@
+// Tideland Go Data Management - Cache - Keyed Cache
+//
+// Copyright (C) 2009-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cache
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// OPTIONS
+//--------------------
+
+// Options of a keyed cache for values of type V.
+type Options[V any] struct {
+	// TTL is the time to live of the entries if the loader
+	// returns none. Default is 0, entries don't expire.
+	TTL time.Duration
+
+	// MaxEntries is the maximum number of entries. Default
+	// is 0, the number isn't limited.
+	MaxEntries int
+
+	// MaxCost is the maximum sum of the costs of the entries,
+	// e.g. in bytes. Cost has to be set too. Default is 0,
+	// the cost isn't limited.
+	MaxCost int64
+
+	// Cost returns the cost of a value, e.g. its size in bytes.
+	Cost func(key string, value V) int64
+
+	// Policy defines which entries are evicted if a limit
+	// is exceeded. Default is LRU.
+	Policy Policy
+
+	// Shards is the number of independently locked parts of
+	// the cache. The limits are divided between them, so
+	// entries may be evicted before the total limit is
+	// reached. Values costing more than the part of a shard
+	// aren't stored. Default is 16. There are never more
+	// shards than MaxEntries or MaxCost.
+	Shards int
+}
+
+// check checks the options and sets the defaults.
+func (o *Options[V]) check() error {
+	if o.TTL < 0 {
+		return errors.New(ErrInvalidOptions, errorMessages, "ttl", o.TTL)
+	}
+	if o.MaxEntries < 0 {
+		return errors.New(ErrInvalidOptions, errorMessages, "max entries", o.MaxEntries)
+	}
+	if o.MaxCost < 0 {
+		return errors.New(ErrInvalidOptions, errorMessages, "max cost", o.MaxCost)
+	} else if o.MaxCost > 0 && o.Cost == nil {
+		return errors.New(ErrInvalidOptions, errorMessages, "cost", "nil")
+	}
+	switch o.Policy {
+	case LRU, LFU, TinyLFU:
+	default:
+		return errors.New(ErrInvalidOptions, errorMessages, "policy", o.Policy)
+	}
+	if o.Shards == 0 {
+		o.Shards = 16
+	} else if o.Shards < 0 {
+		return errors.New(ErrInvalidOptions, errorMessages, "shards", o.Shards)
+	}
+	// Each shard needs a part of the limits.
+	if o.MaxEntries > 0 && o.MaxEntries < o.Shards {
+		o.Shards = o.MaxEntries
+	}
+	if o.MaxCost > 0 && o.MaxCost < int64(o.Shards) {
+		o.Shards = int(o.MaxCost)
+	}
+	return nil
+}
+
+//--------------------
+// METRICS
+//--------------------
+
+// Metrics contains the counters of a keyed cache.
+type Metrics struct {
+	// Hits is the number of found entries.
+	Hits int64
+
+	// Misses is the number of entries not found
+	// or expired, leading to loads.
+	Misses int64
+
+	// Loads is the number of calls of loaders,
+	// LoadErrors the number of failed ones.
+	Loads      int64
+	LoadErrors int64
+
+	// LoadTime is the total duration of the loads.
+	LoadTime time.Duration
+
+	// Evictions is the number of entries removed due to
+	// the limits, Expirations the number of expired ones.
+	Evictions   int64
+	Expirations int64
+
+	// Rejections is the number of values not stored
+	// because they cost more than a shard may hold.
+	Rejections int64
+}
+
+//--------------------
+// KEYED CACHE
+//--------------------
+
+// Loader loads the value of a key if it isn't cached. A ttl of
+// 0 leads to the TTL of the options.
+type Loader[V any] func(key string) (value V, ttl time.Duration, err error)
+
+// Cache stores values of type V by key.
+type Cache[V any] struct {
+	metrics Metrics // First for the alignment of the atomic counters.
+	options *Options[V]
+	shards  []*shard[V]
+}
+
+// NewCache creates a keyed cache. Nil options lead to the defaults.
+func NewCache[V any](o *Options[V]) (*Cache[V], error) {
+	oc := &Options[V]{}
+	if o != nil {
+		*oc = *o
+	}
+	if err := oc.check(); err != nil {
+		return nil, err
+	}
+	c := &Cache[V]{
+		options: oc,
+		shards:  make([]*shard[V], oc.Shards),
+	}
+	for i := range c.shards {
+		maxEntries := divideLimit(int64(oc.MaxEntries), oc.Shards, i)
+		maxCost := divideLimit(oc.MaxCost, oc.Shards, i)
+		c.shards[i] = &shard[V]{
+			cache:      c,
+			entries:    make(map[string]*entry[V]),
+			loads:      make(map[string]*load[V]),
+			policy:     newPolicy(oc.Policy, int(maxEntries)),
+			maxEntries: int(maxEntries),
+			maxCost:    maxCost,
+		}
+	}
+	return c, nil
+}
+
+// Get returns the value of the key. If it isn't cached or expired
+// it's loaded with the loader. Concurrent requests of the same key
+// wait for one load. Errors aren't cached.
+func (c *Cache[V]) Get(key string, loader Loader[V]) (V, error) {
+	return c.shard(key).get(key, loader)
+}
+
+// Put stores the value of the key. A ttl of 0 leads
+// to the TTL of the options.
+func (c *Cache[V]) Put(key string, value V, ttl time.Duration) {
+	s := c.shard(key)
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.put(key, value, ttl)
+}
+
+// Remove removes the value of the key.
+func (c *Cache[V]) Remove(key string) {
+	s := c.shard(key)
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.remove(key)
+}
+
+// Clear removes all values.
+func (c *Cache[V]) Clear() {
+	for _, s := range c.shards {
+		s.mux.Lock()
+		for key := range s.entries {
+			s.remove(key)
+		}
+		for key := range s.loads {
+			delete(s.loads, key)
+		}
+		s.mux.Unlock()
+	}
+}
+
+// Len returns the number of cached values including
+// expired ones not yet removed.
+func (c *Cache[V]) Len() int {
+	l := 0
+	for _, s := range c.shards {
+		s.mux.Lock()
+		l += len(s.entries)
+		s.mux.Unlock()
+	}
+	return l
+}
+
+// Metrics returns the current metrics.
+func (c *Cache[V]) Metrics() Metrics {
+	return Metrics{
+		Hits:        atomic.LoadInt64(&c.metrics.Hits),
+		Misses:      atomic.LoadInt64(&c.metrics.Misses),
+		Loads:       atomic.LoadInt64(&c.metrics.Loads),
+		LoadErrors:  atomic.LoadInt64(&c.metrics.LoadErrors),
+		LoadTime:    time.Duration(atomic.LoadInt64((*int64)(&c.metrics.LoadTime))),
+		Evictions:   atomic.LoadInt64(&c.metrics.Evictions),
+		Expirations: atomic.LoadInt64(&c.metrics.Expirations),
+		Rejections:  atomic.LoadInt64(&c.metrics.Rejections),
+	}
+}
+
+// shard returns the shard of a key. It's selected by the high
+// bits of the hash, the frequency sketches use the low ones.
+func (c *Cache[V]) shard(key string) *shard[V] {
+	return c.shards[(hashKey(key)>>32)%uint64(len(c.shards))]
+}
+
+// divideLimit returns the part of a limit for the shard with
+// the index. The remainder is distributed between the first
+// shards, so that the parts sum up to the limit.
+func divideLimit(limit int64, shards, index int) int64 {
+	part := limit / int64(shards)
+	if int64(index) < limit%int64(shards) {
+		part++
+	}
+	return part
+}
+
+//--------------------
+// SHARD
+//--------------------
+
+// entry is one cached value.
+type entry[V any] struct {
+	value   V
+	cost    int64
+	expires time.Time
+}
+
+// expired checks if the entry is expired.
+func (e *entry[V]) expired(now time.Time) bool {
+	return !e.expires.IsZero() && now.After(e.expires)
+}
+
+// load is a running load of a key. It's removed from the
+// shard when the key is changed during the load, so that
+// its then stale value isn't stored.
+type load[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// shard is one independently locked part of a cache.
+type shard[V any] struct {
+	mux        sync.Mutex
+	cache      *Cache[V]
+	entries    map[string]*entry[V]
+	loads      map[string]*load[V]
+	policy     policy
+	cost       int64
+	maxEntries int
+	maxCost    int64
+}
+
+// get returns the value of the key or loads it.
+func (s *shard[V]) get(key string, loader Loader[V]) (V, error) {
+	metrics := &s.cache.metrics
+	s.mux.Lock()
+	if e, ok := s.entries[key]; ok {
+		if !e.expired(time.Now()) {
+			s.policy.access(key)
+			s.mux.Unlock()
+			atomic.AddInt64(&metrics.Hits, 1)
+			return e.value, nil
+		}
+		s.remove(key)
+		atomic.AddInt64(&metrics.Expirations, 1)
+	}
+	atomic.AddInt64(&metrics.Misses, 1)
+	if l, ok := s.loads[key]; ok {
+		// Wait for the running load.
+		s.mux.Unlock()
+		<-l.done
+		return l.value, l.err
+	}
+	l := &load[V]{done: make(chan struct{})}
+	s.loads[key] = l
+	s.mux.Unlock()
+
+	start := time.Now()
+	value, ttl, err := callLoader(key, loader)
+	atomic.AddInt64(&metrics.Loads, 1)
+	atomic.AddInt64((*int64)(&metrics.LoadTime), int64(time.Since(start)))
+	if err != nil {
+		atomic.AddInt64(&metrics.LoadErrors, 1)
+	}
+
+	s.mux.Lock()
+	if s.loads[key] == l {
+		delete(s.loads, key)
+		if err == nil {
+			s.put(key, value, ttl)
+		}
+	}
+	s.mux.Unlock()
+	l.value, l.err = value, err
+	close(l.done)
+	return value, err
+}
+
+// put stores the value and evicts entries if the limits are
+// exceeded. A value costing more than the shard may hold is
+// rejected, so that it doesn't evict all other entries.
+func (s *shard[V]) put(key string, value V, ttl time.Duration) {
+	s.remove(key)
+	if ttl <= 0 {
+		ttl = s.cache.options.TTL
+	}
+	e := &entry[V]{value: value}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+	if s.cache.options.Cost != nil {
+		e.cost = s.cache.options.Cost(key, value)
+	}
+	if s.maxCost > 0 && e.cost > s.maxCost {
+		atomic.AddInt64(&s.cache.metrics.Rejections, 1)
+		return
+	}
+	s.entries[key] = e
+	s.cost += e.cost
+	s.policy.add(key)
+	for s.exceeded() {
+		victim, ok := s.policy.victim()
+		if !ok {
+			break
+		}
+		s.remove(victim)
+		atomic.AddInt64(&s.cache.metrics.Evictions, 1)
+	}
+}
+
+// remove removes the entry of the key and
+// invalidates a running load of it.
+func (s *shard[V]) remove(key string) {
+	delete(s.loads, key)
+	if e, ok := s.entries[key]; ok {
+		s.cost -= e.cost
+		delete(s.entries, key)
+		s.policy.remove(key)
+	}
+}
+
+// exceeded checks if the shard exceeds its limits.
+func (s *shard[V]) exceeded() bool {
+	return (s.maxEntries > 0 && len(s.entries) > s.maxEntries) ||
+		(s.maxCost > 0 && s.cost > s.maxCost)
+}
+
+// callLoader calls the loader and returns a panic as error.
+func callLoader[V any](key string, loader Loader[V]) (value V, ttl time.Duration, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			var zero V
+			value = zero
+			err = errors.New(ErrCannotRetrieve, errorMessages, r)
+		}
+	}()
+	return loader(key)
+}
+
+// EOF
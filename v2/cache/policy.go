@@ -0,0 +1,432 @@
+// Tideland Go Data Management - Cache - Eviction Policies
+//
+// Copyright (C) 2009-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package cache
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"container/heap"
+	"container/list"
+	"hash/fnv"
+)
+
+//--------------------
+// POLICY
+//--------------------
+
+// Policy defines which entries are evicted when a
+// cache exceeds its limits.
+type Policy int
+
+// Eviction policies.
+const (
+	// LRU evicts the least recently used entries.
+	LRU Policy = iota
+
+	// LFU evicts the least frequently used entries.
+	LFU
+
+	// TinyLFU evicts using W-TinyLFU. New entries pass a small
+	// LRU window and then only replace entries of the main space
+	// if they have been requested more frequently.
+	TinyLFU
+)
+
+// policy tracks the keys of one shard and chooses the victims.
+type policy interface {
+	// add tracks a new key.
+	add(key string)
+
+	// access tracks an access to a key.
+	access(key string)
+
+	// remove stops tracking a key.
+	remove(key string)
+
+	// victim returns the key to evict next.
+	victim() (string, bool)
+}
+
+// newPolicy creates the policy for a shard. The capacity is
+// the maximum number of entries, 0 if it's not limited.
+func newPolicy(p Policy, capacity int) policy {
+	switch p {
+	case LFU:
+		return newLFUPolicy()
+	case TinyLFU:
+		return newTinyLFUPolicy(capacity)
+	}
+	return newLRUPolicy()
+}
+
+//--------------------
+// LRU
+//--------------------
+
+// lruPolicy keeps the keys in the order of their usage.
+type lruPolicy struct {
+	order    *list.List
+	elements map[string]*list.Element
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{
+		order:    list.New(),
+		elements: make(map[string]*list.Element),
+	}
+}
+
+func (p *lruPolicy) add(key string) {
+	p.elements[key] = p.order.PushFront(key)
+}
+
+func (p *lruPolicy) access(key string) {
+	if e, ok := p.elements[key]; ok {
+		p.order.MoveToFront(e)
+	}
+}
+
+func (p *lruPolicy) remove(key string) {
+	if e, ok := p.elements[key]; ok {
+		p.order.Remove(e)
+		delete(p.elements, key)
+	}
+}
+
+func (p *lruPolicy) victim() (string, bool) {
+	if e := p.order.Back(); e != nil {
+		return e.Value.(string), true
+	}
+	return "", false
+}
+
+//--------------------
+// LFU
+//--------------------
+
+// lfuItem is a key with its number of accesses. The
+// tick of the last access decides between equal ones.
+type lfuItem struct {
+	key   string
+	count int
+	tick  uint64
+	index int
+}
+
+// lfuHeap orders the items by count and tick.
+type lfuHeap []*lfuItem
+
+func (h lfuHeap) Len() int {
+	return len(h)
+}
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].count == h[j].count {
+		return h[i].tick < h[j].tick
+	}
+	return h[i].count < h[j].count
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	item := x.(*lfuItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// lfuAging is the number of accesses per key after which
+// the counts are halved, so that formerly popular keys
+// don't stay forever.
+const lfuAging = 10
+
+// lfuPolicy keeps the keys in a heap by their number of accesses.
+// The last added key is never the victim while there are others,
+// it otherwise would be evicted before getting any access.
+type lfuPolicy struct {
+	tick     uint64
+	accesses int
+	added    string
+	heap     lfuHeap
+	items    map[string]*lfuItem
+}
+
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{
+		items: make(map[string]*lfuItem),
+	}
+}
+
+func (p *lfuPolicy) add(key string) {
+	p.tick++
+	item := &lfuItem{key: key, count: 1, tick: p.tick}
+	p.items[key] = item
+	p.added = key
+	heap.Push(&p.heap, item)
+}
+
+func (p *lfuPolicy) access(key string) {
+	if item, ok := p.items[key]; ok {
+		p.tick++
+		item.count++
+		item.tick = p.tick
+		heap.Fix(&p.heap, item.index)
+		p.accesses++
+		if p.accesses >= lfuAging*len(p.items) {
+			p.age()
+		}
+	}
+}
+
+func (p *lfuPolicy) remove(key string) {
+	if item, ok := p.items[key]; ok {
+		heap.Remove(&p.heap, item.index)
+		delete(p.items, key)
+	}
+}
+
+func (p *lfuPolicy) victim() (string, bool) {
+	switch {
+	case len(p.heap) == 0:
+		return "", false
+	case p.heap[0].key != p.added || len(p.heap) == 1:
+		return p.heap[0].key, true
+	case len(p.heap) == 2 || p.heap.Less(1, 2):
+		return p.heap[1].key, true
+	}
+	return p.heap[2].key, true
+}
+
+// age halves the counts of all keys.
+func (p *lfuPolicy) age() {
+	for _, item := range p.heap {
+		item.count = (item.count + 1) / 2
+	}
+	heap.Init(&p.heap)
+	p.accesses = 0
+}
+
+//--------------------
+// W-TINYLFU
+//--------------------
+
+// Segments of the W-TinyLFU policy.
+const (
+	windowSegment = iota
+	probationSegment
+	protectedSegment
+)
+
+// tinyLFUItem is a key with its segment.
+type tinyLFUItem struct {
+	key     string
+	segment int
+}
+
+// tinyLFUPolicy keeps new keys in a window of about 1% of the
+// entries. Keys leaving the window enter the probation segment of
+// the main space as candidate. When evicting the candidate is only
+// kept if it's more frequent than the victim of the main space.
+// Accessing keys in the probation segment protects them. The
+// frequencies are estimated with a count-min sketch.
+type tinyLFUPolicy struct {
+	sketch    *sketch
+	segments  [3]*list.List
+	elements  map[string]*list.Element
+	candidate string
+}
+
+func newTinyLFUPolicy(capacity int) *tinyLFUPolicy {
+	return &tinyLFUPolicy{
+		sketch:   newSketch(capacity),
+		segments: [3]*list.List{list.New(), list.New(), list.New()},
+		elements: make(map[string]*list.Element),
+	}
+}
+
+func (p *tinyLFUPolicy) add(key string) {
+	p.sketch.increment(key)
+	window := p.segments[windowSegment]
+	p.elements[key] = window.PushFront(&tinyLFUItem{key, windowSegment})
+	for window.Len() > p.windowSize() {
+		back := window.Back()
+		p.move(back, probationSegment)
+		p.candidate = back.Value.(*tinyLFUItem).key
+	}
+}
+
+func (p *tinyLFUPolicy) access(key string) {
+	p.sketch.increment(key)
+	e, ok := p.elements[key]
+	if !ok {
+		return
+	}
+	item := e.Value.(*tinyLFUItem)
+	if item.segment != probationSegment {
+		p.segments[item.segment].MoveToFront(e)
+		return
+	}
+	// Protect the key, the protected segment
+	// keeps at most 80% of the main space.
+	p.move(e, protectedSegment)
+	protected := p.segments[protectedSegment]
+	main := p.segments[probationSegment].Len() + protected.Len()
+	if protected.Len() > main*8/10 {
+		p.move(protected.Back(), probationSegment)
+	}
+}
+
+func (p *tinyLFUPolicy) remove(key string) {
+	if e, ok := p.elements[key]; ok {
+		p.segments[e.Value.(*tinyLFUItem).segment].Remove(e)
+		delete(p.elements, key)
+	}
+}
+
+func (p *tinyLFUPolicy) victim() (string, bool) {
+	var victim *list.Element
+	for _, segment := range []int{probationSegment, protectedSegment, windowSegment} {
+		if victim = p.segments[segment].Back(); victim != nil {
+			break
+		}
+	}
+	if victim == nil {
+		return "", false
+	}
+	// Let the candidate compete with the victim.
+	e, ok := p.elements[p.candidate]
+	if !ok || e == victim || e.Value.(*tinyLFUItem).segment != probationSegment {
+		return victim.Value.(*tinyLFUItem).key, true
+	}
+	candidate := p.candidate
+	victimKey := victim.Value.(*tinyLFUItem).key
+	p.candidate = ""
+	if p.sketch.estimate(candidate) > p.sketch.estimate(victimKey) {
+		return victimKey, true
+	}
+	return candidate, true
+}
+
+// windowSize returns the size of the window, it's 1% of the entries.
+func (p *tinyLFUPolicy) windowSize() int {
+	size := len(p.elements) / 100
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// move moves an element to the front of a segment.
+func (p *tinyLFUPolicy) move(e *list.Element, segment int) {
+	item := e.Value.(*tinyLFUItem)
+	p.segments[item.segment].Remove(e)
+	item.segment = segment
+	p.elements[item.key] = p.segments[segment].PushFront(item)
+}
+
+//--------------------
+// SKETCH
+//--------------------
+
+// sketchDepth is the number of rows of a sketch.
+const sketchDepth = 4
+
+// sketch is a count-min sketch estimating the frequencies of
+// keys. The counters are halved periodically, so that former
+// popular keys age out.
+type sketch struct {
+	mask     uint64
+	rows     [sketchDepth][]uint8
+	samples  int
+	maxCount int
+}
+
+// newSketch creates a sketch for about capacity keys.
+func newSketch(capacity int) *sketch {
+	if capacity < 64 {
+		capacity = 1024
+	}
+	width := 1
+	for width < capacity {
+		width <<= 1
+	}
+	s := &sketch{
+		mask:     uint64(width - 1),
+		maxCount: 10 * width,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// increment counts an access to the key.
+func (s *sketch) increment(key string) {
+	h := hashKey(key)
+	for i := range s.rows {
+		idx := s.index(h, i)
+		if s.rows[i][idx] < 15 {
+			s.rows[i][idx]++
+		}
+	}
+	s.samples++
+	if s.samples >= s.maxCount {
+		s.reset()
+	}
+}
+
+// estimate returns the estimated number of accesses to the key.
+func (s *sketch) estimate(key string) uint8 {
+	h := hashKey(key)
+	min := uint8(15)
+	for i := range s.rows {
+		if count := s.rows[i][s.index(h, i)]; count < min {
+			min = count
+		}
+	}
+	return min
+}
+
+// reset halves all counters.
+func (s *sketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.samples /= 2
+}
+
+// index returns the index of a hash in a row.
+func (s *sketch) index(h uint64, row int) uint64 {
+	return (h + uint64(row)*(h>>32|1)) & s.mask
+}
+
+// hashKey returns the hash of a key.
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// EOF
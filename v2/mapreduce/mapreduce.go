@@ -70,6 +70,12 @@ func MapReduce(mr MapReducer) error {
 	return mr.Consume(reduceEmitChan)
 }
 
+// Partition returns the partition of a key out of the passed number
+// of partitions. The same key always leads to the same partition.
+func Partition(key string, size int) int {
+	return int(adler32.Checksum([]byte(key)) % uint32(size))
+}
+
 //--------------------
 // PRIVATE
 //--------------------
@@ -113,9 +119,7 @@ func performReducing(mr MapReducer, mapEmitChan, reduceEmitChan KeyValueChan) {
 
 	// Read map emitted data.
 	for kv := range mapEmitChan {
-		hash := adler32.Checksum([]byte(kv.Key()))
-		idx := hash % uint32(size)
-		reduceChans[idx] <- kv
+		reduceChans[Partition(kv.Key(), size)] <- kv
 	}
 
 	// Close reduce channels.
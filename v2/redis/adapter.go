@@ -0,0 +1,398 @@
+// Tideland Go Data Management - Redis Client - Adapter
+//
+// Copyright (C) 2009-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sync"
+
+	"github.com/tideland/goas/v3/errors"
+	v3 "github.com/tideland/godm/v3/redis"
+	"github.com/tideland/godm/v3/resp"
+)
+
+//--------------------
+// ADAPTER
+//--------------------
+
+// adapter implements the Database interface on top of
+// version 3 of the Redis client.
+type adapter struct {
+	mux           sync.Mutex
+	configuration *Configuration
+	database      *v3.Database
+	closed        bool
+}
+
+// Adapt returns a Database performing the commands with the passed
+// database of version 3 of the client, e.g. to migrate step by step.
+// Only the subscription fields of the configuration are used, the
+// others are set by the options of the database. The configuration
+// may be nil for the defaults.
+func Adapt(db *v3.Database, c *Configuration) (Database, error) {
+	cc, err := prepareConfiguration(c)
+	if err != nil {
+		return nil, err
+	}
+	return &adapter{
+		configuration: cc,
+		database:      db,
+	}, nil
+}
+
+// ConnectAdapted opens a database of version 3 of the client based
+// on the configuration and adapts it. Instead of the health checks
+// the pool of version 3 replaces broken connections.
+func ConnectAdapted(c *Configuration) (Database, error) {
+	cc, err := prepareConfiguration(c)
+	if err != nil {
+		return nil, err
+	}
+	options := []v3.Option{}
+	if cc.UnixSockets {
+		options = append(options, v3.UnixConnection(cc.Address, cc.Timeout))
+	} else {
+		options = append(options, v3.TcpConnection(cc.Address, cc.Timeout))
+	}
+	options = append(options,
+		v3.Index(cc.Database, cc.Auth),
+		v3.Username(cc.Username),
+		v3.PoolSize(cc.PoolSize),
+		v3.Monitoring(cc.LogCommands, cc.MonitorCommands),
+	)
+	if cc.TLS != nil {
+		options = append(options, v3.TLS(cc.TLS))
+	}
+	db, err := v3.Open(options...)
+	if err != nil {
+		return nil, errors.Annotate(err, ErrInvalidConfiguration, errorMessages, "options", err)
+	}
+	return &adapter{
+		configuration: cc,
+		database:      db,
+	}, nil
+}
+
+func (a *adapter) Close() {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	if !a.closed {
+		a.closed = true
+		a.database.Close()
+	}
+}
+
+func (a *adapter) Command(cmd string, args ...interface{}) (ResultSet, error) {
+	conn, err := a.connection()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+	return conn.command(cmd, args...)
+}
+
+func (a *adapter) CommandReply(cmd string, args ...interface{}) (*resp.Reply, error) {
+	conn, err := a.connection()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+	return conn.commandReply(cmd, args...)
+}
+
+func (a *adapter) AsyncCommand(cmd string, args ...interface{}) Future {
+	fut := newFuture()
+	go func() {
+		rs, err := a.Command(cmd, args...)
+		fut.setResult(rs, err)
+	}()
+	return fut
+}
+
+func (a *adapter) MultiCommand(f func(MultiCommand) error) (ResultSets, error) {
+	conn, err := a.connection()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+	mc := newMultiCommand(conn)
+	if err = f(mc); err == nil {
+		err = mc.begin()
+	}
+	if err != nil {
+		mc.Discard()
+		return nil, err
+	}
+	reply, err := conn.commandReply("exec")
+	if err != nil {
+		return nil, err
+	}
+	return execResultSets(reply)
+}
+
+func (a *adapter) AsyncMultiCommand(f func(MultiCommand) error) Future {
+	fut := newFuture()
+	go func() {
+		rss, err := a.MultiCommand(f)
+		fut.setResult(rss, err)
+	}()
+	return fut
+}
+
+func (a *adapter) Subscribe(channels ...string) (Subscription, error) {
+	if err := a.checkClosed(); err != nil {
+		return nil, err
+	}
+	sub, err := a.database.Subscription()
+	if err != nil {
+		return nil, adaptError("subscribe", err)
+	}
+	return newSubscription(newAdapterSubscriber(sub), a.configuration, channels...)
+}
+
+func (a *adapter) Publish(channel string, message interface{}) (int, error) {
+	rs, err := a.Command("publish", channel, message)
+	if err != nil {
+		return 0, err
+	}
+	return rs.FirstValue().Int()
+}
+
+// connection retrieves a connection of the database.
+func (a *adapter) connection() (*adapterConnection, error) {
+	if err := a.checkClosed(); err != nil {
+		return nil, err
+	}
+	conn, err := a.database.Connection()
+	if err != nil {
+		return nil, adaptError("connection", err)
+	}
+	return &adapterConnection{conn}, nil
+}
+
+// checkClosed returns an error if the adapter is closed.
+func (a *adapter) checkClosed() error {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	if a.closed {
+		return errors.New(ErrDatabaseClosed, errorMessages)
+	}
+	return nil
+}
+
+//--------------------
+// ADAPTER CONNECTION
+//--------------------
+
+// adapterConnection performs the commands with a connection
+// of version 3, the replies are converted like those of the
+// connectors.
+type adapterConnection struct {
+	conn *v3.Connection
+}
+
+// command executes one Redis command and returns
+// the result as result set.
+func (ac *adapterConnection) command(cmd string, args ...interface{}) (ResultSet, error) {
+	reply, err := ac.commandReply(cmd, args...)
+	if err != nil {
+		return nil, err
+	}
+	return commandResultSet(cmd, reply)
+}
+
+// commandReply executes one Redis command and returns
+// the complete reply including nested arrays.
+func (ac *adapterConnection) commandReply(cmd string, args ...interface{}) (*resp.Reply, error) {
+	rs, err := ac.conn.Do(cmd, args...)
+	switch {
+	case errors.IsError(err, v3.ErrTimeout):
+		// Version 3 returns null arrays and passed
+		// read deadlines as timeouts.
+		return &resp.Reply{Kind: resp.KindNullArray}, nil
+	case err != nil:
+		return nil, adaptError(cmd, err)
+	case rs.IsNil():
+		// Server timeout of a blocking command.
+		return &resp.Reply{Kind: resp.KindNullArray}, nil
+	}
+	return rs.Reply(), nil
+}
+
+// close returns the connection.
+func (ac *adapterConnection) close() error {
+	return adaptError("return", ac.conn.Return())
+}
+
+//--------------------
+// ADAPTER SUBSCRIBER
+//--------------------
+
+// adapterSubscriber sends the (un)subscriptions with a subscription
+// of version 3. A goroutine receives the confirmations and delivers
+// the published values.
+type adapterSubscriber struct {
+	sub           *v3.Subscription
+	startOnce     sync.Once
+	stopOnce      sync.Once
+	confirmations chan adapterConfirmation
+	channels      map[string]bool
+	stopping      chan struct{}
+	done          chan struct{}
+	err           error
+}
+
+// adapterConfirmation is the confirmation of a (un)subscription
+// or the error reply of the server.
+type adapterConfirmation struct {
+	pv  *v3.PublishedValue
+	err error
+}
+
+// newAdapterSubscriber creates the subscriber for a
+// subscription of version 3.
+func newAdapterSubscriber(sub *v3.Subscription) *adapterSubscriber {
+	return &adapterSubscriber{
+		sub:           sub,
+		confirmations: make(chan adapterConfirmation),
+		channels:      make(map[string]bool),
+		stopping:      make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// subscription subscribes or unsubscribes a number of channels and
+// returns the number of currently subscribed channels.
+func (as *adapterSubscriber) subscription(sub *subscription, cmd string, channels ...string) (int, error) {
+	as.startOnce.Do(func() {
+		go as.receiveLoop(sub)
+	})
+	var err error
+	if cmd == "subscribe" {
+		err = as.sub.Subscribe(channels...)
+	} else {
+		err = as.sub.Unsubscribe(channels...)
+	}
+	if err != nil {
+		return -1, adaptError(cmd, err)
+	}
+	// Wait for one confirmation per channel or, without channels,
+	// until no channel remains. Patterns may stay subscribed.
+	confirmed := 0
+	for {
+		select {
+		case c := <-as.confirmations:
+			if c.err != nil {
+				// Server rejected the command.
+				return -1, errors.Annotate(c.err, ErrServerResponse, errorMessages)
+			}
+			confirmed++
+			switch c.pv.Kind {
+			case v3.KindSubscribe:
+				as.channels[c.pv.Channel] = true
+			case v3.KindUnsubscribe:
+				delete(as.channels, c.pv.Channel)
+			}
+			if (len(channels) == 0 && (c.pv.Count == 0 || len(as.channels) == 0)) || (len(channels) > 0 && confirmed == len(channels)) {
+				return c.pv.Count, nil
+			}
+		case <-as.done:
+			return -1, adaptError(cmd, as.err)
+		}
+	}
+}
+
+// stop ends the receiving and closes the subscription of version 3.
+func (as *adapterSubscriber) stop() error {
+	var err error
+	as.stopOnce.Do(func() {
+		close(as.stopping)
+		select {
+		case <-as.done:
+			// Receiving ended with a broken connection.
+			err = adaptError("unsubscribe", as.err)
+			if as.err == nil {
+				err = adaptError("unsubscribe", as.sub.Close())
+			}
+			return
+		default:
+		}
+		// Unsubscribing all channels wakes up the receiving, the
+		// remaining confirmations are read when closing.
+		if err = as.sub.Unsubscribe(); err != nil {
+			err = adaptError("unsubscribe", err)
+			return
+		}
+		<-as.done
+		err = adaptError("unsubscribe", as.sub.Close())
+	})
+	return err
+}
+
+// receiveLoop receives the confirmations and publishings until
+// the subscriber is stopped or the connection is broken.
+func (as *adapterSubscriber) receiveLoop(sub *subscription) {
+	defer close(as.done)
+	for {
+		pv, err := as.sub.Pop()
+		select {
+		case <-as.stopping:
+			return
+		default:
+		}
+		if err != nil && !errors.IsError(err, v3.ErrInvalidResponse) {
+			as.err = err
+			return
+		}
+		// An invalid response is an error reply of the server,
+		// e.g. for a command without channels.
+		if err == nil && (pv.Kind == v3.KindMessage || pv.Kind == v3.KindPMessage) {
+			pattern := pv.Pattern
+			if pv.Kind == v3.KindMessage {
+				pattern = "*"
+			}
+			sub.deliver(&publishedValue{pv.Value, pattern, pv.Channel})
+			continue
+		}
+		select {
+		case as.confirmations <- adapterConfirmation{pv, err}:
+		case <-as.stopping:
+			return
+		}
+	}
+}
+
+//--------------------
+// ERRORS
+//--------------------
+
+// adaptError converts an error of version 3 into one of
+// this package, their error codes differ. Errors not known
+// here are failures of the communication.
+func adaptError(cmd string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.IsError(err, v3.ErrTimeout):
+		return errors.New(ErrTimeout, errorMessages, cmd)
+	case errors.IsError(err, v3.ErrConnectionEstablishing):
+		return errors.Annotate(err, ErrConnection, errorMessages)
+	case errors.IsError(err, v3.ErrUseSubscription):
+		return errors.Annotate(err, ErrUnexpectedRequest, errorMessages, cmd)
+	case errors.IsError(err, v3.ErrEncodeArgument), errors.IsError(err, v3.ErrInvalidArity):
+		return errors.Annotate(err, ErrInvalidRequest, errorMessages, cmd)
+	}
+	return errors.Annotate(err, ErrCommunication, errorMessages, err)
+}
+
+// EOF
@@ -13,15 +13,18 @@ package redis
 
 import (
 	"bufio"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"strings"
+	"time"
 
 	"github.com/tideland/goas/v2/identifier"
 	"github.com/tideland/goas/v2/logger"
 	"github.com/tideland/goas/v2/loop"
 	"github.com/tideland/goas/v2/monitoring"
 	"github.com/tideland/goas/v3/errors"
+	"github.com/tideland/godm/v3/resp"
 )
 
 //--------------------
@@ -33,16 +36,17 @@ import (
 type responseEnv struct {
 	rs     ResultSet
 	rss    ResultSets
+	reply  *resp.Reply
 	number int
 	err    error
 }
 
 // requestEnv encapsulates a request for the Redis server.
 type requestEnv struct {
-	command     string
-	arguments   []interface{}
-	responses   chan *responseEnv
-	publishings chan PublishedValue
+	command    string
+	arguments  []interface{}
+	responses  chan *responseEnv
+	subscriber *subscription
 }
 
 // String creates a string representation of the request.
@@ -50,302 +54,6 @@ func (r *requestEnv) String() string {
 	return fmt.Sprintf("REQUEST (C: %s A: %v)", r.command, r.arguments)
 }
 
-//--------------------
-// STATES
-//--------------------
-
-// state represents a connector state and is responsible
-// for handling a response.
-type state interface {
-	// handle handles a request or reply and returns the next state.
-	handle(cnctr *connector, request *requestEnv, reply *replyEnv) (state, error)
-}
-
-// idlingState represents an idling connector.
-type idlingState struct{}
-
-func (st *idlingState) handle(cnctr *connector, request *requestEnv, reply *replyEnv) (state, error) {
-	switch {
-	case request != nil:
-		// Send command to the server.
-		if err := cnctr.sendCommand(request.command, request.arguments); err != nil {
-			return nil, err
-		}
-		if strings.Contains(request.command, "subscribe") {
-			// Anyone of the (un-)subscribe commands.
-			return newSubscriptionState(request, len(request.arguments)), nil
-		}
-		if request.command == "exec" {
-			// A multi-command is executed.
-			return newExecState(request), nil
-		}
-		// A regular command.
-		return newCommandState(request), nil
-	case reply != nil:
-		// No reply expected here.
-		return nil, errors.New(ErrUnexpectedReply, errorMessages, reply)
-	}
-	return st, nil
-}
-
-// commandState represents a connector waiting for a
-// single response after sending a command.
-type commandState struct {
-	request   *requestEnv
-	resultSet ResultSet
-	rsTodo    int
-}
-
-func newCommandState(request *requestEnv) *commandState {
-	return &commandState{
-		request:   request,
-		resultSet: ResultSet{},
-		rsTodo:    1,
-	}
-}
-
-func (st *commandState) handle(cnctr *connector, request *requestEnv, reply *replyEnv) (state, error) {
-	switch {
-	case request != nil:
-		// No request expected here.
-		return nil, errors.New(ErrUnexpectedRequest, errorMessages, request)
-	case reply != nil:
-		// Handle reply.
-		switch reply.kind {
-		case receivingError, nullBulkReply:
-			st.request.responses <- &responseEnv{nil, nil, 0, reply.err}
-			return &idlingState{}, nil
-		case timeoutError:
-			st.request.responses <- &responseEnv{nil, nil, 0, errors.New(ErrTimeout, errorMessages, st.request.command)}
-			return &idlingState{}, nil
-		case statusReply, errorReply, integerReply, bulkReply:
-			st.resultSet = append(st.resultSet, reply.value())
-		case multiBulkReply:
-			count, err := reply.int()
-			if err != nil {
-				st.request.responses <- &responseEnv{nil, nil, 0, err}
-				return &idlingState{}, nil
-			}
-			st.rsTodo = count
-		}
-		// Check if all values are received.
-		if len(st.resultSet) == st.rsTodo {
-			st.request.responses <- &responseEnv{st.resultSet, nil, 0, nil}
-			return &idlingState{}, nil
-		}
-	}
-	return st, nil
-}
-
-// execState represents a connector waiting for a
-// all responses after sending an "exec" command.
-type execState struct {
-	request    *requestEnv
-	resultSets ResultSets
-	resultSet  ResultSet
-	rssTodo    int
-	rsTodo     int
-}
-
-func newExecState(request *requestEnv) *execState {
-	return &execState{
-		request:    request,
-		resultSets: ResultSets{},
-		resultSet:  ResultSet{},
-		rssTodo:    -1,
-		rsTodo:     1,
-	}
-}
-
-func (st *execState) handle(cnctr *connector, request *requestEnv, reply *replyEnv) (state, error) {
-	switch {
-	case request != nil:
-		// No request expected here.
-		return nil, errors.New(ErrUnexpectedRequest, errorMessages, request)
-	case reply != nil:
-		// Handle reply.
-		var count int = -1
-		var err error
-		switch reply.kind {
-		case receivingError, nullBulkReply:
-			st.request.responses <- &responseEnv{nil, nil, 0, reply.err}
-			return &idlingState{}, nil
-		case timeoutError:
-			st.request.responses <- &responseEnv{nil, nil, 0, errors.New(ErrTimeout, errorMessages, st.request.command)}
-			return &idlingState{}, nil
-		case statusReply, errorReply, integerReply, bulkReply:
-			st.resultSet = append(st.resultSet, reply.value())
-		case multiBulkReply:
-			count, err = reply.int()
-			if err != nil {
-				st.request.responses <- &responseEnv{nil, nil, 0, err}
-				return &idlingState{}, nil
-			}
-		}
-		// Check state for next actions.
-		switch {
-		case st.rssTodo == -1:
-			// First length of all result sets.
-			st.rssTodo = count
-		case len(st.resultSet) == st.rsTodo:
-			//  Full result set, append to result sets.
-			st.resultSets = append(st.resultSets, st.resultSet)
-			st.resultSet = ResultSet{}
-			st.rsTodo = 1
-		case count != -1:
-			// Length of next result set.
-			st.rsTodo = count
-		}
-		// Check if it's time to leave.
-		if len(st.resultSets) == st.rssTodo {
-			st.request.responses <- &responseEnv{nil, st.resultSets, 0, nil}
-			return &idlingState{}, nil
-		}
-	}
-	return st, nil
-}
-
-// subscriptionState represents a connector waiting for the
-// responses after sending any of the subscription commands.
-type subscriptionState struct {
-	request    *requestEnv
-	resultSets ResultSets
-	resultSet  ResultSet
-	rssTodo    int
-	rsTodo     int
-}
-
-func newSubscriptionState(request *requestEnv, rssTodo int) *subscriptionState {
-	return &subscriptionState{
-		request:    request,
-		resultSets: ResultSets{},
-		resultSet:  ResultSet{},
-		rssTodo:    rssTodo,
-		rsTodo:     -1,
-	}
-}
-
-func (st *subscriptionState) handle(cnctr *connector, request *requestEnv, reply *replyEnv) (state, error) {
-	switch {
-	case request != nil:
-		// No request expected here.
-		return nil, errors.New(ErrUnexpectedRequest, errorMessages, request)
-	case reply != nil:
-		// Handle reply.
-		var count int = -1
-		var err error
-		switch reply.kind {
-		case receivingError, nullBulkReply:
-			st.request.responses <- &responseEnv{nil, nil, 0, reply.err}
-			return &idlingState{}, nil
-		case timeoutError:
-			st.request.responses <- &responseEnv{nil, nil, 0, errors.New(ErrTimeout, errorMessages, st.request.command)}
-			return &idlingState{}, nil
-		case statusReply, errorReply, integerReply, bulkReply:
-			st.resultSet = append(st.resultSet, reply.value())
-		case multiBulkReply:
-			count, err = reply.int()
-			if err != nil {
-				st.request.responses <- &responseEnv{nil, nil, 0, err}
-				return &idlingState{}, nil
-			}
-		}
-		// Check state for next actions.
-		switch {
-		case len(st.resultSet) == st.rsTodo:
-			//  Full result set, append to result sets.
-			st.resultSets = append(st.resultSets, st.resultSet)
-			st.resultSet = ResultSet{}
-			st.rsTodo = -1
-		case count != -1:
-			// Length of next result set.
-			st.rsTodo = count
-		}
-		// Check if it's time to leave.
-		if len(st.resultSets) == st.rssTodo {
-			count, err = st.resultSets[st.rssTodo-1][2].Int()
-			if err != nil {
-				st.request.responses <- &responseEnv{nil, nil, 0, err}
-				return &idlingState{}, nil
-			}
-			st.request.responses <- &responseEnv{nil, nil, count, nil}
-			return newSsubscribedState(st.request), nil
-		}
-	}
-	return st, nil
-}
-
-// subscribedState represents a connector waiting for publishings or commands
-// changing the subscription.
-type subscribedState struct {
-	request   *requestEnv
-	resultSet ResultSet
-	rsTodo    int
-}
-
-func newSsubscribedState(request *requestEnv) *subscribedState {
-	return &subscribedState{
-		request:   request,
-		resultSet: ResultSet{},
-		rsTodo:    -1,
-	}
-}
-
-func (st *subscribedState) handle(cnctr *connector, request *requestEnv, reply *replyEnv) (state, error) {
-	switch {
-	case request != nil:
-		// Subscription changing requests are valid.
-		if strings.Contains(request.command, "subscribe") {
-			// Anyone of the (un-)subscribe commands.
-			if err := cnctr.sendCommand(request.command, request.arguments); err != nil {
-				return nil, err
-			}
-			return newSubscriptionState(request, len(request.arguments)), nil
-		}
-		// No other request expected here.
-		return nil, errors.New(ErrUnexpectedRequest, errorMessages, request)
-	case reply != nil:
-		// Handle reply.
-		switch reply.kind {
-		case receivingError, nullBulkReply:
-			logger.Errorf("error receiving publishing: %v", reply.err)
-			return &idlingState{}, nil
-		case statusReply, errorReply, integerReply, bulkReply:
-			st.resultSet = append(st.resultSet, reply.value())
-		case multiBulkReply:
-			count, err := reply.int()
-			if err != nil {
-				logger.Errorf("error receiving publishing: %v", reply.err)
-				return &idlingState{}, nil
-			}
-			st.rsTodo = count
-		}
-		if len(st.resultSet) == st.rsTodo {
-			var published *publishedValue
-			switch len(st.resultSet) {
-			case 3:
-				published = &publishedValue{st.resultSet[2], "*", st.resultSet[1].String()}
-			case 4:
-				published = &publishedValue{st.resultSet[3], st.resultSet[1].String(), st.resultSet[2].String()}
-			default:
-				logger.Errorf("error in published values: %v", st.resultSet)
-				return st, nil
-			}
-			select {
-			case st.request.publishings <- published:
-				// Ok.
-				st.resultSet = ResultSet{}
-				st.rsTodo = -1
-			default:
-				// Not sent, channel is closed and connector not
-				// needed anymore.
-				return nil, nil
-			}
-		}
-	}
-	return st, nil
-}
-
 //--------------------
 // CONNECTOR
 //--------------------
@@ -354,12 +62,13 @@ func (st *subscribedState) handle(cnctr *connector, request *requestEnv, reply *
 type connector struct {
 	configuration *Configuration
 	id            int
-	state         state
+	protocol      *protocol
 	conn          net.Conn
 	requests      chan *requestEnv
 	receiver      *receiver
 	writer        *bufio.Writer
 	loop          loop.Loop
+	done          chan struct{}
 }
 
 // connect establishes a connector to a database based
@@ -371,7 +80,14 @@ func connect(id int, cfg *Configuration) (*connector, error) {
 		// Use faster unix sockets.
 		network = "unix"
 	}
-	conn, err := net.DialTimeout(network, cfg.Address, cfg.Timeout)
+	var conn net.Conn
+	var err error
+	if cfg.TLS != nil && !cfg.UnixSockets {
+		dialer := &net.Dialer{Timeout: cfg.Timeout}
+		conn, err = tls.DialWithDialer(dialer, network, cfg.Address, cfg.TLS)
+	} else {
+		conn, err = net.DialTimeout(network, cfg.Address, cfg.Timeout)
+	}
 	if err != nil {
 		return nil, errors.Annotate(err, ErrConnection, errorMessages)
 	}
@@ -380,11 +96,12 @@ func connect(id int, cfg *Configuration) (*connector, error) {
 	cnctr := &connector{
 		configuration: cfg,
 		id:            id,
-		state:         &idlingState{},
+		protocol:      newProtocol(),
 		conn:          conn,
 		requests:      make(chan *requestEnv),
 		receiver:      newReceiver(id, conn),
 		writer:        bufio.NewWriter(conn),
+		done:          make(chan struct{}),
 	}
 	cnctr.loop = loop.Go(cnctr.backendLoop)
 	// Perform authentication and database selection.
@@ -401,9 +118,23 @@ func connect(id int, cfg *Configuration) (*connector, error) {
 
 // command executes one Redis command and returns
 // the result as result set.
-func (c *connector) command(cmd string, args ...interface{}) (rs ResultSet, err error) {
+func (c *connector) command(cmd string, args ...interface{}) (ResultSet, error) {
+	response := c.execute(cmd, args...)
+	return response.rs, response.err
+}
+
+// commandReply executes one Redis command and returns
+// the complete reply including nested arrays.
+func (c *connector) commandReply(cmd string, args ...interface{}) (*resp.Reply, error) {
+	response := c.execute(cmd, args...)
+	return response.reply, response.err
+}
+
+// execute executes one Redis command and returns
+// the response.
+func (c *connector) execute(cmd string, args ...interface{}) (response *responseEnv) {
 	cmd = strings.ToLower(cmd)
-	defer logCommand(cmd, args, err, c.configuration.LogCommands)
+	defer func() { logCommand(cmd, args, response.err, c.configuration.LogCommands) }()
 
 	if c.configuration.MonitorCommands {
 		m := monitoring.BeginMeasuring(identifier.Identifier("redis", "command", cmd))
@@ -411,33 +142,39 @@ func (c *connector) command(cmd string, args ...interface{}) (rs ResultSet, err
 	}
 
 	request := &requestEnv{cmd, args, make(chan *responseEnv), nil}
-	c.requests <- request
-	response := <-request.responses
-	return response.rs, response.err
+	return c.request(request)
 }
 
 // multiCommand executes a multi command function and returns
-// the result as a slice of result sets.
+// the result as a slice of result sets. If the function fails
+// the queued commands are discarded.
 func (c *connector) multiCommand(f func(MultiCommand) error) (rss ResultSets, err error) {
-	mc, err := newMultiCommand(c)
-	if err != nil {
-		return nil, err
+	mc := newMultiCommand(c)
+	if err = f(mc); err == nil {
+		err = mc.begin()
 	}
-	if err = f(mc); err != nil {
+	if err != nil {
+		mc.Discard()
 		return nil, err
 	}
 	defer logCommand("exec", nil, err, c.configuration.LogCommands)
 
 	request := &requestEnv{"exec", nil, make(chan *responseEnv), nil}
-	c.requests <- request
-	response := <-request.responses
+	response := c.request(request)
 	return response.rss, response.err
 }
 
 // authenticate authenticates against the server if configured.
 func (c *connector) authenticate() error {
 	if c.configuration.Auth != "" {
-		_, err := c.command("auth", c.configuration.Auth)
+		args := []interface{}{c.configuration.Auth}
+		if c.configuration.Username != "" {
+			args = []interface{}{c.configuration.Username, c.configuration.Auth}
+		}
+		reply, err := c.commandReply("auth", args...)
+		if err == nil && reply.Kind == resp.KindError {
+			err = serverError(reply)
+		}
 		if err != nil {
 			c.stop()
 			return err
@@ -458,7 +195,7 @@ func (c *connector) selectDatabase() error {
 
 // subscription subscribes or unsubscribes this connector to a number of
 // channels and returns the number of currently subscribed channels.
-func (c *connector) subscription(publishings chan PublishedValue, cmd string, channels ...string) (count int, err error) {
+func (c *connector) subscription(subscriber *subscription, cmd string, channels ...string) (count int, err error) {
 	cmd = strings.ToLower(cmd)
 	for _, channel := range channels {
 		if containsPattern(channel) {
@@ -474,17 +211,72 @@ func (c *connector) subscription(publishings chan PublishedValue, cmd string, ch
 		defer m.EndMeasuring()
 	}
 
-	request := &requestEnv{cmd, args, make(chan *responseEnv), publishings}
-	c.requests <- request
-	response := <-request.responses
+	request := &requestEnv{cmd, args, make(chan *responseEnv), subscriber}
+	response := c.request(request)
 	if response.err != nil {
 		return -1, response.err
 	}
 	return response.number, nil
 }
 
+// request passes the request to the backend loop and waits
+// for the response. It fails if the connector is stopped.
+func (c *connector) request(request *requestEnv) *responseEnv {
+	select {
+	case c.requests <- request:
+	case <-c.done:
+		return &responseEnv{err: errors.New(ErrConnectorStopped, errorMessages, c.id)}
+	}
+	select {
+	case response := <-request.responses:
+		return response
+	case <-c.done:
+		return &responseEnv{err: errors.New(ErrConnectorStopped, errorMessages, c.id)}
+	}
+}
+
+// isAlive checks if the backend loop of the connector
+// is still working.
+func (c *connector) isAlive() bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// ping checks the connection with a PING. It fails if the
+// connector is stopped or the server doesn't answer in time.
+func (c *connector) ping() bool {
+	// Buffered, so the backend loop doesn't block after
+	// a timeout.
+	request := &requestEnv{"ping", nil, make(chan *responseEnv, 1), nil}
+	timeout := time.After(c.configuration.Timeout)
+	select {
+	case c.requests <- request:
+	case <-c.done:
+		return false
+	case <-timeout:
+		return false
+	}
+	select {
+	case response := <-request.responses:
+		return response.err == nil && response.rs.FirstValue().String() == "PONG"
+	case <-c.done:
+		return false
+	case <-timeout:
+		return false
+	}
+}
+
 // stop closes the connector to the database.
 func (c *connector) stop() error {
+	if !c.isAlive() {
+		// Already stopped after a protocol error.
+		_, err := c.loop.Error()
+		return err
+	}
 	return c.loop.Stop()
 }
 
@@ -502,29 +294,56 @@ func (c *connector) sendCommand(cmd string, args []interface{}) error {
 	return c.writer.Flush()
 }
 
-// backendLoop manages the state and the communication
-// of the connector.
+// backendLoop passes the requests and replies to the
+// protocol and performs the returned transitions.
 func (c *connector) backendLoop(loop loop.Loop) error {
+	defer close(c.done)
 	defer c.receiver.stop()
 	defer c.conn.Close()
 	for {
-		var request *requestEnv
-		var reply *replyEnv
+		var t transition
 		select {
 		case <-loop.ShallStop():
 			return nil
-		case request = <-c.requests:
-		case reply = <-c.receiver.replies:
+		case request := <-c.requests:
+			t = c.protocol.handleRequest(request)
+		case reply := <-c.receiver.replies:
+			t = c.protocol.handleReply(reply)
 		}
-		state, err := c.state.handle(c, request, reply)
-		if err != nil {
+		if ok, err := c.perform(t); !ok {
 			return err
 		}
-		if state == nil {
-			return nil
+	}
+}
+
+// perform performs a transition of the protocol. It returns
+// false if the connector has to be stopped.
+func (c *connector) perform(t transition) (bool, error) {
+	if t.send != nil {
+		if err := c.sendCommand(t.send.command, t.send.arguments); err != nil {
+			err = errors.Annotate(err, ErrCommunication, errorMessages, err)
+			t.send.responses <- &responseEnv{err: err}
+			return false, err
 		}
-		c.state = state
 	}
+	if t.respond != nil {
+		t.respond.responses <- t.response
+	}
+	if t.publish != nil {
+		if !t.subscriber.deliver(t.publish) {
+			// Subscription is closed and connector
+			// not needed anymore.
+			return false, nil
+		}
+	}
+	switch t.recovery {
+	case recoverReset:
+		logger.Warningf("connector %d reset after protocol error in phase %v: %v", c.id, t.from, t.err)
+	case recoverKill:
+		logger.Errorf("connector %d stopped after protocol error in phase %v: %v", c.id, t.from, t.err)
+		return false, t.err
+	}
+	return true, nil
 }
 
 // EOF
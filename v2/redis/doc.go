@@ -7,12 +7,43 @@
 
 // A simple but powerful client for accessing the Redis database.
 //
+// The configuration for Connect() can also be created out of an URL
+// with ParseURL() or out of environment variables with
+// ConfigurationFromEnv(), see the redisurl package.
+//
 // After establishing a connection using Connect() commands can be
 // executed with Command(). So every command of Redis is possible. The method
 // returns a ResultSet with different methods for success testing and access
 // to the retrieved values. The method MultiCommand() can be used for
 // transactions. The passed function gets a MultiCommand instance as
-// argument for calling the inner Command() methods.
+// argument for calling the inner Command() methods. Keys watched with
+// Watch() abort the transaction if they are changed before, this is
+// signalled by a distinct error. Server errors of single commands are
+// returned as CommandErrors together with the result sets of all commands.
+//
+// The values of nested arrays in replies are expanded in order into
+// the ResultSet. CommandReply() returns the complete reply of the
+// resp package instead.
+//
+// Each connector follows the phases of the protocol with the server,
+// like waiting for the reply of a command or for publishings. Requests
+// not allowed in the current phase are rejected. If a reply is invalid
+// the connector continues idling, if the connection is broken or out of
+// sync the connector is stopped and not returned into the pool anymore.
+//
+// Idle connectors in the pool are checked with a PING in the interval
+// configured with HealthCheck. Stopped or unresponsive connectors are
+// replaced by new ones, authentication and database selection are
+// replayed. So the database recovers after a restart of the server.
+//
+// The published values of a subscription are buffered. If the buffer is
+// full the connector waits for the subscriber or drops the oldest or the
+// newest value, see SubscriptionOverflow. Dropped values are counted.
+//
+// Adapt() returns a Database on top of a database of version 3, e.g. to
+// migrate step by step, ConnectAdapted() opens it with a configuration.
+// Commands are executed with the pool of version 3, the replies and errors
+// are converted like those of the connectors.
 package redis
 
 // EOF
@@ -12,7 +12,12 @@ package redis
 //--------------------
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/tideland/goas/v3/errors"
+	"github.com/tideland/godm/v3/resp"
 )
 
 //--------------------
@@ -30,11 +35,20 @@ const (
 	ErrKeyNotFound
 	ErrFuture
 	ErrReply
-	ErrInvalidType
-	ErrInvalidKey
+	_
+	_
 	ErrTimeout
 	ErrInvalidResponse
 	ErrInvalidResultCount
+	ErrConnectorStopped
+	ErrTransactionAborted
+	ErrInvalidRequest
+)
+
+// Error codes of the shared protocol package.
+const (
+	ErrInvalidType = resp.ErrInvalidType
+	ErrInvalidKey  = resp.ErrInvalidKey
 )
 
 var errorMessages = errors.Messages{
@@ -48,11 +62,12 @@ var errorMessages = errors.Messages{
 	ErrKeyNotFound:          "key not found",
 	ErrFuture:               "invalid future result value: %v",
 	ErrReply:                "invalid reply, length is %v",
-	ErrInvalidType:          "invalid type conversion of \"%v\" to %q",
-	ErrInvalidKey:           "invalid key %q",
 	ErrTimeout:              "timeout waiting for the response after command %q",
 	ErrInvalidResponse:      "invalid server response: %v",
 	ErrInvalidResultCount:   "result count does not match: %d <> %d",
+	ErrConnectorStopped:     "connector %d is stopped",
+	ErrTransactionAborted:   "transaction aborted, watched keys have been changed",
+	ErrInvalidRequest:       "invalid request %q",
 }
 
 //--------------------
@@ -74,6 +89,18 @@ func IsConnectionError(err error) bool {
 	return errors.IsError(err, ErrConnection)
 }
 
+// IsUnexpectedRequestError checks for an error when a request is
+// not allowed in the current phase of the connector protocol.
+func IsUnexpectedRequestError(err error) bool {
+	return errors.IsError(err, ErrUnexpectedRequest)
+}
+
+// IsUnexpectedReplyError checks for an error when a reply is
+// not expected in the current phase of the connector protocol.
+func IsUnexpectedReplyError(err error) bool {
+	return errors.IsError(err, ErrUnexpectedReply)
+}
+
 // IsCommunicationError checks for a communication error.
 func IsCommunicationError(err error) bool {
 	return errors.IsError(err, ErrCommunication)
@@ -127,4 +154,52 @@ func IsInvalidResultCountError(err error) bool {
 	return errors.IsError(err, ErrInvalidResultCount)
 }
 
+// IsConnectorStoppedError checks for an error when using a connector
+// stopped after a protocol error.
+func IsConnectorStoppedError(err error) bool {
+	return errors.IsError(err, ErrConnectorStopped)
+}
+
+// IsTransactionAbortedError checks for an aborted transaction
+// after changes of watched keys.
+func IsTransactionAbortedError(err error) bool {
+	return errors.IsError(err, ErrTransactionAborted)
+}
+
+// IsInvalidRequestError checks for an error when a request can't
+// be sent, e.g. due to a wrong number of arguments.
+func IsInvalidRequestError(err error) bool {
+	return errors.IsError(err, ErrInvalidRequest)
+}
+
+// IsCommandErrors checks if the error contains the server errors
+// of single commands of a transaction.
+func IsCommandErrors(err error) bool {
+	_, ok := err.(CommandErrors)
+	return ok
+}
+
+//--------------------
+// COMMAND ERRORS
+//--------------------
+
+// CommandErrors contains the server errors of single commands of
+// a transaction by their index. It's returned together with the
+// result sets of all commands.
+type CommandErrors map[int]error
+
+// Error returns the errors as one string.
+func (ce CommandErrors) Error() string {
+	indexes := []int{}
+	for index := range ce {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	errs := []string{}
+	for _, index := range indexes {
+		errs = append(errs, fmt.Sprintf("command %d: %v", index, ce[index]))
+	}
+	return fmt.Sprintf("%d command(s) of the transaction failed: %s", len(ce), strings.Join(errs, " / "))
+}
+
 // EOF
@@ -0,0 +1,81 @@
+// Tideland Go Data Management - Redis Client - Export Test
+//
+// Copyright (C) 2009-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/godm/v3/resp"
+)
+
+//--------------------
+// EXPORTED PROTOCOL
+//--------------------
+
+// Transition contains the observable parts of a protocol
+// transition. Send and Respond are the commands of the
+// requests, Recovery is "none", "reset", or "kill".
+type Transition struct {
+	From      string
+	To        string
+	Send      string
+	Respond   string
+	Err       error
+	Number    int
+	Published PublishedValue
+	Recovery  string
+}
+
+// Protocol wraps the protocol for tests.
+type Protocol struct {
+	protocol *protocol
+}
+
+func NewProtocol() *Protocol {
+	return &Protocol{newProtocol()}
+}
+
+func (p *Protocol) Phase() string {
+	return p.protocol.phase.String()
+}
+
+func (p *Protocol) Request(cmd string, args ...interface{}) Transition {
+	request := &requestEnv{cmd, args, nil, nil}
+	return exportTransition(p.protocol.handleRequest(request))
+}
+
+func (p *Protocol) Reply(reply *resp.Reply, err error) Transition {
+	return exportTransition(p.protocol.handleReply(&replyEnv{reply, err}))
+}
+
+func exportTransition(t transition) Transition {
+	recoveries := map[recovery]string{
+		recoverNone:  "none",
+		recoverReset: "reset",
+		recoverKill:  "kill",
+	}
+	et := Transition{
+		From:      t.from.String(),
+		To:        t.to.String(),
+		Published: t.publish,
+		Recovery:  recoveries[t.recovery],
+	}
+	if t.send != nil {
+		et.Send = t.send.command
+	}
+	if t.respond != nil {
+		et.Respond = t.respond.command
+		et.Err = t.response.err
+		et.Number = t.response.number
+	}
+	return et
+}
+
+// EOF
@@ -0,0 +1,399 @@
+// Tideland Go Data Management - Redis Client - Protocol
+//
+// Copyright (C) 2009-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tideland/goas/v3/errors"
+	"github.com/tideland/godm/v3/resp"
+)
+
+//--------------------
+// PHASE
+//--------------------
+
+// phase is the phase of the protocol between a connector
+// and the server.
+//
+//	idling       --request-------------> command | exec | subscription
+//	command      --reply---------------> idling
+//	exec         --reply---------------> idling
+//	subscription --last confirmation---> subscribed | idling
+//	subscribed   --(un)subscribe-------> subscription
+//	subscribed   --publishing----------> subscribed
+//
+// Any other request is rejected without changing the phase. An
+// unexpected or broken reply leads to a recovery, see recovery.
+type phase int
+
+const (
+	phaseIdling phase = iota
+	phaseCommand
+	phaseExec
+	phaseSubscription
+	phaseSubscribed
+)
+
+var phaseDescr = map[phase]string{
+	phaseIdling:       "idling",
+	phaseCommand:      "command",
+	phaseExec:         "exec",
+	phaseSubscription: "subscription",
+	phaseSubscribed:   "subscribed",
+}
+
+// String returns the phase as string.
+func (p phase) String() string {
+	if descr, ok := phaseDescr[p]; ok {
+		return descr
+	}
+	return "unknown"
+}
+
+//--------------------
+// TRANSITION
+//--------------------
+
+// recovery tells the connector how to continue after a
+// protocol error.
+type recovery int
+
+const (
+	// recoverNone continues normally.
+	recoverNone recovery = iota
+
+	// recoverReset continues in the idling phase. It's used when
+	// the reply is invalid but complete, so the connection is
+	// still in sync with the server.
+	recoverReset
+
+	// recoverKill stops the connector. It's used when the
+	// connection is broken or out of sync with the server.
+	recoverKill
+)
+
+// transition is the outcome of handling one request or reply.
+// The connector performs the actions in the order of the fields.
+type transition struct {
+	from       phase
+	to         phase
+	send       *requestEnv
+	respond    *requestEnv
+	response   *responseEnv
+	publish    PublishedValue
+	subscriber *subscription
+	recovery   recovery
+	err        error
+}
+
+//--------------------
+// PROTOCOL
+//--------------------
+
+// protocol is the state machine of a connector. It doesn't perform
+// any I/O, it only takes requests and replies and returns the
+// transitions the connector has to perform.
+type protocol struct {
+	phase         phase
+	request       *requestEnv
+	confirmations ResultSets
+	channels      int
+	subscribed    map[string]bool
+	patterns      map[string]bool
+}
+
+// newProtocol creates a protocol in the idling phase.
+func newProtocol() *protocol {
+	return &protocol{
+		phase:      phaseIdling,
+		subscribed: make(map[string]bool),
+		patterns:   make(map[string]bool),
+	}
+}
+
+// handleRequest handles a request of a caller.
+func (p *protocol) handleRequest(request *requestEnv) transition {
+	t := transition{from: p.phase}
+	switch {
+	case p.phase == phaseIdling:
+		switch {
+		case isSubscriptionCommand(request.command):
+			p.subscription()
+		case request.command == "exec":
+			p.phase = phaseExec
+		default:
+			p.phase = phaseCommand
+		}
+		p.request = request
+		t.send = request
+	case p.phase == phaseSubscribed && isSubscriptionCommand(request.command):
+		p.subscription()
+		p.request = request
+		t.send = request
+	default:
+		// Reject the request, the pending one stays active.
+		t.respond = request
+		t.response = &responseEnv{err: errors.New(ErrUnexpectedRequest, errorMessages, request)}
+	}
+	t.to = p.phase
+	return t
+}
+
+// handleReply handles a reply of the server.
+func (p *protocol) handleReply(reply *replyEnv) transition {
+	t := transition{from: p.phase}
+	switch p.phase {
+	case phaseIdling:
+		// No reply expected, so the connection is out of sync.
+		p.recover(&t, recoverKill, errors.New(ErrUnexpectedReply, errorMessages, reply))
+	case phaseCommand:
+		p.commandReply(&t, reply)
+	case phaseExec:
+		p.execReply(&t, reply)
+	case phaseSubscription:
+		p.subscriptionReply(&t, reply)
+	case phaseSubscribed:
+		p.subscribedReply(&t, reply)
+	}
+	t.to = p.phase
+	return t
+}
+
+// reset returns to the idling phase.
+func (p *protocol) reset() {
+	p.phase = phaseIdling
+	p.request = nil
+	p.confirmations = nil
+	p.channels = 0
+	p.subscribed = make(map[string]bool)
+	p.patterns = make(map[string]bool)
+}
+
+// subscription starts waiting for the confirmations of
+// a subscription command.
+func (p *protocol) subscription() {
+	p.phase = phaseSubscription
+	p.confirmations = ResultSets{}
+}
+
+// commandReply handles the reply of a regular command, values
+// of nested arrays are expanded in order.
+func (p *protocol) commandReply(t *transition, reply *replyEnv) {
+	if reply.err != nil {
+		p.recover(t, recoverKill, reply.err)
+		return
+	}
+	t.respond = p.request
+	if rs, err := commandResultSet(p.request.command, reply.reply); err != nil {
+		t.response = &responseEnv{err: err}
+	} else {
+		t.response = &responseEnv{rs: rs, reply: reply.reply}
+	}
+	p.reset()
+}
+
+// execReply handles the reply of an "exec" command, see
+// execResultSets for the conversion.
+func (p *protocol) execReply(t *transition, reply *replyEnv) {
+	if reply.err != nil {
+		p.recover(t, recoverKill, reply.err)
+		return
+	}
+	switch reply.reply.Kind {
+	case resp.KindArray, resp.KindNullArray, resp.KindError:
+		rss, err := execResultSets(reply.reply)
+		t.respond = p.request
+		t.response = &responseEnv{rss: rss, reply: reply.reply, err: err}
+	default:
+		p.recover(t, recoverReset, errors.New(ErrInvalidResponse, errorMessages, reply.reply))
+		return
+	}
+	p.reset()
+}
+
+// subscriptionReply handles the confirmations of a subscription
+// command, one per channel. An unsubscribe without channels ends
+// when no channel of its kind remains, subscriptions of the other
+// kind may stay. Publishings of already subscribed channels may
+// arrive in between.
+func (p *protocol) subscriptionReply(t *transition, reply *replyEnv) {
+	if reply.err != nil {
+		p.recover(t, recoverKill, reply.err)
+		return
+	}
+	if reply.reply.Kind == resp.KindError {
+		// The whole command has been rejected, so the
+		// subscribed channels haven't changed.
+		if p.channels == 0 {
+			p.recover(t, recoverReset, serverError(reply.reply))
+			return
+		}
+		t.respond = p.request
+		t.response = &responseEnv{err: serverError(reply.reply)}
+		p.phase = phaseSubscribed
+		p.confirmations = nil
+		return
+	}
+	rs := ResultSet(reply.reply.Values())
+	if published, ok := publishing(rs); ok {
+		t.publish = published
+		t.subscriber = p.request.subscriber
+		return
+	}
+	if len(rs) < 3 {
+		p.recover(t, recoverKill, errors.New(ErrInvalidResponse, errorMessages, rs))
+		return
+	}
+	count, err := rs[2].Int()
+	if err != nil {
+		p.recover(t, recoverKill, err)
+		return
+	}
+	p.confirm(rs)
+	todo := len(p.request.arguments)
+	if todo == 0 {
+		remaining := p.subscribed
+		if strings.HasPrefix(p.request.command, "p") {
+			remaining = p.patterns
+		}
+		if count > 0 && len(remaining) > 0 {
+			return
+		}
+	} else if len(p.confirmations) < todo {
+		return
+	}
+	t.respond = p.request
+	t.response = &responseEnv{number: count}
+	if count == 0 {
+		// Server left the subscribed mode.
+		p.reset()
+		return
+	}
+	p.phase = phaseSubscribed
+	p.confirmations = nil
+	p.channels = count
+}
+
+// confirm adds a confirmation and updates the subscribed
+// channels and patterns.
+func (p *protocol) confirm(rs ResultSet) {
+	p.confirmations = append(p.confirmations, rs)
+	channel := rs[1].String()
+	switch rs[0].String() {
+	case "subscribe":
+		p.subscribed[channel] = true
+	case "unsubscribe":
+		delete(p.subscribed, channel)
+	case "psubscribe":
+		p.patterns[channel] = true
+	case "punsubscribe":
+		delete(p.patterns, channel)
+	}
+}
+
+// subscribedReply handles the publishings while subscribed.
+func (p *protocol) subscribedReply(t *transition, reply *replyEnv) {
+	if reply.err != nil {
+		p.recover(t, recoverKill, reply.err)
+		return
+	}
+	published, ok := publishing(ResultSet(reply.reply.Values()))
+	if !ok {
+		p.recover(t, recoverKill, errors.New(ErrUnexpectedReply, errorMessages, reply))
+		return
+	}
+	t.publish = published
+	t.subscriber = p.request.subscriber
+}
+
+// recover sets the recovery after a protocol error. A caller
+// waiting for a response gets the error. Subscribers don't wait
+// while subscribed, they only notice the stopped connector.
+func (p *protocol) recover(t *transition, r recovery, err error) {
+	if p.request != nil && p.phase != phaseSubscribed {
+		t.respond = p.request
+		t.response = &responseEnv{err: err}
+	}
+	t.recovery = r
+	t.err = err
+	p.reset()
+}
+
+// isSubscriptionCommand checks if the command is one of the
+// (un)subscribe commands.
+func isSubscriptionCommand(cmd string) bool {
+	return strings.Contains(cmd, "subscribe")
+}
+
+// publishing converts a published message into a published value.
+func publishing(rs ResultSet) (PublishedValue, bool) {
+	switch {
+	case len(rs) == 3 && rs[0].String() == "message":
+		return &publishedValue{rs[2], "*", rs[1].String()}, true
+	case len(rs) == 4 && rs[0].String() == "pmessage":
+		return &publishedValue{rs[3], rs[1].String(), rs[2].String()}, true
+	}
+	return nil, false
+}
+
+// serverError creates the error for an error reply of the server.
+func serverError(reply *resp.Reply) error {
+	return errors.Annotate(fmt.Errorf("%s", reply.Value), ErrServerResponse, errorMessages)
+}
+
+// commandResultSet converts the reply of a regular command, a null
+// bulk reply is a missing key, a null array the timeout of a
+// blocking command.
+func commandResultSet(cmd string, reply *resp.Reply) (ResultSet, error) {
+	switch reply.Kind {
+	case resp.KindNullBulk:
+		return nil, errors.New(ErrKeyNotFound, errorMessages)
+	case resp.KindNullArray:
+		return nil, errors.New(ErrTimeout, errorMessages, cmd)
+	}
+	return ResultSet(reply.Values()), nil
+}
+
+// execResultSets converts the reply of an "exec" command, each
+// element is the result of one command. Server errors of single
+// commands are collected, the other result sets are returned
+// anyway. A null array is an aborted transaction, an error the
+// discarding by the server.
+func execResultSets(reply *resp.Reply) (ResultSets, error) {
+	switch reply.Kind {
+	case resp.KindArray:
+		rss := ResultSets{}
+		failed := CommandErrors{}
+		for i, element := range reply.Elements {
+			if element.Kind == resp.KindError {
+				failed[i] = serverError(element)
+			}
+			rss = append(rss, ResultSet(element.Values()))
+		}
+		if len(failed) > 0 {
+			return rss, failed
+		}
+		return rss, nil
+	case resp.KindNullArray:
+		// Watched keys have been changed.
+		return nil, errors.New(ErrTransactionAborted, errorMessages)
+	case resp.KindError:
+		// Transaction has been discarded by the server,
+		// e.g. after an invalid command.
+		return nil, serverError(reply)
+	}
+	return nil, errors.New(ErrInvalidResponse, errorMessages, reply)
+}
+
+// EOF
@@ -0,0 +1,364 @@
+// Tideland Go Data Management - Redis Client - Protocol Unit Tests
+//
+// Copyright (C) 2009-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/tideland/godm/v2/redis"
+	"github.com/tideland/godm/v3/resp"
+	"github.com/tideland/gots/v3/asserts"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// protocolStep is one request or reply passed to the protocol
+// and the expected transition. isErr checks the error of the
+// response, published is the expected published value.
+type protocolStep struct {
+	request   []interface{}
+	reply     *resp.Reply
+	err       error
+	expected  redis.Transition
+	isErr     func(error) bool
+	published string
+}
+
+// Test the transitions of the connector protocol.
+func TestProtocol(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	broken := errors.New("broken connection")
+	tests := []struct {
+		name  string
+		steps []protocolStep
+	}{{
+		name: "command",
+		steps: []protocolStep{
+			request("idling", "command", "get", "key"),
+			reply(bulk("value"), "command", "idling", "get", "none", nil),
+		},
+	}, {
+		name: "command with server error",
+		steps: []protocolStep{
+			request("idling", "command", "set", "key"),
+			reply(errorReply("ERR wrong number of arguments"), "command", "idling", "set", "none", nil),
+		},
+	}, {
+		name: "command with missing key",
+		steps: []protocolStep{
+			request("idling", "command", "get", "missing"),
+			reply(nullBulk(), "command", "idling", "get", "none", redis.IsKeyNotFoundError),
+		},
+	}, {
+		name: "command with timeout",
+		steps: []protocolStep{
+			request("idling", "command", "blpop", "list", 1),
+			reply(nullArray(), "command", "idling", "blpop", "none", redis.IsTimeoutError),
+		},
+	}, {
+		name: "command with broken connection",
+		steps: []protocolStep{
+			request("idling", "command", "get", "key"),
+			failure(broken, "command", "idling", "get"),
+		},
+	}, {
+		name: "command with unexpected request",
+		steps: []protocolStep{
+			request("idling", "command", "get", "key"),
+			rejected("command", "set", "key", "value"),
+			reply(bulk("value"), "command", "idling", "get", "none", nil),
+		},
+	}, {
+		name: "exec",
+		steps: []protocolStep{
+			request("idling", "exec", "exec"),
+			reply(array(status("OK"), integer("1")), "exec", "idling", "exec", "none", nil),
+		},
+	}, {
+		name: "exec with command errors",
+		steps: []protocolStep{
+			request("idling", "exec", "exec"),
+			reply(array(status("OK"), errorReply("WRONGTYPE")), "exec", "idling", "exec", "none", redis.IsCommandErrors),
+		},
+	}, {
+		name: "exec discarded",
+		steps: []protocolStep{
+			request("idling", "exec", "exec"),
+			reply(errorReply("EXECABORT"), "exec", "idling", "exec", "none", redis.IsServerResponseError),
+		},
+	}, {
+		name: "exec aborted",
+		steps: []protocolStep{
+			request("idling", "exec", "exec"),
+			reply(nullArray(), "exec", "idling", "exec", "none", redis.IsTransactionAbortedError),
+		},
+	}, {
+		name: "exec with invalid response",
+		steps: []protocolStep{
+			request("idling", "exec", "exec"),
+			reply(status("OK"), "exec", "idling", "exec", "reset", redis.IsInvalidResponseError),
+		},
+	}, {
+		name: "exec with broken connection",
+		steps: []protocolStep{
+			request("idling", "exec", "exec"),
+			failure(broken, "exec", "idling", "exec"),
+		},
+	}, {
+		name: "exec with unexpected request",
+		steps: []protocolStep{
+			request("idling", "exec", "exec"),
+			rejected("exec", "get", "key"),
+			reply(array(), "exec", "idling", "exec", "none", nil),
+		},
+	}, {
+		name: "unexpected reply while idling",
+		steps: []protocolStep{
+			reply(status("OK"), "idling", "idling", "", "kill", nil),
+		},
+	}, {
+		name: "subscribe",
+		steps: []protocolStep{
+			request("idling", "subscription", "subscribe", "a", "b"),
+			reply(confirmation("subscribe", "a", 1), "subscription", "subscription", "", "none", nil),
+			subscribed(confirmation("subscribe", "b", 2), "subscription", "subscribe", 2),
+		},
+	}, {
+		name: "subscribe with server error",
+		steps: []protocolStep{
+			request("idling", "subscription", "subscribe", "a"),
+			reply(errorReply("NOAUTH"), "subscription", "idling", "subscribe", "reset", redis.IsServerResponseError),
+		},
+	}, {
+		name: "subscribe with invalid confirmation",
+		steps: []protocolStep{
+			request("idling", "subscription", "subscribe", "a"),
+			reply(array(bulk("subscribe")), "subscription", "idling", "subscribe", "kill", redis.IsInvalidResponseError),
+		},
+	}, {
+		name: "subscribe with broken connection",
+		steps: []protocolStep{
+			request("idling", "subscription", "subscribe", "a"),
+			failure(broken, "subscription", "idling", "subscribe"),
+		},
+	}, {
+		name: "subscribe with unexpected request",
+		steps: []protocolStep{
+			request("idling", "subscription", "subscribe", "a"),
+			rejected("subscription", "get", "key"),
+			subscribed(confirmation("subscribe", "a", 1), "subscription", "subscribe", 1),
+		},
+	}, {
+		name: "publishings",
+		steps: []protocolStep{
+			request("idling", "subscription", "psubscribe", "a*"),
+			subscribed(confirmation("psubscribe", "a*", 1), "subscription", "psubscribe", 1),
+			publishing(array(bulk("pmessage"), bulk("a*"), bulk("ab"), bulk("foo")), "subscribed", "foo"),
+			publishing(array(bulk("pmessage"), bulk("a*"), bulk("ac"), bulk("bar")), "subscribed", "bar"),
+		},
+	}, {
+		name: "subscribe while subscribed",
+		steps: []protocolStep{
+			request("idling", "subscription", "subscribe", "a"),
+			subscribed(confirmation("subscribe", "a", 1), "subscription", "subscribe", 1),
+			request("subscribed", "subscription", "subscribe", "b"),
+			publishing(array(bulk("message"), bulk("a"), bulk("foo")), "subscription", "foo"),
+			subscribed(confirmation("subscribe", "b", 2), "subscription", "subscribe", 2),
+		},
+	}, {
+		name: "subscribe while subscribed with server error",
+		steps: []protocolStep{
+			request("idling", "subscription", "subscribe", "a"),
+			subscribed(confirmation("subscribe", "a", 1), "subscription", "subscribe", 1),
+			request("subscribed", "subscription", "subscribe", "b"),
+			reply(errorReply("ERR"), "subscription", "subscribed", "subscribe", "none", redis.IsServerResponseError),
+		},
+	}, {
+		name: "unsubscribe all",
+		steps: []protocolStep{
+			request("idling", "subscription", "subscribe", "a", "b"),
+			reply(confirmation("subscribe", "a", 1), "subscription", "subscription", "", "none", nil),
+			subscribed(confirmation("subscribe", "b", 2), "subscription", "subscribe", 2),
+			request("subscribed", "subscription", "unsubscribe"),
+			reply(confirmation("unsubscribe", "a", 1), "subscription", "subscription", "", "none", nil),
+			reply(confirmation("unsubscribe", "b", 0), "subscription", "idling", "unsubscribe", "none", nil),
+		},
+	}, {
+		name: "unsubscribe all while patterns remain",
+		steps: []protocolStep{
+			request("idling", "subscription", "subscribe", "a", "b"),
+			reply(confirmation("subscribe", "a", 1), "subscription", "subscription", "", "none", nil),
+			subscribed(confirmation("subscribe", "b", 2), "subscription", "subscribe", 2),
+			request("subscribed", "subscription", "psubscribe", "c*"),
+			subscribed(confirmation("psubscribe", "c*", 3), "subscription", "psubscribe", 3),
+			request("subscribed", "subscription", "unsubscribe"),
+			reply(confirmation("unsubscribe", "a", 2), "subscription", "subscription", "", "none", nil),
+			subscribed(confirmation("unsubscribe", "b", 1), "subscription", "unsubscribe", 1),
+			request("subscribed", "subscription", "punsubscribe"),
+			reply(confirmation("punsubscribe", "c*", 0), "subscription", "idling", "punsubscribe", "none", nil),
+		},
+	}, {
+		name: "unsubscribe all without channels while patterns remain",
+		steps: []protocolStep{
+			request("idling", "subscription", "psubscribe", "c*"),
+			subscribed(confirmation("psubscribe", "c*", 1), "subscription", "psubscribe", 1),
+			request("subscribed", "subscription", "unsubscribe"),
+			subscribed(array(bulk("unsubscribe"), nullBulk(), integer("1")), "subscription", "unsubscribe", 1),
+		},
+	}, {
+		name: "unexpected request while subscribed",
+		steps: []protocolStep{
+			request("idling", "subscription", "subscribe", "a"),
+			subscribed(confirmation("subscribe", "a", 1), "subscription", "subscribe", 1),
+			rejected("subscribed", "get", "key"),
+		},
+	}, {
+		name: "unexpected reply while subscribed",
+		steps: []protocolStep{
+			request("idling", "subscription", "subscribe", "a"),
+			subscribed(confirmation("subscribe", "a", 1), "subscription", "subscribe", 1),
+			reply(status("PONG"), "subscribed", "idling", "", "kill", nil),
+		},
+	}, {
+		name: "broken connection while subscribed",
+		steps: []protocolStep{
+			request("idling", "subscription", "subscribe", "a"),
+			subscribed(confirmation("subscribe", "a", 1), "subscription", "subscribe", 1),
+			failure(broken, "subscribed", "idling", ""),
+		},
+	}}
+	for _, test := range tests {
+		p := redis.NewProtocol()
+		for i, step := range test.steps {
+			msg := fmt.Sprintf("%s / step %d", test.name, i)
+			var transition redis.Transition
+			if step.request != nil {
+				transition = p.Request(step.request[0].(string), step.request[1:]...)
+			} else {
+				transition = p.Reply(step.reply, step.err)
+			}
+			assert.Equal(transition.From, step.expected.From, msg)
+			assert.Equal(transition.To, step.expected.To, msg)
+			assert.Equal(p.Phase(), step.expected.To, msg)
+			assert.Equal(transition.Send, step.expected.Send, msg)
+			assert.Equal(transition.Respond, step.expected.Respond, msg)
+			assert.Equal(transition.Number, step.expected.Number, msg)
+			assert.Equal(transition.Recovery, step.expected.Recovery, msg)
+			switch {
+			case step.isErr != nil:
+				assert.True(step.isErr(transition.Err), msg)
+			case step.err != nil && step.expected.Respond != "":
+				assert.True(redis.IsCommunicationError(transition.Err) || transition.Err == step.err, msg)
+			default:
+				assert.Nil(transition.Err, msg)
+			}
+			if step.published == "" {
+				assert.Nil(transition.Published, msg)
+			} else {
+				assert.Equal(transition.Published.Value().String(), step.published, msg)
+			}
+		}
+	}
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// request creates a step sending a command.
+func request(from, to string, cmd string, args ...interface{}) protocolStep {
+	return protocolStep{
+		request:  append([]interface{}{cmd}, args...),
+		expected: redis.Transition{From: from, To: to, Send: cmd, Recovery: "none"},
+	}
+}
+
+// rejected creates a step with a rejected command.
+func rejected(phase string, cmd string, args ...interface{}) protocolStep {
+	return protocolStep{
+		request:  append([]interface{}{cmd}, args...),
+		expected: redis.Transition{From: phase, To: phase, Respond: cmd, Recovery: "none"},
+		isErr:    redis.IsUnexpectedRequestError,
+	}
+}
+
+// reply creates a step receiving a reply.
+func reply(r *resp.Reply, from, to, respond, recovery string, isErr func(error) bool) protocolStep {
+	return protocolStep{
+		reply:    r,
+		expected: redis.Transition{From: from, To: to, Respond: respond, Recovery: recovery},
+		isErr:    isErr,
+	}
+}
+
+// subscribed creates a step receiving the last confirmation.
+func subscribed(r *resp.Reply, from, respond string, number int) protocolStep {
+	return protocolStep{
+		reply:    r,
+		expected: redis.Transition{From: from, To: "subscribed", Respond: respond, Number: number, Recovery: "none"},
+	}
+}
+
+// publishing creates a step receiving a published value.
+func publishing(r *resp.Reply, phase, published string) protocolStep {
+	return protocolStep{
+		reply:     r,
+		expected:  redis.Transition{From: phase, To: phase, Recovery: "none"},
+		published: published,
+	}
+}
+
+// failure creates a step failing to receive a reply.
+func failure(err error, from, to, respond string) protocolStep {
+	return protocolStep{
+		err:      err,
+		expected: redis.Transition{From: from, To: to, Respond: respond, Recovery: "kill"},
+	}
+}
+
+func status(value string) *resp.Reply {
+	return &resp.Reply{Kind: resp.KindStatus, Value: resp.Value(value)}
+}
+
+func errorReply(value string) *resp.Reply {
+	return &resp.Reply{Kind: resp.KindError, Value: resp.Value(value)}
+}
+
+func integer(value string) *resp.Reply {
+	return &resp.Reply{Kind: resp.KindInteger, Value: resp.Value(value)}
+}
+
+func bulk(value string) *resp.Reply {
+	return &resp.Reply{Kind: resp.KindBulk, Length: len(value), Value: resp.Value(value)}
+}
+
+func nullBulk() *resp.Reply {
+	return &resp.Reply{Kind: resp.KindNullBulk}
+}
+
+func array(elements ...*resp.Reply) *resp.Reply {
+	return &resp.Reply{Kind: resp.KindArray, Length: len(elements), Elements: elements}
+}
+
+func nullArray() *resp.Reply {
+	return &resp.Reply{Kind: resp.KindNullArray}
+}
+
+func confirmation(kind, channel string, count int) *resp.Reply {
+	return array(bulk(kind), bulk(channel), integer(fmt.Sprintf("%d", count)))
+}
+
+// EOF
@@ -12,72 +12,28 @@ package redis
 //--------------------
 
 import (
-	"bufio"
 	"fmt"
 	"net"
-	"strconv"
 
 	"github.com/tideland/goas/v2/loop"
 	"github.com/tideland/goas/v3/errors"
+	"github.com/tideland/godm/v3/resp"
 )
 
 //--------------------
 // ENVELOPE
 //--------------------
 
-// redisReplyKind classifies the reply of redis.
-type redisReplyKind int
-
-const (
-	receivingError redisReplyKind = iota
-	timeoutError
-	statusReply
-	errorReply
-	integerReply
-	bulkReply
-	nullBulkReply
-	multiBulkReply
-)
-
-var redisReplyKindStrings = map[redisReplyKind]string{
-	receivingError: "receiving error",
-	timeoutError:   "timeout error",
-	statusReply:    "status",
-	errorReply:     "error",
-	integerReply:   "integer",
-	bulkReply:      "bulk",
-	nullBulkReply:  "null-bulk",
-	multiBulkReply: "mult-bulk",
-}
-
-// replyEnv encapsulates the Redis reply for further processing.
+// replyEnv encapsulates a complete Redis reply or the
+// error while receiving it for further processing.
 type replyEnv struct {
-	kind redisReplyKind
-	data []byte
-	err  error
-}
-
-// int returns the data interpreted as integer for
-// further operations depending on the kind (e.g.
-// multi-bulk replies).
-func (r *replyEnv) int() (int, error) {
-	return strconv.Atoi(string(r.data))
-}
-
-// value returns the data as value.
-func (r *replyEnv) value() Value {
-	return Value(r.data)
-}
-
-// errorValue returns the error as value.
-func (r *replyEnv) errorValue() Value {
-	errdata := []byte(r.err.Error())
-	return Value(errdata)
+	reply *resp.Reply
+	err   error
 }
 
 // String creates a string representation of the reply.
 func (r *replyEnv) String() string {
-	return fmt.Sprintf("REPLY (K: %s / D: %v / E: %v)", redisReplyKindStrings[r.kind], r.value(), r.err)
+	return fmt.Sprintf("REPLY (R: %v / E: %v)", r.reply, r.err)
 }
 
 //--------------------
@@ -89,7 +45,7 @@ func (r *replyEnv) String() string {
 type receiver struct {
 	id      int
 	conn    net.Conn
-	reader  *bufio.Reader
+	reader  *resp.Reader
 	replies chan *replyEnv
 	loop    loop.Loop
 }
@@ -100,7 +56,7 @@ func newReceiver(id int, conn net.Conn) *receiver {
 	rcvr := &receiver{
 		id:      id,
 		conn:    conn,
-		reader:  bufio.NewReader(conn),
+		reader:  resp.NewReader(conn),
 		replies: make(chan *replyEnv, 25),
 	}
 	rcvr.loop = loop.Go(rcvr.backendLoop)
@@ -123,60 +79,14 @@ func (r *receiver) backendLoop(loop loop.Loop) error {
 	}
 }
 
-// receiveReply receives one reply.
+// receiveReply receives one complete reply including
+// the elements of nested arrays.
 func (r *receiver) receiveReply() *replyEnv {
-	// Receive first line.
-	line, err := r.reader.ReadBytes('\n')
+	reply, err := r.reader.ReadReply()
 	if err != nil {
-		return &replyEnv{receivingError, nil, err}
-	}
-	content := line[1 : len(line)-2]
-	// First byte defines kind.
-	switch line[0] {
-	case '+':
-		// Status reply.
-		return &replyEnv{statusReply, content, nil}
-	case '-':
-		// Error reply.
-		return &replyEnv{errorReply, content, nil}
-	case ':':
-		// Integer reply.
-		return &replyEnv{integerReply, content, nil}
-	case '$':
-		// Bulk reply or null bulk reply.
-		count, err := strconv.Atoi(string(content))
-		if err != nil {
-			return &replyEnv{receivingError, nil, errors.Annotate(err, ErrServerResponse, errorMessages)}
-		}
-		if count == -1 {
-			// Null bulk reply.
-			return &replyEnv{nullBulkReply, nil, errors.New(ErrKeyNotFound, errorMessages)}
-		}
-		// Receive the bulk data.
-		toRead := count + 2
-		buffer := make([]byte, toRead)
-		read := 0
-		for read < toRead {
-			n, err := r.reader.Read(buffer[read:])
-			if err != nil {
-				return &replyEnv{receivingError, nil, err}
-			}
-			read += n
-		}
-		return &replyEnv{bulkReply, buffer[0:count], nil}
-	case '*':
-		// Multi-bulk reply. Check for timeout.
-		count, err := strconv.Atoi(string(content))
-		if err != nil {
-			return &replyEnv{receivingError, nil, errors.Annotate(err, ErrServerResponse, errorMessages)}
-		}
-		if count == -1 {
-			// Timeout.
-			return &replyEnv{timeoutError, nil, nil}
-		}
-		return &replyEnv{multiBulkReply, content, nil}
+		return &replyEnv{nil, errors.Annotate(err, ErrCommunication, errorMessages, err)}
 	}
-	return &replyEnv{receivingError, nil, errors.New(ErrServerResponse, errorMessages, "invalid received data type")}
+	return &replyEnv{reply, nil}
 }
 
 // EOF
@@ -12,17 +12,37 @@ package redis
 //--------------------
 
 import (
+	"crypto/tls"
 	"fmt"
 	"sync"
 	"time"
 
+	"github.com/tideland/goas/v2/logger"
+	"github.com/tideland/goas/v2/loop"
 	"github.com/tideland/goas/v3/errors"
+	"github.com/tideland/godm/v3/resp"
 )
 
 //--------------------
 // CONFIGURATION
 //--------------------
 
+// OverflowPolicy defines what happens if the buffer of a
+// subscription is full when a value is published.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock lets the connector wait until the
+	// subscriber receives the value.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDropOldest drops the oldest buffered value.
+	OverflowDropOldest
+
+	// OverflowDropNewest drops the published value.
+	OverflowDropNewest
+)
+
 // Configuration of a database client.
 type Configuration struct {
 	// Address specifies the IP address and port or the
@@ -47,10 +67,31 @@ type Configuration struct {
 	// to no authentication.
 	Auth string
 
+	// Username is used together with Auth if the server
+	// uses access control lists.
+	Username string
+
+	// TLS has to be set if the TCP connection shall
+	// use TLS.
+	TLS *tls.Config
+
 	// PoolSize defines the number of connectors pooled
 	// for one connected database. Default is 10.
 	PoolSize int
 
+	// SubscriptionBuffer is the size of the buffer for the
+	// published values of a subscription. Default is 100.
+	SubscriptionBuffer int
+
+	// SubscriptionOverflow defines what happens if the buffer
+	// of a subscription is full. Default is OverflowBlock.
+	SubscriptionOverflow OverflowPolicy
+
+	// HealthCheck is the interval of the PING checks of the
+	// idle connectors in the pool. Dead connectors are replaced
+	// by new ones. Default are 30 seconds.
+	HealthCheck time.Duration
+
 	// LogCommands has to be set to true if all commands
 	// shall be logged with info level.
 	LogCommands bool
@@ -86,9 +127,40 @@ func (c *Configuration) check() error {
 	} else if c.PoolSize < 0 {
 		return errors.New(ErrInvalidConfiguration, errorMessages, "pool size", c.PoolSize)
 	}
+	if c.SubscriptionBuffer == 0 {
+		c.SubscriptionBuffer = 100
+	} else if c.SubscriptionBuffer < 0 {
+		return errors.New(ErrInvalidConfiguration, errorMessages, "subscription buffer", c.SubscriptionBuffer)
+	}
+	switch c.SubscriptionOverflow {
+	case OverflowBlock, OverflowDropOldest, OverflowDropNewest:
+	default:
+		return errors.New(ErrInvalidConfiguration, errorMessages, "subscription overflow", c.SubscriptionOverflow)
+	}
+	if c.HealthCheck == 0 {
+		c.HealthCheck = 30 * time.Second
+	} else if c.HealthCheck < 0 {
+		return errors.New(ErrInvalidConfiguration, errorMessages, "health check", c.HealthCheck)
+	}
 	return nil
 }
 
+// prepareConfiguration copies and checks the passed
+// configuration, nil leads to the defaults.
+func prepareConfiguration(c *Configuration) (*Configuration, error) {
+	var cc *Configuration
+	if c == nil {
+		cc = &Configuration{}
+	} else {
+		tmp := *c
+		cc = &tmp
+	}
+	if err := cc.check(); err != nil {
+		return nil, err
+	}
+	return cc, nil
+}
+
 //--------------------
 // DATABASE
 //--------------------
@@ -98,9 +170,14 @@ type Database interface {
 	// Close closes the database.
 	Close()
 
-	// Command performs a Redis command.
+	// Command performs a Redis command. Values of nested
+	// arrays are expanded in order.
 	Command(cmd string, args ...interface{}) (ResultSet, error)
 
+	// CommandReply performs a Redis command and returns the
+	// complete reply, so that nested arrays can be accessed.
+	CommandReply(cmd string, args ...interface{}) (*resp.Reply, error)
+
 	// AsyncCommand performs a Redis command asynchronously.
 	AsyncCommand(cmd string, args ...interface{}) Future
 
@@ -125,31 +202,32 @@ type database struct {
 	configuration *Configuration
 	pool          chan *connector
 	connectorId   int
+	checker       loop.Loop
 }
 
 // Connect connects a Redis database based on the configuration.
 func Connect(c *Configuration) (Database, error) {
-	var cc *Configuration
-	if c == nil {
-		cc = &Configuration{}
-	} else {
-		tmp := *c
-		cc = &tmp
-	}
-	if err := cc.check(); err != nil {
+	cc, err := prepareConfiguration(c)
+	if err != nil {
 		return nil, err
 	}
-	return &database{
+	db := &database{
 		configuration: cc,
 		pool:          make(chan *connector, cc.PoolSize),
-	}, nil
+	}
+	db.checker = loop.Go(db.checkLoop)
+	return db, nil
 }
 
 func (db *database) Close() {
 	db.mux.Lock()
-	defer db.mux.Unlock()
-
+	closed := db.pool == nil
 	db.pool = nil
+	db.mux.Unlock()
+
+	if !closed {
+		db.checker.Stop()
+	}
 }
 
 func (db *database) Command(cmd string, args ...interface{}) (ResultSet, error) {
@@ -161,6 +239,15 @@ func (db *database) Command(cmd string, args ...interface{}) (ResultSet, error)
 	return conn.command(cmd, args...)
 }
 
+func (db *database) CommandReply(cmd string, args ...interface{}) (*resp.Reply, error) {
+	conn, err := db.pullConnector()
+	if err != nil {
+		return nil, err
+	}
+	defer db.pushConnector(conn)
+	return conn.commandReply(cmd, args...)
+}
+
 func (db *database) AsyncCommand(cmd string, args ...interface{}) Future {
 	fut := newFuture()
 	go func() {
@@ -193,7 +280,7 @@ func (db *database) Subscribe(channels ...string) (Subscription, error) {
 	if err != nil {
 		return nil, err
 	}
-	return newSubscription(cnctr, channels...)
+	return newSubscription(cnctr, db.configuration, channels...)
 }
 
 func (db *database) Publish(channel string, message interface{}) (int, error) {
@@ -204,21 +291,29 @@ func (db *database) Publish(channel string, message interface{}) (int, error) {
 	return rs.FirstValue().Int()
 }
 
-// pullConnector pulls a connector out of the pool.
+// pullConnector pulls a connector out of the pool. New
+// connectors are dialed without holding the lock.
 func (db *database) pullConnector() (*connector, error) {
 	db.mux.Lock()
-	defer db.mux.Unlock()
-
 	if db.pool == nil {
+		db.mux.Unlock()
 		return nil, errors.New(ErrDatabaseClosed, errorMessages)
 	}
-
+	var cnctr *connector
 	select {
-	case cnctr := <-db.pool:
+	case cnctr = <-db.pool:
+		db.mux.Unlock()
+		if !cnctr.isAlive() {
+			// Connector has been stopped, e.g. after a
+			// restart of the server.
+			return db.reconnect(cnctr)
+		}
 		return cnctr, nil
 	default:
 		db.connectorId++
-		return connect(db.connectorId, db.configuration)
+		id := db.connectorId
+		db.mux.Unlock()
+		return connect(id, db.configuration)
 	}
 }
 
@@ -230,6 +325,10 @@ func (db *database) pushConnector(cnctr *connector) error {
 	if db.pool == nil {
 		return cnctr.stop()
 	}
+	if !cnctr.isAlive() {
+		// Connector has been stopped after a protocol error.
+		return nil
+	}
 
 	select {
 	case db.pool <- cnctr:
@@ -241,4 +340,56 @@ func (db *database) pushConnector(cnctr *connector) error {
 	}
 }
 
+// reconnect replaces a stopped connector by a new one with the
+// same id. Authentication and database selection are replayed.
+func (db *database) reconnect(cnctr *connector) (*connector, error) {
+	logger.Warningf("reconnecting stopped connector %d", cnctr.id)
+	return connect(cnctr.id, db.configuration)
+}
+
+// checkLoop checks the idle connectors in the configured interval.
+func (db *database) checkLoop(l loop.Loop) error {
+	ticker := time.NewTicker(db.configuration.HealthCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.ShallStop():
+			return nil
+		case <-ticker.C:
+			db.checkConnectors()
+		}
+	}
+}
+
+// checkConnectors pings the idle connectors in the pool. Dead
+// ones are taken out and replaced by new ones if possible.
+func (db *database) checkConnectors() {
+	db.mux.Lock()
+	pool := db.pool
+	db.mux.Unlock()
+
+	if pool == nil {
+		return
+	}
+	for i := len(pool); i > 0; i-- {
+		var cnctr *connector
+		select {
+		case cnctr = <-pool:
+		default:
+			// Pool emptied in the meantime.
+			return
+		}
+		if !cnctr.ping() {
+			cnctr.stop()
+			newCnctr, err := db.reconnect(cnctr)
+			if err != nil {
+				logger.Errorf("cannot reconnect connector %d: %v", cnctr.id, err)
+				continue
+			}
+			cnctr = newCnctr
+		}
+		db.pushConnector(cnctr)
+	}
+}
+
 // EOF
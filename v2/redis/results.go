@@ -12,10 +12,8 @@ package redis
 //--------------------
 
 import (
-	"strconv"
-	"strings"
-
 	"github.com/tideland/goas/v3/errors"
+	"github.com/tideland/godm/v3/resp"
 )
 
 //--------------------
@@ -23,105 +21,17 @@ import (
 //--------------------
 
 // Value is simply a byte slice.
-type Value []byte
-
-// String returns the value as string (alternative to type conversion).
-func (v Value) String() string {
-	if v == nil {
-		return "nil"
-	}
-	return string([]byte(v))
-}
-
-// Bool return the value as bool.
-func (v Value) Bool() (bool, error) {
-	b, err := strconv.ParseBool(v.String())
-	if err != nil {
-		return false, errors.Annotate(err, ErrInvalidType, errorMessages, v.String(), "bool")
-	}
-	return b, nil
-}
-
-// Int returns the value as int.
-func (v Value) Int() (int, error) {
-	i, err := strconv.Atoi(v.String())
-	if err != nil {
-		return 0, errors.Annotate(err, ErrInvalidType, errorMessages, v.String(), "int")
-	}
-	return i, nil
-}
-
-// Int64 returns the value as int64.
-func (v Value) Int64() (int64, error) {
-	i, err := strconv.ParseInt(v.String(), 10, 64)
-	if err != nil {
-		return 0, errors.Annotate(err, ErrInvalidType, errorMessages, v.String(), "int64")
-	}
-	return i, nil
-}
-
-// Uint64 returns the value as uint64.
-func (v Value) Uint64() (uint64, error) {
-	i, err := strconv.ParseUint(v.String(), 10, 64)
-	if err != nil {
-		return 0, errors.Annotate(err, ErrInvalidType, errorMessages, v.String(), "uint64")
-	}
-	return i, nil
-}
-
-// Float64 returns the value as float64.
-func (v Value) Float64() (float64, error) {
-	f, err := strconv.ParseFloat(v.String(), 64)
-	if err != nil {
-		return 0.0, errors.Annotate(err, ErrInvalidType, errorMessages, v.String(), "float64")
-	}
-	return f, nil
-}
-
-// Bytes returns the value as byte slice.
-func (v Value) Bytes() []byte {
-	return []byte(v)
-}
-
-// StringSlice returns the value as slice of strings when seperated by CRLF.
-func (v Value) StringSlice() []string {
-	return strings.Split(v.String(), "\r\n")
-}
-
-// StringMap returns the value as a map of strings when seperated by CRLF
-// and colons between key and value.
-func (v Value) StringMap() map[string]string {
-	tmp := v.StringSlice()
-	m := make(map[string]string, len(tmp))
-	for _, s := range tmp {
-		kv := strings.Split(s, ":")
-		if len(kv) > 1 {
-			m[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
-		}
-	}
-	return m
-}
-
-// Unpack removes the braces of a list value.
-func (v Value) Unpack() Value {
-	if len(v) > 2 && v[0] == '[' && v[len(v)-1] == ']' {
-		return Value(v[1 : len(v)-1])
-	}
-	return v
-}
+type Value = resp.Value
 
 //--------------------
 // KEY/VALUE
 //--------------------
 
 // KeyValue combines a key and a value
-type KeyValue struct {
-	Key   string
-	Value Value
-}
+type KeyValue = resp.KeyValue
 
 // KeyValues is a set of KeyValues.
-type KeyValues []KeyValue
+type KeyValues = resp.KeyValues
 
 //--------------------
 // RESULT SET
@@ -157,7 +67,7 @@ func (rs ResultSet) KeyValues() KeyValues {
 		if idx%2 == 0 {
 			key = value.String()
 		} else {
-			kvs = append(kvs, KeyValue{key, value})
+			kvs = append(kvs, KeyValue{Key: key, Value: value})
 		}
 	}
 	return kvs
@@ -198,45 +108,47 @@ type Future interface {
 
 // future implements Future.
 type future struct {
-	result chan interface{}
+	done   chan struct{}
+	result interface{}
+	err    error
 }
 
 // newFuture creates the new future.
 func newFuture() *future {
-	return &future{make(chan interface{}, 1)}
+	return &future{done: make(chan struct{})}
 }
 
-// setResult sets the result.
+// setResult sets the result. Both are kept, as the result sets
+// of a transaction are returned together with CommandErrors.
 func (f *future) setResult(result interface{}, err error) {
-	if result != nil {
-		f.result <- result
-	} else {
-		f.result <- err
-	}
+	f.result = result
+	f.err = err
+	close(f.done)
 }
 
 // ResultSet returns the result as result set in the moment it is available.
 func (f *future) ResultSet() (ResultSet, error) {
-	result := <-f.result
-	switch typedResult := result.(type) {
-	case ResultSet:
-		return typedResult, nil
-	case error:
-		return nil, typedResult
+	<-f.done
+	if f.err != nil {
+		return nil, f.err
+	}
+	if rs, ok := f.result.(ResultSet); ok {
+		return rs, nil
 	}
-	return nil, errors.New(ErrFuture, errorMessages, result)
+	return nil, errors.New(ErrFuture, errorMessages, f.result)
 }
 
 // ResultSets returns the result as result sets in the moment it is available.
 func (f *future) ResultSets() (ResultSets, error) {
-	result := <-f.result
-	switch typedResult := result.(type) {
-	case ResultSets:
-		return typedResult, nil
-	case error:
-		return nil, typedResult
+	<-f.done
+	rss, ok := f.result.(ResultSets)
+	if f.err != nil {
+		return rss, f.err
 	}
-	return nil, errors.New(ErrFuture, errorMessages, result)
+	if ok {
+		return rss, nil
+	}
+	return nil, errors.New(ErrFuture, errorMessages, f.result)
 }
 
 //--------------------
@@ -245,93 +157,11 @@ func (f *future) ResultSets() (ResultSets, error) {
 
 // Hash maps multiple fields of a hash to the
 // according result values.
-type Hash map[string]Value
+type Hash = resp.Hash
 
 // NewHash creates a new empty hash.
 func NewHash() Hash {
-	return make(Hash)
-}
-
-// Len returns the number of elements in the hash.
-func (h Hash) Len() int {
-	return len(h)
-}
-
-// Set sets a key to the given value.
-func (h Hash) Set(k string, v interface{}) {
-	h[k] = Value(valueToBytes(v))
-}
-
-// String returns the value of a key as string.
-func (h Hash) String(k string) (string, error) {
-	if v, ok := h[k]; ok {
-		return v.String(), nil
-	}
-	return "", errors.New(ErrInvalidKey, errorMessages, k)
-}
-
-// Bool returns the value of a key as bool.
-func (h Hash) Bool(k string) (bool, error) {
-	if v, ok := h[k]; ok {
-		return v.Bool()
-	}
-	return false, errors.New(ErrInvalidKey, errorMessages, k)
-}
-
-// Int returns the value of a key as int.
-func (h Hash) Int(k string) (int, error) {
-	if v, ok := h[k]; ok {
-		return v.Int()
-	}
-	return 0, errors.New(ErrInvalidKey, errorMessages, k)
-}
-
-// Int64 returns the value of a key as int64.
-func (h Hash) Int64(k string) (int64, error) {
-	if v, ok := h[k]; ok {
-		return v.Int64()
-	}
-	return 0, errors.New(ErrInvalidKey, errorMessages, k)
-}
-
-// Uint64 returns the value of a key as uint64.
-func (h Hash) Uint64(k string) (uint64, error) {
-	if v, ok := h[k]; ok {
-		return v.Uint64()
-	}
-	return 0, errors.New(ErrInvalidKey, errorMessages, k)
-}
-
-// Float64 returns the value of a key as float64.
-func (h Hash) Float64(k string) (float64, error) {
-	if v, ok := h[k]; ok {
-		return v.Float64()
-	}
-	return 0.0, errors.New(ErrInvalidKey, errorMessages, k)
-}
-
-// Bytes returns the value of a key as byte slice.
-func (h Hash) Bytes(k string) []byte {
-	if v, ok := h[k]; ok {
-		return v.Bytes()
-	}
-	return []byte{}
-}
-
-// StringSlice returns the value of a key as string slice.
-func (h Hash) StringSlice(k string) []string {
-	if v, ok := h[k]; ok {
-		return v.StringSlice()
-	}
-	return []string{}
-}
-
-// StringMap returns the value of a key as string map.
-func (h Hash) StringMap(k string) map[string]string {
-	if v, ok := h[k]; ok {
-		return v.StringMap()
-	}
-	return map[string]string{}
+	return resp.NewHash()
 }
 
 // Hashable represents types for Redis hashes.
@@ -13,6 +13,7 @@ package redis
 
 import (
 	"sync"
+	"sync/atomic"
 )
 
 //--------------------
@@ -32,32 +33,51 @@ type Subscription interface {
 	ChannelCount() int
 
 	// Publishings returns a channel emitting the published values.
+	// It's buffered with the configured SubscriptionBuffer size.
 	Publishings() <-chan PublishedValue
 
-	// Close ends the subscription.
+	// Dropped returns the number of published values dropped due
+	// to the configured SubscriptionOverflow policy.
+	Dropped() int64
+
+	// Close ends the subscription. A connector blocked by a
+	// full buffer is woken up, the publishings channel is closed.
 	Close() error
 }
 
+// subscriber sends the (un)subscriptions of a subscription and
+// delivers its published values, it's implemented by the connector
+// and the adapter.
+type subscriber interface {
+	subscription(sub *subscription, cmd string, channels ...string) (int, error)
+	stop() error
+}
+
 // Subscription implements the Subscription interface.
 type subscription struct {
 	mux         sync.Mutex
-	cnctr       *connector
+	backend     subscriber
 	count       int
+	overflow    OverflowPolicy
+	dropped     int64
 	publishings chan PublishedValue
+	closing     chan struct{}
+	closeOnce   sync.Once
 }
 
 // newSubscription creates a new subscription.
-func newSubscription(cnctr *connector, channels ...string) (Subscription, error) {
-	publishings := make(chan PublishedValue)
-	count, err := cnctr.subscription(publishings, "subscribe", channels...)
+func newSubscription(backend subscriber, cfg *Configuration, channels ...string) (Subscription, error) {
+	sub := &subscription{
+		backend:     backend,
+		overflow:    cfg.SubscriptionOverflow,
+		publishings: make(chan PublishedValue, cfg.SubscriptionBuffer),
+		closing:     make(chan struct{}),
+	}
+	count, err := backend.subscription(sub, "subscribe", channels...)
 	if err != nil {
 		return nil, err
 	}
-	sub := &subscription{
-		cnctr:       cnctr,
-		count:       count,
-		publishings: publishings,
-	}
+	sub.count = count
 	return sub, nil
 }
 
@@ -65,7 +85,7 @@ func (s *subscription) Subscribe(channels ...string) (int, error) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	count, err := s.cnctr.subscription(s.publishings, "subscribe", channels...)
+	count, err := s.backend.subscription(s, "subscribe", channels...)
 	if err != nil {
 		return count, err
 	}
@@ -77,7 +97,7 @@ func (s *subscription) Unsubscribe(channels ...string) (int, error) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	count, err := s.cnctr.subscription(s.publishings, "unsubscribe", channels...)
+	count, err := s.backend.subscription(s, "unsubscribe", channels...)
 	if err != nil {
 		return count, err
 	}
@@ -96,12 +116,59 @@ func (s *subscription) Publishings() <-chan PublishedValue {
 	return s.publishings
 }
 
+func (s *subscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
 func (s *subscription) Close() error {
-	s.mux.Lock()
-	defer s.mux.Unlock()
+	var err error
+	s.closeOnce.Do(func() {
+		// Wake up a backend blocked by a full buffer
+		// before waiting for its stopping.
+		close(s.closing)
+		err = s.backend.stop()
+		close(s.publishings)
+	})
+	return err
+}
 
-	close(s.publishings)
-	return s.cnctr.stop()
+// deliver passes a published value into the buffer depending on
+// the overflow policy. It returns false if the subscription is closed.
+func (s *subscription) deliver(pv PublishedValue) bool {
+	select {
+	case <-s.closing:
+		return false
+	default:
+	}
+	switch s.overflow {
+	case OverflowDropNewest:
+		select {
+		case s.publishings <- pv:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.publishings <- pv:
+				return true
+			default:
+			}
+			select {
+			case <-s.publishings:
+				atomic.AddInt64(&s.dropped, 1)
+			default:
+				// Emptied by the subscriber in the meantime.
+			}
+		}
+	default:
+		select {
+		case s.publishings <- pv:
+		case <-s.closing:
+			return false
+		}
+	}
+	return true
 }
 
 // EOF
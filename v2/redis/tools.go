@@ -17,6 +17,8 @@ import (
 	"strings"
 
 	"github.com/tideland/goas/v2/logger"
+	"github.com/tideland/goas/v3/errors"
+	"github.com/tideland/godm/v3/resp"
 )
 
 //--------------------
@@ -41,34 +43,10 @@ func join(parts ...interface{}) []byte {
 	return tmp
 }
 
-// valueToBytes converts a value into a byte slice.
+// valueToBytes converts a value into a byte slice, see
+// resp.NewValue() for the encoding.
 func valueToBytes(value interface{}) []byte {
-	switch typedValue := value.(type) {
-	case string:
-		return []byte(typedValue)
-	case []byte:
-		return typedValue
-	case []string:
-		return []byte(strings.Join(typedValue, "\r\n"))
-	case map[string]string:
-		tmp := make([]string, len(typedValue))
-		i := 0
-		for k, v := range typedValue {
-			tmp[i] = fmt.Sprintf("%v:%v", k, v)
-			i++
-		}
-		return []byte(strings.Join(tmp, "\r\n"))
-	case Hash:
-		tmp := []byte{}
-		for k, v := range typedValue {
-			kb := valueToBytes(k)
-			vb := valueToBytes(v)
-			tmp = append(tmp, kb...)
-			tmp = append(tmp, vb...)
-		}
-		return tmp
-	}
-	return []byte(fmt.Sprintf("%v", value))
+	return resp.NewValue(value)
 }
 
 // stringsToInterfaces converts a number of strings into a
@@ -166,51 +144,103 @@ func logCommand(cmd string, args []interface{}, err error, log bool) {
 // MultiCommand enables the user to perform multiple commands
 // in one call.
 type MultiCommand interface {
+	// Watch watches the keys for changes. If one of them is changed
+	// before the execution the transaction is aborted. It has to be
+	// called before the first command.
+	Watch(keys ...string) error
+
 	// Command performs a command inside the transaction.
 	// It will be queued.
 	Command(cmd string, args ...interface{}) error
 
-	// Discard throws all so far queued commands away.
+	// Discard throws all so far queued commands away. The
+	// keys are not watched anymore.
 	Discard() error
 }
 
+// executor performs the commands of a multi command, it's
+// implemented by the connector and the adapter.
+type executor interface {
+	command(cmd string, args ...interface{}) (ResultSet, error)
+	commandReply(cmd string, args ...interface{}) (*resp.Reply, error)
+}
+
 // multiCommand implements the MultiCommand interface.
 type multiCommand struct {
-	cnctr *connector
-	cmds  []string
+	exec    executor
+	watched bool
+	queuing bool
 }
 
 // newMultiCommand creates a new multi command helper.
-func newMultiCommand(cnctr *connector) (*multiCommand, error) {
-	_, err := cnctr.command("multi")
-	if err != nil {
-		return nil, err
-	}
+func newMultiCommand(exec executor) *multiCommand {
 	return &multiCommand{
-		cnctr: cnctr,
-		cmds:  []string{},
-	}, nil
+		exec: exec,
+	}
+}
+
+// Watch watches the keys for changes. If one of them is changed
+// before the execution the transaction is aborted. It has to be
+// called before the first command.
+func (mc *multiCommand) Watch(keys ...string) error {
+	if mc.queuing {
+		return errors.New(ErrUnexpectedRequest, errorMessages, "watch after command")
+	}
+	if _, err := mc.exec.command("watch", stringsToInterfaces(keys...)...); err != nil {
+		return err
+	}
+	mc.watched = true
+	return nil
 }
 
 // Command performs a command inside the transaction. It will
 // be queued.
 func (mc *multiCommand) Command(cmd string, args ...interface{}) error {
-	_, err := mc.cnctr.command(cmd, args...)
+	if err := mc.begin(); err != nil {
+		return err
+	}
+	reply, err := mc.exec.commandReply(cmd, args...)
 	if err != nil {
 		return err
 	}
+	if reply.Kind == resp.KindError {
+		// Not queued, so the execution will fail.
+		return serverError(reply)
+	}
 	return nil
 }
 
-// Discard throws all so far queued commands away.
+// Discard throws all so far queued commands away. The
+// keys are not watched anymore.
 func (mc *multiCommand) Discard() error {
-	// Send the discard command.
-	_, err := mc.cnctr.command("discard")
-	if err != nil {
+	if !mc.queuing {
+		return mc.unwatch()
+	}
+	mc.queuing = false
+	mc.watched = false
+	_, err := mc.exec.command("discard")
+	return err
+}
+
+// begin starts the queuing of commands if not yet done.
+func (mc *multiCommand) begin() error {
+	if mc.queuing {
+		return nil
+	}
+	if _, err := mc.exec.command("multi"); err != nil {
 		return err
 	}
-	// Now send the new multi command again.
-	_, err = mc.cnctr.command("multi")
+	mc.queuing = true
+	return nil
+}
+
+// unwatch stops the watching of keys if needed.
+func (mc *multiCommand) unwatch() error {
+	if !mc.watched {
+		return nil
+	}
+	mc.watched = false
+	_, err := mc.exec.command("unwatch")
 	return err
 }
 
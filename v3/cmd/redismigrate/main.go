@@ -0,0 +1,138 @@
+// Tideland Go Data Management - Redis Migration Tool
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// The redismigrate tool copies keys between Redis databases or
+// exports and imports them using a portable file.
+//
+//	redismigrate -source localhost:6379 -target otherhost:6379 -match "user:*"
+//	redismigrate -source localhost:6379 -export users.dump -match "user:*"
+//	redismigrate -target otherhost:6379 -import users.dump
+package main
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tideland/godm/v3/redis"
+	"github.com/tideland/godm/v3/redis/migrate"
+)
+
+//--------------------
+// FLAGS
+//--------------------
+
+var (
+	sourceAddress  = flag.String("source", "", "address of the source database")
+	sourceIndex    = flag.Int("source-db", 0, "index of the source database")
+	sourcePassword = flag.String("source-auth", "", "password of the source database")
+	targetAddress  = flag.String("target", "", "address of the target database")
+	targetIndex    = flag.Int("target-db", 0, "index of the target database")
+	targetPassword = flag.String("target-auth", "", "password of the target database")
+	match          = flag.String("match", "*", "pattern of the keys to migrate")
+	workers        = flag.Int("workers", 4, "number of concurrent workers")
+	batchSize      = flag.Int("batch", 100, "number of keys per batch")
+	dryRun         = flag.Bool("dry-run", false, "only scan the keys")
+	exportFile     = flag.String("export", "", "export the source database into the file")
+	importFile     = flag.String("import", "", "import the file into the target database")
+)
+
+//--------------------
+// MAIN
+//--------------------
+
+func main() {
+	flag.Parse()
+	opts := []migrate.Option{
+		migrate.Match(*match),
+		migrate.Workers(*workers),
+		migrate.BatchSize(*batchSize),
+		migrate.ReportProgress(func(p migrate.Progress) {
+			fmt.Fprintf(os.Stderr, "\rscanned %d / migrated %d / skipped %d / failed %d",
+				p.Scanned, p.Migrated, p.Skipped, p.Failed)
+		}),
+	}
+	if *dryRun {
+		opts = append(opts, migrate.DryRun())
+	}
+	var progress migrate.Progress
+	var err error
+	switch {
+	case *exportFile != "" && *importFile != "":
+		fail("-export and -import cannot be used together")
+	case *exportFile != "":
+		source := open(*sourceAddress, *sourceIndex, *sourcePassword)
+		defer source.Close()
+		f, ferr := os.Create(*exportFile)
+		if ferr != nil {
+			fail(ferr)
+		}
+		progress, err = migrate.Export(source, f, opts...)
+		if ferr = f.Close(); err == nil {
+			err = ferr
+		}
+	case *importFile != "":
+		target := open(*targetAddress, *targetIndex, *targetPassword)
+		defer target.Close()
+		f, ferr := os.Open(*importFile)
+		if ferr != nil {
+			fail(ferr)
+		}
+		defer f.Close()
+		progress, err = migrate.Import(f, target, opts...)
+	default:
+		source := open(*sourceAddress, *sourceIndex, *sourcePassword)
+		defer source.Close()
+		target := open(*targetAddress, *targetIndex, *targetPassword)
+		defer target.Close()
+		progress, err = migrate.Migrate(source, target, opts...)
+	}
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		fail(err)
+	}
+	if progress.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// open opens the database at the passed address. The pool has
+// one connection per worker and one for scanning the keys.
+func open(address string, index int, password string) *redis.Database {
+	if address == "" {
+		fail("missing database address")
+	}
+	poolSize := 0
+	if *workers > 0 {
+		poolSize = *workers + 1
+	}
+	db, err := redis.Open(
+		redis.TcpConnection(address, 0),
+		redis.Index(index, password),
+		redis.PoolSize(poolSize),
+	)
+	if err != nil {
+		fail(err)
+	}
+	return db
+}
+
+// fail prints the error and exits.
+func fail(v interface{}) {
+	fmt.Fprintln(os.Stderr, "redismigrate:", v)
+	os.Exit(1)
+}
+
+// EOF
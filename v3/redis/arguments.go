@@ -0,0 +1,27 @@
+// Tideland Go Data Management - Redis Client - Arguments
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/godm/v3/resp"
+)
+
+//--------------------
+// ARGUMENT ENCODING
+//--------------------
+
+// ArgEncoder can be implemented by types which shall be passed
+// as command arguments in an own encoding. It takes precedence
+// over all built-in encodings.
+type ArgEncoder = resp.ArgEncoder
+
+// EOF
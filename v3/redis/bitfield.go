@@ -0,0 +1,181 @@
+// Tideland Go Data Management - Redis Client - Bit Field
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"strconv"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// BIT FIELD
+//--------------------
+
+// OverflowPolicy defines the behavior of BITFIELD SET and
+// INCRBY in case of an overflow.
+type OverflowPolicy string
+
+// Overflow policies.
+const (
+	OverflowWrap OverflowPolicy = "wrap"
+	OverflowSat  OverflowPolicy = "sat"
+	OverflowFail OverflowPolicy = "fail"
+)
+
+// BitFieldValue is the result of one operation of a bit field.
+// Failed is true if a SET or INCRBY has not been executed due
+// to the overflow policy FAIL.
+type BitFieldValue struct {
+	Value  int64
+	Failed bool
+}
+
+// BitField builds the operations of a BITFIELD command. The
+// encodings are like "i5" for signed or "u8" for unsigned integers,
+// offsets are bit positions or strings like "#2" for multiples of
+// the encoding width. The first invalid argument is returned when
+// executing it with conn.DoBitField().
+type BitField struct {
+	key      string
+	args     []interface{}
+	readOnly bool
+	err      error
+}
+
+// NewBitField creates a bit field builder for the key.
+func NewBitField(key string) *BitField {
+	return &BitField{
+		key:      key,
+		readOnly: true,
+	}
+}
+
+// Get adds the reading of the integer at the offset.
+func (bf *BitField) Get(encoding string, offset interface{}) *BitField {
+	return bf.add(false, "get", encoding, offset)
+}
+
+// Set adds the setting of the integer at the offset, the result
+// is the old value.
+func (bf *BitField) Set(encoding string, offset interface{}, value int64) *BitField {
+	return bf.add(true, "set", encoding, offset, value)
+}
+
+// IncrBy adds the incrementing of the integer at the offset, the
+// result is the new value.
+func (bf *BitField) IncrBy(encoding string, offset interface{}, increment int64) *BitField {
+	return bf.add(true, "incrby", encoding, offset, increment)
+}
+
+// Overflow sets the overflow policy for the following SET and
+// INCRBY operations.
+func (bf *BitField) Overflow(policy OverflowPolicy) *BitField {
+	switch policy {
+	case OverflowWrap, OverflowSat, OverflowFail:
+		bf.readOnly = false
+		bf.args = append(bf.args, "overflow", string(policy))
+	default:
+		bf.fail(errors.New(ErrInvalidBitField, errorMessages, "overflow policy", policy))
+	}
+	return bf
+}
+
+// add validates and adds one operation.
+func (bf *BitField) add(write bool, op, encoding string, offset interface{}, values ...interface{}) *BitField {
+	if !validBitFieldEncoding(encoding) {
+		return bf.fail(errors.New(ErrInvalidBitField, errorMessages, "encoding", encoding))
+	}
+	switch typedOffset := offset.(type) {
+	case int, int64, uint, uint64:
+	case string:
+		if len(typedOffset) < 2 || typedOffset[0] != '#' {
+			return bf.fail(errors.New(ErrInvalidBitField, errorMessages, "offset", offset))
+		}
+		if _, err := strconv.ParseUint(typedOffset[1:], 10, 64); err != nil {
+			return bf.fail(errors.New(ErrInvalidBitField, errorMessages, "offset", offset))
+		}
+	default:
+		return bf.fail(errors.New(ErrInvalidBitField, errorMessages, "offset", offset))
+	}
+	if write {
+		bf.readOnly = false
+	}
+	bf.args = append(bf.args, op, encoding, offset)
+	bf.args = append(bf.args, values...)
+	return bf
+}
+
+// fail keeps the first error.
+func (bf *BitField) fail(err error) *BitField {
+	if bf.err == nil {
+		bf.err = err
+	}
+	return bf
+}
+
+// validBitFieldEncoding checks if the encoding is a signed integer
+// with up to 64 bits or an unsigned one with up to 63 bits.
+func validBitFieldEncoding(encoding string) bool {
+	if len(encoding) < 2 {
+		return false
+	}
+	bits, err := strconv.Atoi(encoding[1:])
+	if err != nil || bits < 1 {
+		return false
+	}
+	switch encoding[0] {
+	case 'i':
+		return bits <= 64
+	case 'u':
+		return bits <= 63
+	}
+	return false
+}
+
+//--------------------
+// CONNECTION
+//--------------------
+
+// DoBitField executes the operations of the bit field and returns
+// one value per GET, SET, and INCRBY. If all operations are GETs
+// BITFIELD_RO is used, so it may be executed on a replica.
+func (conn *Connection) DoBitField(bf *BitField) ([]BitFieldValue, error) {
+	if bf.err != nil {
+		return nil, bf.err
+	}
+	cmd := "bitfield"
+	if bf.readOnly && len(bf.args) > 0 {
+		cmd = "bitfield_ro"
+	}
+	result, err := conn.Do(cmd, bf.key, bf.args)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]BitFieldValue, result.Len())
+	for i := range values {
+		value, err := result.ValueAt(i)
+		if err != nil {
+			return nil, err
+		}
+		if value.IsNil() {
+			values[i].Failed = true
+			continue
+		}
+		if values[i].Value, err = value.Int64(); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// EOF
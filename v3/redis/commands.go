@@ -0,0 +1,482 @@
+// Tideland Go Data Management - Redis Client - Commands
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//--------------------
+// COMMAND INFO
+//--------------------
+
+// CommandFlags describe the behavior of a command.
+type CommandFlags int
+
+// Flags of commands.
+const (
+	FlagReadOnly CommandFlags = 1 << iota
+	FlagWrite
+	FlagBlocking
+	FlagPubSub
+	FlagAdmin
+	FlagMovableKeys
+	FlagSubscribe
+)
+
+// commandFlagNames maps the flag names returned by
+// COMMAND INFO to the flags.
+var commandFlagNames = map[string]CommandFlags{
+	"readonly":    FlagReadOnly,
+	"write":       FlagWrite,
+	"blocking":    FlagBlocking,
+	"pubsub":      FlagPubSub,
+	"admin":       FlagAdmin,
+	"movablekeys": FlagMovableKeys,
+}
+
+// CommandInfo describes a command like COMMAND INFO does. The
+// arity is the number of arguments including the command name,
+// a negative arity means at least that number. The positions
+// of the keys follow the same counting, negative last key
+// positions are counted from the end of the arguments.
+type CommandInfo struct {
+	Name     string
+	Arity    int
+	Flags    CommandFlags
+	FirstKey int
+	LastKey  int
+	KeyStep  int
+}
+
+// Is checks if the command has all the passed flags.
+func (ci CommandInfo) Is(flags CommandFlags) bool {
+	return ci.Flags&flags == flags
+}
+
+// CheckArity checks if the number of arguments, not including
+// the command name, matches the arity of the command.
+func (ci CommandInfo) CheckArity(n int) bool {
+	if ci.Arity < 0 {
+		return n+1 >= -ci.Arity
+	}
+	return n+1 == ci.Arity
+}
+
+// Keys returns the keys out of the arguments of the command,
+// they are expanded like when sending the command before. Commands
+// with movable keys like EVAL, ZUNIONSTORE, or XREAD are
+// handled too.
+func (ci CommandInfo) Keys(args ...interface{}) []string {
+	args = expandArguments(args)
+	keys := []string{}
+	key := func(index int) {
+		if index >= 0 && index < len(args) {
+			keys = append(keys, string(valueToBytes(args[index])))
+		}
+	}
+	// Commands with movable keys.
+	switch ci.Name {
+	case "eval", "evalsha", "eval_ro", "evalsha_ro", "fcall", "fcall_ro":
+		// Script, number of keys, keys.
+		n := argumentInt(args, 1)
+		for i := 0; i < n; i++ {
+			key(2 + i)
+		}
+		return keys
+	case "zinterstore", "zunionstore", "zdiffstore":
+		// Destination, number of keys, keys.
+		key(0)
+		n := argumentInt(args, 1)
+		for i := 0; i < n; i++ {
+			key(2 + i)
+		}
+		return keys
+	case "zinter", "zunion", "zdiff":
+		// Number of keys, keys.
+		n := argumentInt(args, 0)
+		for i := 0; i < n; i++ {
+			key(1 + i)
+		}
+		return keys
+	case "xread", "xreadgroup":
+		// Keys are the first half after STREAMS.
+		for i, arg := range args {
+			if strings.ToLower(string(valueToBytes(arg))) == "streams" {
+				n := (len(args) - i - 1) / 2
+				for j := 0; j < n; j++ {
+					key(i + 1 + j)
+				}
+				break
+			}
+		}
+		return keys
+	}
+	// Commands with fixed key positions.
+	if ci.FirstKey <= 0 || ci.KeyStep <= 0 {
+		return keys
+	}
+	last := ci.LastKey
+	if last < 0 {
+		last = len(args) + 1 + last
+	}
+	for position := ci.FirstKey; position <= last; position += ci.KeyStep {
+		key(position - 1)
+	}
+	return keys
+}
+
+// blockingTimeout returns the timeout passed to a blocking command.
+// It's the BLOCK option in milliseconds for XREAD and XREADGROUP and
+// the last argument in seconds for all others. A zero timeout means
+// blocking forever.
+func (ci CommandInfo) blockingTimeout(args []interface{}) time.Duration {
+	args = expandArguments(args)
+	switch ci.Name {
+	case "xread", "xreadgroup":
+		for i, arg := range args {
+			if strings.ToLower(string(valueToBytes(arg))) == "block" {
+				return time.Duration(argumentInt(args, i+1)) * time.Millisecond
+			}
+		}
+		return 0
+	}
+	if len(args) == 0 {
+		return 0
+	}
+	seconds, err := strconv.ParseFloat(string(valueToBytes(args[len(args)-1])), 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// argumentInt returns the argument at index as int or 0.
+func argumentInt(args []interface{}, index int) int {
+	if index >= len(args) {
+		return 0
+	}
+	i, err := strconv.Atoi(string(valueToBytes(args[index])))
+	if err != nil {
+		return 0
+	}
+	return i
+}
+
+//--------------------
+// COMMAND TABLE
+//--------------------
+
+// commandTable contains the infos of the known commands.
+type commandTable struct {
+	mux      sync.RWMutex
+	commands map[string]CommandInfo
+}
+
+// newCommandTable creates a command table with the built-in
+// command infos.
+func newCommandTable() *commandTable {
+	ct := &commandTable{
+		commands: make(map[string]CommandInfo, len(builtinCommands)),
+	}
+	for _, ci := range builtinCommands {
+		ct.commands[ci.Name] = ci
+	}
+	return ct
+}
+
+// lookup returns the info for the command.
+func (ct *commandTable) lookup(cmd string) (CommandInfo, bool) {
+	ct.mux.RLock()
+	defer ct.mux.RUnlock()
+	ci, ok := ct.commands[cmd]
+	return ci, ok
+}
+
+// is checks if the command is known and has the flags.
+func (ct *commandTable) is(cmd string, flags CommandFlags) bool {
+	ci, ok := ct.lookup(cmd)
+	return ok && ci.Is(flags)
+}
+
+// update sets the passed command infos. The flags for blocking
+// and subscribing commands are kept, as older servers don't
+// return them.
+func (ct *commandTable) update(cis []CommandInfo) {
+	ct.mux.Lock()
+	defer ct.mux.Unlock()
+	for _, ci := range cis {
+		if old, ok := ct.commands[ci.Name]; ok {
+			ci.Flags |= old.Flags & (FlagBlocking | FlagSubscribe)
+		}
+		ct.commands[ci.Name] = ci
+	}
+}
+
+// parseCommandInfos parses the result of COMMAND or COMMAND INFO.
+func parseCommandInfos(result *ResultSet) ([]CommandInfo, error) {
+	cis := []CommandInfo{}
+	for index := 0; index < result.Len(); index++ {
+		item, err := result.ResultSetAt(index)
+		if err != nil {
+			// Unknown commands are returned as nil.
+			continue
+		}
+		var ci CommandInfo
+		var flags []string
+		err = item.Scan(&ci.Name, &ci.Arity, &flags, &ci.FirstKey, &ci.LastKey, &ci.KeyStep)
+		if err != nil {
+			return nil, err
+		}
+		ci.Name = strings.ToLower(ci.Name)
+		for _, flag := range flags {
+			ci.Flags |= commandFlagNames[strings.TrimPrefix(flag, "+")]
+		}
+		cis = append(cis, ci)
+	}
+	return cis, nil
+}
+
+//--------------------
+// BUILT-IN COMMANDS
+//--------------------
+
+// builtinCommands contains the infos of the commonly used
+// commands. It can be updated using conn.RefreshCommands().
+var builtinCommands = []CommandInfo{
+	// Connection.
+	{"auth", -2, 0, 0, 0, 0},
+	{"echo", 2, 0, 0, 0, 0},
+	{"hello", -1, 0, 0, 0, 0},
+	{"ping", -1, 0, 0, 0, 0},
+	{"quit", -1, 0, 0, 0, 0},
+	{"select", 2, 0, 0, 0, 0},
+	// Keys.
+	{"copy", -3, FlagWrite, 1, 2, 1},
+	{"del", -2, FlagWrite, 1, -1, 1},
+	{"dump", 2, FlagReadOnly, 1, 1, 1},
+	{"exists", -2, FlagReadOnly, 1, -1, 1},
+	{"expire", -3, FlagWrite, 1, 1, 1},
+	{"expireat", -3, FlagWrite, 1, 1, 1},
+	{"keys", 2, FlagReadOnly, 0, 0, 0},
+	{"migrate", -6, FlagWrite | FlagMovableKeys, 3, 3, 1},
+	{"move", 3, FlagWrite, 1, 1, 1},
+	{"object", -2, FlagReadOnly, 2, 2, 1},
+	{"persist", 2, FlagWrite, 1, 1, 1},
+	{"pexpire", -3, FlagWrite, 1, 1, 1},
+	{"pexpireat", -3, FlagWrite, 1, 1, 1},
+	{"pttl", 2, FlagReadOnly, 1, 1, 1},
+	{"randomkey", 1, FlagReadOnly, 0, 0, 0},
+	{"rename", 3, FlagWrite, 1, 2, 1},
+	{"renamenx", 3, FlagWrite, 1, 2, 1},
+	{"restore", -4, FlagWrite, 1, 1, 1},
+	{"scan", -2, FlagReadOnly, 0, 0, 0},
+	{"sort", -2, FlagWrite | FlagMovableKeys, 1, 1, 1},
+	{"touch", -2, FlagReadOnly, 1, -1, 1},
+	{"ttl", 2, FlagReadOnly, 1, 1, 1},
+	{"type", 2, FlagReadOnly, 1, 1, 1},
+	{"unlink", -2, FlagWrite, 1, -1, 1},
+	// Strings.
+	{"append", 3, FlagWrite, 1, 1, 1},
+	{"bitcount", -2, FlagReadOnly, 1, 1, 1},
+	{"bitfield", -2, FlagWrite, 1, 1, 1},
+	{"bitfield_ro", -2, FlagReadOnly, 1, 1, 1},
+	{"bitop", -4, FlagWrite, 2, -1, 1},
+	{"bitpos", -3, FlagReadOnly, 1, 1, 1},
+	{"decr", 2, FlagWrite, 1, 1, 1},
+	{"decrby", 3, FlagWrite, 1, 1, 1},
+	{"get", 2, FlagReadOnly, 1, 1, 1},
+	{"getbit", 3, FlagReadOnly, 1, 1, 1},
+	{"getdel", 2, FlagWrite, 1, 1, 1},
+	{"getex", -2, FlagWrite, 1, 1, 1},
+	{"getrange", 4, FlagReadOnly, 1, 1, 1},
+	{"getset", 3, FlagWrite, 1, 1, 1},
+	{"incr", 2, FlagWrite, 1, 1, 1},
+	{"incrby", 3, FlagWrite, 1, 1, 1},
+	{"incrbyfloat", 3, FlagWrite, 1, 1, 1},
+	{"mget", -2, FlagReadOnly, 1, -1, 1},
+	{"mset", -3, FlagWrite, 1, -1, 2},
+	{"msetnx", -3, FlagWrite, 1, -1, 2},
+	{"psetex", 4, FlagWrite, 1, 1, 1},
+	{"set", -3, FlagWrite, 1, 1, 1},
+	{"setbit", 4, FlagWrite, 1, 1, 1},
+	{"setex", 4, FlagWrite, 1, 1, 1},
+	{"setnx", 3, FlagWrite, 1, 1, 1},
+	{"setrange", 4, FlagWrite, 1, 1, 1},
+	{"strlen", 2, FlagReadOnly, 1, 1, 1},
+	// Hashes.
+	{"hdel", -3, FlagWrite, 1, 1, 1},
+	{"hexists", 3, FlagReadOnly, 1, 1, 1},
+	{"hget", 3, FlagReadOnly, 1, 1, 1},
+	{"hgetall", 2, FlagReadOnly, 1, 1, 1},
+	{"hincrby", 4, FlagWrite, 1, 1, 1},
+	{"hincrbyfloat", 4, FlagWrite, 1, 1, 1},
+	{"hkeys", 2, FlagReadOnly, 1, 1, 1},
+	{"hlen", 2, FlagReadOnly, 1, 1, 1},
+	{"hmget", -3, FlagReadOnly, 1, 1, 1},
+	{"hmset", -4, FlagWrite, 1, 1, 1},
+	{"hrandfield", -2, FlagReadOnly, 1, 1, 1},
+	{"hscan", -3, FlagReadOnly, 1, 1, 1},
+	{"hset", -4, FlagWrite, 1, 1, 1},
+	{"hsetnx", 4, FlagWrite, 1, 1, 1},
+	{"hstrlen", 3, FlagReadOnly, 1, 1, 1},
+	{"hvals", 2, FlagReadOnly, 1, 1, 1},
+	// Lists.
+	{"blmove", 6, FlagWrite | FlagBlocking, 1, 2, 1},
+	{"blpop", -3, FlagWrite | FlagBlocking, 1, -2, 1},
+	{"brpop", -3, FlagWrite | FlagBlocking, 1, -2, 1},
+	{"brpoplpush", 4, FlagWrite | FlagBlocking, 1, 2, 1},
+	{"lindex", 3, FlagReadOnly, 1, 1, 1},
+	{"linsert", 5, FlagWrite, 1, 1, 1},
+	{"llen", 2, FlagReadOnly, 1, 1, 1},
+	{"lmove", 5, FlagWrite, 1, 2, 1},
+	{"lpop", -2, FlagWrite, 1, 1, 1},
+	{"lpos", -3, FlagReadOnly, 1, 1, 1},
+	{"lpush", -3, FlagWrite, 1, 1, 1},
+	{"lpushx", -3, FlagWrite, 1, 1, 1},
+	{"lrange", 4, FlagReadOnly, 1, 1, 1},
+	{"lrem", 4, FlagWrite, 1, 1, 1},
+	{"lset", 4, FlagWrite, 1, 1, 1},
+	{"ltrim", 4, FlagWrite, 1, 1, 1},
+	{"rpop", -2, FlagWrite, 1, 1, 1},
+	{"rpoplpush", 3, FlagWrite, 1, 2, 1},
+	{"rpush", -3, FlagWrite, 1, 1, 1},
+	{"rpushx", -3, FlagWrite, 1, 1, 1},
+	// Sets.
+	{"sadd", -3, FlagWrite, 1, 1, 1},
+	{"scard", 2, FlagReadOnly, 1, 1, 1},
+	{"sdiff", -2, FlagReadOnly, 1, -1, 1},
+	{"sdiffstore", -3, FlagWrite, 1, -1, 1},
+	{"sinter", -2, FlagReadOnly, 1, -1, 1},
+	{"sinterstore", -3, FlagWrite, 1, -1, 1},
+	{"sismember", 3, FlagReadOnly, 1, 1, 1},
+	{"smembers", 2, FlagReadOnly, 1, 1, 1},
+	{"smismember", -3, FlagReadOnly, 1, 1, 1},
+	{"smove", 4, FlagWrite, 1, 2, 1},
+	{"spop", -2, FlagWrite, 1, 1, 1},
+	{"srandmember", -2, FlagReadOnly, 1, 1, 1},
+	{"srem", -3, FlagWrite, 1, 1, 1},
+	{"sscan", -3, FlagReadOnly, 1, 1, 1},
+	{"sunion", -2, FlagReadOnly, 1, -1, 1},
+	{"sunionstore", -3, FlagWrite, 1, -1, 1},
+	// Sorted sets.
+	{"bzpopmax", -3, FlagWrite | FlagBlocking, 1, -2, 1},
+	{"bzpopmin", -3, FlagWrite | FlagBlocking, 1, -2, 1},
+	{"zadd", -4, FlagWrite, 1, 1, 1},
+	{"zcard", 2, FlagReadOnly, 1, 1, 1},
+	{"zcount", 4, FlagReadOnly, 1, 1, 1},
+	{"zdiff", -3, FlagReadOnly | FlagMovableKeys, 0, 0, 0},
+	{"zdiffstore", -4, FlagWrite | FlagMovableKeys, 1, 1, 1},
+	{"zincrby", 4, FlagWrite, 1, 1, 1},
+	{"zinter", -3, FlagReadOnly | FlagMovableKeys, 0, 0, 0},
+	{"zinterstore", -4, FlagWrite | FlagMovableKeys, 1, 1, 1},
+	{"zlexcount", 4, FlagReadOnly, 1, 1, 1},
+	{"zmscore", -3, FlagReadOnly, 1, 1, 1},
+	{"zpopmax", -2, FlagWrite, 1, 1, 1},
+	{"zpopmin", -2, FlagWrite, 1, 1, 1},
+	{"zrange", -4, FlagReadOnly, 1, 1, 1},
+	{"zrangebylex", -4, FlagReadOnly, 1, 1, 1},
+	{"zrangebyscore", -4, FlagReadOnly, 1, 1, 1},
+	{"zrank", -3, FlagReadOnly, 1, 1, 1},
+	{"zrem", -3, FlagWrite, 1, 1, 1},
+	{"zremrangebylex", 4, FlagWrite, 1, 1, 1},
+	{"zremrangebyrank", 4, FlagWrite, 1, 1, 1},
+	{"zremrangebyscore", 4, FlagWrite, 1, 1, 1},
+	{"zrevrange", -4, FlagReadOnly, 1, 1, 1},
+	{"zrevrangebylex", -4, FlagReadOnly, 1, 1, 1},
+	{"zrevrangebyscore", -4, FlagReadOnly, 1, 1, 1},
+	{"zrevrank", -3, FlagReadOnly, 1, 1, 1},
+	{"zscan", -3, FlagReadOnly, 1, 1, 1},
+	{"zscore", 3, FlagReadOnly, 1, 1, 1},
+	{"zunion", -3, FlagReadOnly | FlagMovableKeys, 0, 0, 0},
+	{"zunionstore", -4, FlagWrite | FlagMovableKeys, 1, 1, 1},
+	// HyperLogLogs.
+	{"pfadd", -2, FlagWrite, 1, 1, 1},
+	{"pfcount", -2, FlagReadOnly, 1, -1, 1},
+	{"pfmerge", -2, FlagWrite, 1, -1, 1},
+	// Geo.
+	{"geoadd", -5, FlagWrite, 1, 1, 1},
+	{"geodist", -4, FlagReadOnly, 1, 1, 1},
+	{"geohash", -2, FlagReadOnly, 1, 1, 1},
+	{"geopos", -2, FlagReadOnly, 1, 1, 1},
+	{"georadius", -6, FlagWrite | FlagMovableKeys, 1, 1, 1},
+	{"georadius_ro", -6, FlagReadOnly, 1, 1, 1},
+	{"georadiusbymember", -5, FlagWrite | FlagMovableKeys, 1, 1, 1},
+	{"georadiusbymember_ro", -5, FlagReadOnly, 1, 1, 1},
+	{"geosearch", -7, FlagReadOnly, 1, 1, 1},
+	{"geosearchstore", -8, FlagWrite, 1, 2, 1},
+	// Streams.
+	{"xack", -4, FlagWrite, 1, 1, 1},
+	{"xadd", -5, FlagWrite, 1, 1, 1},
+	{"xclaim", -6, FlagWrite, 1, 1, 1},
+	{"xdel", -3, FlagWrite, 1, 1, 1},
+	{"xgroup", -2, FlagWrite, 2, 2, 1},
+	{"xinfo", -2, FlagReadOnly, 2, 2, 1},
+	{"xlen", 2, FlagReadOnly, 1, 1, 1},
+	{"xpending", -3, FlagReadOnly, 1, 1, 1},
+	{"xrange", -4, FlagReadOnly, 1, 1, 1},
+	{"xread", -4, FlagReadOnly | FlagBlocking | FlagMovableKeys, 0, 0, 0},
+	{"xreadgroup", -7, FlagWrite | FlagBlocking | FlagMovableKeys, 0, 0, 0},
+	{"xrevrange", -4, FlagReadOnly, 1, 1, 1},
+	{"xtrim", -4, FlagWrite, 1, 1, 1},
+	// Pub/Sub.
+	{"psubscribe", -2, FlagPubSub | FlagSubscribe, 0, 0, 0},
+	{"publish", 3, FlagPubSub, 0, 0, 0},
+	{"pubsub", -2, FlagPubSub, 0, 0, 0},
+	{"punsubscribe", -1, FlagPubSub | FlagSubscribe, 0, 0, 0},
+	{"spublish", 3, FlagPubSub, 1, 1, 1},
+	{"ssubscribe", -2, FlagPubSub | FlagSubscribe, 1, -1, 1},
+	{"subscribe", -2, FlagPubSub | FlagSubscribe, 0, 0, 0},
+	{"sunsubscribe", -1, FlagPubSub | FlagSubscribe, 1, -1, 1},
+	{"unsubscribe", -1, FlagPubSub | FlagSubscribe, 0, 0, 0},
+	// Scripting and functions.
+	{"eval", -3, FlagMovableKeys, 0, 0, 0},
+	{"eval_ro", -3, FlagReadOnly | FlagMovableKeys, 0, 0, 0},
+	{"evalsha", -3, FlagMovableKeys, 0, 0, 0},
+	{"evalsha_ro", -3, FlagReadOnly | FlagMovableKeys, 0, 0, 0},
+	{"fcall", -3, FlagMovableKeys, 0, 0, 0},
+	{"fcall_ro", -3, FlagReadOnly | FlagMovableKeys, 0, 0, 0},
+	{"function", -2, 0, 0, 0, 0},
+	{"script", -2, 0, 0, 0, 0},
+	// Transactions.
+	{"discard", 1, 0, 0, 0, 0},
+	{"exec", 1, 0, 0, 0, 0},
+	{"multi", 1, 0, 0, 0, 0},
+	{"unwatch", 1, 0, 0, 0, 0},
+	{"watch", -2, 0, 1, -1, 1},
+	// Server.
+	{"bgrewriteaof", 1, FlagAdmin, 0, 0, 0},
+	{"bgsave", -1, FlagAdmin, 0, 0, 0},
+	{"client", -2, FlagAdmin, 0, 0, 0},
+	{"command", -1, 0, 0, 0, 0},
+	{"config", -2, FlagAdmin, 0, 0, 0},
+	{"dbsize", 1, FlagReadOnly, 0, 0, 0},
+	{"debug", -2, FlagAdmin, 0, 0, 0},
+	{"flushall", -1, FlagWrite, 0, 0, 0},
+	{"flushdb", -1, FlagWrite, 0, 0, 0},
+	{"info", -1, 0, 0, 0, 0},
+	{"lastsave", 1, 0, 0, 0, 0},
+	{"monitor", 1, FlagAdmin, 0, 0, 0},
+	{"replicaof", 3, FlagAdmin, 0, 0, 0},
+	{"role", 1, 0, 0, 0, 0},
+	{"save", 1, FlagAdmin, 0, 0, 0},
+	{"shutdown", -1, FlagAdmin, 0, 0, 0},
+	{"slaveof", 3, FlagAdmin, 0, 0, 0},
+	{"slowlog", -2, FlagAdmin, 0, 0, 0},
+	{"time", 1, 0, 0, 0, 0},
+	{"wait", 3, 0, 0, 0, 0},
+}
+
+// EOF
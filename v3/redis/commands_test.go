@@ -12,6 +12,9 @@ package redis_test
 //--------------------
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"testing"
 	"time"
 
@@ -24,6 +27,76 @@ import (
 // TESTS
 //--------------------
 
+// testEncoder encodes itself in angle brackets.
+type testEncoder string
+
+func (te testEncoder) EncodeArg() ([]byte, error) {
+	if te == "" {
+		return nil, fmt.Errorf("empty test encoder")
+	}
+	return []byte("<" + te + ">"), nil
+}
+
+// flakyEncoder fails when encoding the second time, i.e.
+// when writing the command after checking it.
+type flakyEncoder struct {
+	calls int
+}
+
+func (fe *flakyEncoder) EncodeArg() ([]byte, error) {
+	fe.calls++
+	if fe.calls > 1 {
+		return nil, fmt.Errorf("flaky test encoder")
+	}
+	return []byte("flaky"), nil
+}
+
+func TestCommandWriting(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	var buf bytes.Buffer
+	send := redis.NewCommandWriter(&buf)
+
+	err := send("rpush", "list", []interface{}{"a", 1}, redis.Values{redis.Value("b")})
+	assert.Nil(err)
+	assert.Equal(buf.String(), "*5\r\n$5\r\nrpush\r\n$4\r\nlist\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n")
+
+	// Failing encoders inside of containers are detected
+	// before writing.
+	buf.Reset()
+	err = send("rpush", "list", []interface{}{"a", testEncoder("")})
+	assert.True(errors.IsError(err, redis.ErrEncodeArgument))
+	err = send("rpush", "list", []redis.ArgEncoder{testEncoder("a"), testEncoder("")})
+	assert.True(errors.IsError(err, redis.ErrEncodeArgument))
+	assert.Equal(buf.Len(), 0)
+
+	// Failing while writing breaks the connection.
+	err = send("rpush", "list", []interface{}{&flakyEncoder{}})
+	assert.True(errors.IsError(err, redis.ErrConnectionBroken))
+}
+
+func TestArgumentExpansion(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	// Keys are found in arguments expanded like when sending.
+	ci, ok := redis.LookupCommand("del")
+	assert.True(ok)
+	assert.Equal(ci.Keys([]int{1, 2}, redis.Values{redis.Value("c")}), []string{"1", "2", "c"})
+	ci, ok = redis.LookupCommand("mset")
+	assert.True(ok)
+	assert.Equal(ci.Keys(map[string]string{"a": "1"}, [][]byte{[]byte("b"), []byte("2")}), []string{"a", "b"})
+	ci, ok = redis.LookupCommand("eval")
+	assert.True(ok)
+	assert.Equal(ci.Keys("return 1", []interface{}{2, []string{"a", "b"}}, "x"), []string{"a", "b"})
+
+	// Timeouts too.
+	ci, ok = redis.LookupCommand("blpop")
+	assert.True(ok)
+	assert.Equal(redis.BlockingTimeout(ci, "a", []float64{1.5}), 1500*time.Millisecond)
+	ci, ok = redis.LookupCommand("xread")
+	assert.True(ok)
+	assert.Equal(redis.BlockingTimeout(ci, []string{"block", "100"}, "streams", "a", "$"), 100*time.Millisecond)
+}
+
 func TestSimpleKeyOperations(t *testing.T) {
 	assert := asserts.NewTestingAssertion(t, true)
 	conn, restore := connectDatabase(assert)
@@ -74,13 +147,138 @@ func TestSimpleKeyOperations(t *testing.T) {
 	assert.Length(keys, 6)
 
 	ssIn := []string{"do", "re", "mi", "fa", "sol", "la", "ti"}
-	conn.Do("set", "sko:zz", ssIn)
+	conn.Do("set", "sko:zz", redis.NewValue(ssIn))
 	vOut, err := conn.DoValue("get", "sko:zz")
 	assert.Nil(err)
 	ssOut := vOut.StringSlice()
 	assert.Equal(ssOut, ssIn)
 }
 
+func TestArgumentEncoding(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	conn, restore := connectDatabase(assert)
+	defer restore()
+
+	conn.Do("set", "enc:float", 1e21)
+	vOut, err := conn.DoString("get", "enc:float")
+	assert.Nil(err)
+	assert.Equal(vOut, "1000000000000000000000")
+
+	conn.Do("set", "enc:bool", true)
+	bOut, err := conn.DoBool("get", "enc:bool")
+	assert.Nil(err)
+	assert.True(bOut)
+
+	tIn := time.Date(2014, 6, 5, 12, 30, 0, 123456789, time.UTC)
+	conn.Do("set", "enc:time", tIn)
+	tOut, err := conn.DoValue("get", "enc:time")
+	assert.Nil(err)
+	tOutTime, err := tOut.Time()
+	assert.Nil(err)
+	assert.True(tOutTime.Equal(tIn))
+
+	ok, err := conn.DoOK("set", "enc:duration", "x", "px", 5*time.Second)
+	assert.Nil(err)
+	assert.True(ok)
+	ttl, err := conn.DoInt("ttl", "enc:duration")
+	assert.Nil(err)
+	assert.True(ttl > 0 && ttl <= 5)
+
+	conn.Do("set", "enc:encoder", testEncoder("yadda"))
+	eOut, err := conn.DoString("get", "enc:encoder")
+	assert.Nil(err)
+	assert.Equal(eOut, "<yadda>")
+
+	_, err = conn.Do("set", "enc:encoder", testEncoder(""))
+	assert.True(errors.IsError(err, redis.ErrEncodeArgument))
+	ping, err := conn.DoString("ping")
+	assert.Nil(err)
+	assert.Equal(ping, "+PONG")
+
+	pushed, err := conn.DoInt("rpush", "enc:list", []int{1, 2, 3}, []string{"a", "b"})
+	assert.Nil(err)
+	assert.Equal(pushed, 5)
+}
+
+func TestStreaming(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	conn, restore := connectDatabase(assert)
+	defer restore()
+
+	in := bytes.Repeat([]byte("0123456789"), 100000)
+	ok, err := conn.DoOK("set", "stream:a", redis.NewSizedReader(bytes.NewReader(in), int64(len(in))))
+	assert.Nil(err)
+	assert.True(ok)
+
+	r, err := conn.DoStream("get", "stream:a")
+	assert.Nil(err)
+	out, err := io.ReadAll(r)
+	assert.Nil(err)
+	assert.Equal(out, in)
+
+	r, err = conn.DoStream("get", "stream:none")
+	assert.Nil(err)
+	assert.Nil(r)
+
+	// Partially read streams are discarded before the next command.
+	r, err = conn.DoStream("get", "stream:a")
+	assert.Nil(err)
+	part := make([]byte, 10)
+	_, err = io.ReadFull(r, part)
+	assert.Nil(err)
+	assert.Equal(string(part), "0123456789")
+	length, err := conn.DoInt("strlen", "stream:a")
+	assert.Nil(err)
+	assert.Equal(length, len(in))
+
+	// Error replies are returned as errors.
+	_, err = conn.Do("lpush", "stream:list", "a")
+	assert.Nil(err)
+	r, err = conn.DoStream("get", "stream:list")
+	assert.True(errors.IsError(err, redis.ErrServerResponse))
+	assert.Nil(r)
+	length, err = conn.DoInt("strlen", "stream:a")
+	assert.Nil(err)
+	assert.Equal(length, len(in))
+}
+
+func TestCommandTable(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	db, err := redis.Open(redis.UnixConnection("", 0), redis.Index(testDatabaseIndex, ""))
+	assert.Nil(err)
+	defer db.Close()
+	conn, err := db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+
+	ci, ok := db.CommandInfo("MSET")
+	assert.True(ok)
+	assert.True(ci.Is(redis.FlagWrite))
+	assert.False(ci.Is(redis.FlagReadOnly))
+	assert.Equal(ci.Keys("a", 1, "b", 2), []string{"a", "b"})
+	ci, ok = db.CommandInfo("eval")
+	assert.True(ok)
+	assert.Equal(ci.Keys("return 1", 2, "a", "b", "x"), []string{"a", "b"})
+	ci, ok = db.CommandInfo("blpop")
+	assert.True(ok)
+	assert.True(ci.Is(redis.FlagBlocking))
+	assert.Equal(ci.Keys("a", "b", 5), []string{"a", "b"})
+
+	_, err = conn.Do("get", "a", "b")
+	assert.True(errors.IsError(err, redis.ErrInvalidArity))
+	_, err = conn.Do("ssubscribe", "a")
+	assert.True(errors.IsError(err, redis.ErrUseSubscription))
+
+	err = conn.RefreshCommands("get", "hgetall")
+	assert.Nil(err)
+	ci, ok = db.CommandInfo("hgetall")
+	assert.True(ok)
+	assert.Equal(ci.Arity, 2)
+	assert.True(ci.Is(redis.FlagReadOnly))
+	err = conn.RefreshCommands()
+	assert.Nil(err)
+}
+
 func TestScan(t *testing.T) {
 	assert := asserts.NewTestingAssertion(t, true)
 	conn, restore := connectDatabase(assert)
@@ -128,7 +326,7 @@ func TestHash(t *testing.T) {
 		"e2": "bar",
 		"e3": "yadda",
 	}
-	ok, err := conn.DoOK("hmset", "hash", "a", "foo", "b", 2, "c", 3.3, "d", true, "e", e)
+	ok, err := conn.DoOK("hmset", "hash", "a", "foo", "b", 2, "c", 3.3, "d", true, "e", redis.NewValue(e))
 	assert.Nil(err)
 	assert.True(ok)
 
@@ -155,6 +353,65 @@ func TestHash(t *testing.T) {
 	assert.Equal(valueE, e)
 }
 
+func TestDecoding(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	conn, restore := connectDatabase(assert)
+	defer restore()
+
+	conn.Do("hmset", "dec:hash", "name", "foo", "count", 5, "score", 1.5, "ok", true)
+	result, err := conn.Do("hgetall", "dec:hash")
+	assert.Nil(err)
+	var hash map[string]string
+	err = result.Decode(&hash)
+	assert.Nil(err)
+	assert.Length(hash, 4)
+	assert.Equal(hash["name"], "foo")
+	var s struct {
+		Name   string
+		Count  int
+		Score  float64 `redis:"score"`
+		OK     bool    `redis:"ok"`
+		Ignore string  `redis:"-"`
+	}
+	err = result.Decode(&s)
+	assert.Nil(err)
+	assert.Equal(s.Name, "foo")
+	assert.Equal(s.Count, 5)
+	assert.Equal(s.Score, 1.5)
+	assert.True(s.OK)
+
+	conn.Do("rpush", "dec:list", 1, 2, 3)
+	result, err = conn.Do("lrange", "dec:list", 0, -1)
+	assert.Nil(err)
+	var ints []int
+	err = result.Decode(&ints)
+	assert.Nil(err)
+	assert.Equal(ints, []int{1, 2, 3})
+	var first int
+	var third string
+	err = result.Scan(&first, nil, &third)
+	assert.Nil(err)
+	assert.Equal(first, 1)
+	assert.Equal(third, "3")
+
+	result, err = conn.Do("eval", "return {1, {'a', 'b'}, {'c', 'x'}}", 0)
+	assert.Nil(err)
+	var nested []interface{}
+	err = result.Decode(&nested)
+	assert.Nil(err)
+	assert.Length(nested, 3)
+	var strs [][]string
+	err = result.Decode(&strs)
+	assert.True(errors.IsError(err, redis.ErrIllegalItemType))
+	var mixed struct {
+		A int
+		B []string
+		C []int
+	}
+	err = result.Scan(&mixed.A, &mixed.B, &mixed.C)
+	assert.ErrorMatch(err, `.*item at index \[2\]\[1\] is no int.*`)
+}
+
 func TestHScan(t *testing.T) {
 	assert := asserts.NewTestingAssertion(t, true)
 	conn, restore := connectDatabase(assert)
@@ -208,6 +465,38 @@ func TestList(t *testing.T) {
 	assert.Equal(popped, 5)
 }
 
+func TestBlockingList(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	conn, restore := connectDatabase(assert)
+	defer restore()
+
+	// Server timeout without data.
+	result, err := conn.Do("blpop", "blocking:list", 1)
+	assert.Nil(err)
+	assert.True(result.IsNil())
+	result, err = conn.DoBlocking("bzpopmin", 100*time.Millisecond, "blocking:zset")
+	assert.Nil(err)
+	assert.True(result.IsNil())
+
+	// Data pushed while waiting.
+	go func() {
+		pushConn, pushRestore := connectDatabase(assert)
+		defer pushRestore()
+		time.Sleep(100 * time.Millisecond)
+		pushConn.Do("rpush", "blocking:list", "foo")
+	}()
+	result, err = conn.DoBlocking("blpop", 5*time.Second, "blocking:list")
+	assert.Nil(err)
+	assert.False(result.IsNil())
+	assertEqualString(assert, result, 0, "blocking:list")
+	assertEqualString(assert, result, 1, "foo")
+
+	// Connection is still usable.
+	ping, err := conn.DoString("ping")
+	assert.Nil(err)
+	assert.Equal(ping, "+PONG")
+}
+
 func TestSet(t *testing.T) {
 	assert := asserts.NewTestingAssertion(t, true)
 	conn, restore := connectDatabase(assert)
@@ -326,6 +615,136 @@ func TestZScan(t *testing.T) {
 	assert.Equal(valueCount, 26*26)
 }
 
+func TestGeo(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	conn, restore := connectDatabase(assert)
+	defer restore()
+	testGeo(assert, conn)
+}
+
+func TestFakeGeo(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	conn, restore := fakeDatabase(assert)
+	defer restore()
+	testGeo(assert, conn)
+}
+
+// testGeo tests the geo commands and helpers.
+func testGeo(assert asserts.Assertion, conn *redis.Connection) {
+	added, err := conn.DoInt("geoadd", "geo", 13.361389, 38.115556, "Palermo", 15.087269, 37.502669, "Catania")
+	assert.Nil(err)
+	assert.Equal(added, 2)
+
+	gls, err := conn.DoGeoLocations("geosearch", "geo", "fromlonlat", 15, 37, "byradius", 200, "km", "asc")
+	assert.Nil(err)
+	assert.Equal(gls.Members(), []string{"Catania", "Palermo"})
+
+	gls, err = conn.DoGeoLocations("geosearch", "geo", "fromlonlat", 15, 37, "byradius", 200, "km", "asc", "withdist", "withhash", "withcoord")
+	assert.Nil(err)
+	assert.Length(gls, 2)
+	assert.Equal(gls[0].Member, "Catania")
+	assert.About(gls[0].Dist, 56.4413, 0.001)
+	assert.Equal(gls[0].Hash, int64(3479447370796909))
+	assert.About(gls[0].Lon, 15.087269, 0.00001)
+	assert.About(gls[0].Lat, 37.502669, 0.00001)
+	assert.Equal(gls[1].Member, "Palermo")
+	assert.About(gls[1].Dist, 190.4424, 0.001)
+
+	gls, err = conn.DoGeoLocations("georadius_ro", "geo", 15, 37, 100, "km", "withcoord")
+	assert.Nil(err)
+	assert.Length(gls, 1)
+	assert.Equal(gls[0].Member, "Catania")
+	assert.Equal(gls[0].Dist, 0.0)
+	assert.About(gls[0].Lat, 37.502669, 0.00001)
+}
+
+func TestHyperLogLog(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	conn, restore := connectDatabase(assert)
+	defer restore()
+	testHyperLogLog(assert, conn)
+}
+
+func TestFakeHyperLogLog(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	conn, restore := fakeDatabase(assert)
+	defer restore()
+	testHyperLogLog(assert, conn)
+}
+
+// testHyperLogLog tests the HyperLogLog commands and helpers.
+func testHyperLogLog(assert asserts.Assertion, conn *redis.Connection) {
+	changed, err := conn.PFAdd("hll:a", "a", "b", "c", "d")
+	assert.Nil(err)
+	assert.True(changed)
+	changed, err = conn.PFAdd("hll:a", "a", "b")
+	assert.Nil(err)
+	assert.False(changed)
+	_, err = conn.PFAdd("hll:b", []string{"c", "d", "e", "f"})
+	assert.Nil(err)
+
+	count, err := conn.PFCount("hll:a")
+	assert.Nil(err)
+	assert.Equal(count, 4)
+	count, err = conn.PFCount("hll:a", "hll:b")
+	assert.Nil(err)
+	assert.Equal(count, 6)
+
+	err = conn.PFMerge("hll:c", "hll:a", "hll:b")
+	assert.Nil(err)
+	count, err = conn.PFCount("hll:c")
+	assert.Nil(err)
+	assert.Equal(count, 6)
+}
+
+func TestBitField(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	conn, restore := connectDatabase(assert)
+	defer restore()
+	testBitField(assert, conn)
+}
+
+func TestFakeBitField(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	conn, restore := fakeDatabase(assert)
+	defer restore()
+	testBitField(assert, conn)
+}
+
+// testBitField tests the bit field commands and helpers.
+func testBitField(assert asserts.Assertion, conn *redis.Connection) {
+	bf := redis.NewBitField("bitfield").
+		Set("i8", 0, 100).
+		IncrBy("i8", 0, 20).
+		Set("u4", "#2", 15).
+		Get("i8", 0)
+	values, err := conn.DoBitField(bf)
+	assert.Nil(err)
+	assert.Equal(values, []redis.BitFieldValue{{0, false}, {120, false}, {0, false}, {120, false}})
+
+	bf = redis.NewBitField("bitfield").
+		IncrBy("i8", 0, 10).
+		Overflow(redis.OverflowSat).
+		IncrBy("i8", 0, 10).
+		Overflow(redis.OverflowFail).
+		IncrBy("i8", 0, -20).
+		IncrBy("u4", "#2", -15)
+	values, err = conn.DoBitField(bf)
+	assert.Nil(err)
+	assert.Equal(values, []redis.BitFieldValue{{-126, false}, {-116, false}, {0, true}, {0, false}})
+
+	values, err = conn.DoBitField(redis.NewBitField("bitfield").Get("i8", 0).Get("u4", "#2"))
+	assert.Nil(err)
+	assert.Equal(values, []redis.BitFieldValue{{-116, false}, {0, false}})
+
+	_, err = conn.DoBitField(redis.NewBitField("bitfield").Get("u64", 0))
+	assert.True(errors.IsError(err, redis.ErrInvalidBitField))
+	_, err = conn.DoBitField(redis.NewBitField("bitfield").Get("i8", "2"))
+	assert.True(errors.IsError(err, redis.ErrInvalidBitField))
+	_, err = conn.DoBitField(redis.NewBitField("bitfield").Overflow("ignore"))
+	assert.True(errors.IsError(err, redis.ErrInvalidBitField))
+}
+
 func TestTransactionConnection(t *testing.T) {
 	assert := asserts.NewTestingAssertion(t, true)
 	conn, restore := connectDatabase(assert)
@@ -473,6 +892,117 @@ func TestScripting(t *testing.T) {
 	assert.Equal(reply3, "+x")
 }
 
+func TestNestedReplies(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	conn, restore := connectDatabase(assert)
+	defer restore()
+
+	script := "return {1, {'a', {'b'}}, 'c'}"
+	result, err := conn.Do("eval", script, 0)
+	assert.Nil(err)
+	assert.Length(result, 3)
+	assertEqualInt(assert, result, 0, 1)
+	nested, err := result.ResultSetAt(1)
+	assert.Nil(err)
+	assert.Length(nested, 2)
+	assertEqualString(assert, nested, 0, "a")
+	inner, err := nested.ResultSetAt(1)
+	assert.Nil(err)
+	assertEqualString(assert, inner, 0, "b")
+	assertEqualString(assert, result, 2, "c")
+}
+
+func TestFunctionLibrary(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	conn, restore := connectDatabase(assert)
+	defer restore()
+	db, err := redis.Open(redis.Index(testDatabaseIndex, ""))
+	assert.Nil(err)
+	defer db.Close()
+
+	conn.Do("function", "delete", "testlib")
+
+	code := `#!lua name=testlib
+redis.register_function('testset', function(keys, args)
+	return redis.call('set', keys[1], args[1])
+end)
+redis.register_function{
+	function_name = 'testget',
+	callback = function(keys, args) return redis.call('get', keys[1]) end,
+	flags = {'no-writes'},
+	description = 'get a key'
+}`
+	_, err = redis.NewFunctionLibrary(db, "return 1")
+	assert.True(errors.IsError(err, redis.ErrInvalidLibrary))
+	fl, err := redis.NewFunctionLibrary(db, code)
+	assert.Nil(err)
+	assert.Equal(fl.Name(), "testlib")
+
+	// Loading.
+	drifted, err := fl.Drifted()
+	assert.Nil(err)
+	assert.True(drifted)
+	loaded, err := fl.Sync()
+	assert.Nil(err)
+	assert.True(loaded)
+	loaded, err = fl.Sync()
+	assert.Nil(err)
+	assert.False(loaded)
+	err = fl.Load()
+	assert.Nil(err)
+
+	info, ok, err := fl.Info()
+	assert.Nil(err)
+	assert.True(ok)
+	assert.Equal(info.Engine, "LUA")
+	assert.Equal(info.Code, code)
+	assert.Length(info.Functions, 2)
+	for _, function := range info.Functions {
+		if function.Name == "testget" {
+			assert.Equal(function.Description, "get a key")
+			assert.Equal(function.Flags, []string{"no-writes"})
+		}
+	}
+
+	// Calling.
+	result, err := fl.Call("testset", []string{"fcall:a"}, 4711)
+	assert.Nil(err)
+	assertEqualString(assert, result, 0, "+OK")
+	result, err = fl.CallRO("testget", []string{"fcall:a"})
+	assert.Nil(err)
+	assertEqualInt(assert, result, 0, 4711)
+
+	// Dump and restore.
+	payload, err := conn.FunctionDump()
+	assert.Nil(err)
+	err = fl.Delete()
+	assert.Nil(err)
+	drifted, err = fl.Drifted()
+	assert.Nil(err)
+	assert.True(drifted)
+	err = conn.FunctionRestore(payload, redis.RestoreReplace)
+	assert.Nil(err)
+	drifted, err = fl.Drifted()
+	assert.Nil(err)
+	assert.False(drifted)
+	err = conn.FunctionRestore(payload, redis.RestoreAppend)
+	assert.True(errors.IsError(err, redis.ErrServerResponse))
+	err = conn.FunctionRestore(payload, "ignore")
+	assert.True(errors.IsError(err, redis.ErrInvalidConfiguration))
+
+	// Drift.
+	conn.Do("function", "load", "replace", "#!lua name=testlib\nredis.register_function('testset', function() return 1 end)")
+	drifted, err = fl.Drifted()
+	assert.Nil(err)
+	assert.True(drifted)
+	loaded, err = fl.Sync()
+	assert.Nil(err)
+	assert.True(loaded)
+
+	err = fl.Delete()
+	assert.Nil(err)
+}
+
 func TestPubSub(t *testing.T) {
 	assert := asserts.NewTestingAssertion(t, true)
 	conn, connRestore := connectDatabase(assert)
@@ -487,7 +1017,7 @@ func TestPubSub(t *testing.T) {
 	assert.Nil(err)
 	pv, err := sub.Pop()
 	assert.Nil(err)
-	assert.Equal(pv.Kind, "subscribe")
+	assert.Equal(pv.Kind, redis.KindSubscribe)
 	assert.Equal(pv.Channel, "pubsub")
 	assert.Equal(pv.Count, 1)
 
@@ -505,7 +1035,7 @@ func TestPubSub(t *testing.T) {
 		time.Sleep(sleep)
 		pv, err := sub.Pop()
 		assert.Nil(err)
-		assert.Equal(pv.Kind, "message")
+		assert.Equal(pv.Kind, redis.KindMessage)
 		assert.Equal(pv.Channel, "pubsub")
 		value, err := pv.Value.Int()
 		assert.Nil(err)
@@ -514,4 +1044,73 @@ func TestPubSub(t *testing.T) {
 	}
 }
 
+func TestPublishSubscriber(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	db, err := redis.Open(redis.Index(testDatabaseIndex, ""))
+	assert.Nil(err)
+	defer db.Close()
+
+	type event struct {
+		Name  string
+		Count int
+	}
+	sub, err := redis.NewSubscriber[event](db)
+	assert.Nil(err)
+	defer sub.Close()
+	err = sub.Subscribe("events")
+	assert.Nil(err)
+	err = sub.Subscribe("events:*")
+	assert.Nil(err)
+	time.Sleep(50 * time.Millisecond)
+
+	// Typed payload on a channel and a pattern.
+	receivers, err := db.Publish("events", event{"foo", 1})
+	assert.Nil(err)
+	assert.Equal(receivers, 1)
+	msg, err := sub.Pop()
+	assert.Nil(err)
+	assert.Nil(msg.Err)
+	assert.Equal(msg.Channel, "events")
+	assert.Equal(msg.Payload, event{"foo", 1})
+
+	receivers, err = db.Publish("events:bar", &event{"bar", 2})
+	assert.Nil(err)
+	assert.Equal(receivers, 1)
+	msg, err = sub.Pop()
+	assert.Nil(err)
+	assert.Nil(msg.Err)
+	assert.Equal(msg.Pattern, "events:*")
+	assert.Equal(msg.Channel, "events:bar")
+	assert.Equal(msg.Payload, event{"bar", 2})
+
+	// Invalid payload doesn't break the subscription.
+	_, err = db.Publish("events", "no JSON")
+	assert.Nil(err)
+	msg, err = sub.Pop()
+	assert.Nil(err)
+	assert.ErrorMatch(msg.Err, `.* cannot decode payload of channel "events".*`)
+	assert.Equal(msg.Raw.String(), "no JSON")
+
+	_, err = db.Publish("events", event{"baz", 3})
+	assert.Nil(err)
+	msg, err = sub.Pop()
+	assert.Nil(err)
+	assert.Nil(msg.Err)
+	assert.Equal(msg.Payload, event{"baz", 3})
+
+	// Strings are taken unchanged.
+	ssub, err := redis.NewSubscriber[string](db)
+	assert.Nil(err)
+	defer ssub.Close()
+	err = ssub.Subscribe("strings")
+	assert.Nil(err)
+	time.Sleep(50 * time.Millisecond)
+	_, err = db.Publish("strings", "foo bar")
+	assert.Nil(err)
+	smsg, err := ssub.Pop()
+	assert.Nil(err)
+	assert.Equal(smsg.Payload, "foo bar")
+	assert.Equal(redis.KindPMessage.String(), "pmessage")
+}
+
 // EOF
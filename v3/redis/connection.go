@@ -12,7 +12,9 @@ package redis
 //--------------------
 
 import (
+	"io"
 	"strings"
+	"time"
 
 	"github.com/tideland/goas/v2/identifier"
 	"github.com/tideland/goas/v2/monitoring"
@@ -25,8 +27,10 @@ import (
 
 // Connection manages one connection to a Redis database.
 type Connection struct {
-	database *Database
-	resp     *resp
+	database    *Database
+	resp        *protocol
+	stream      *bulkReader
+	transaction bool
 }
 
 // newConnection creates a new connection instance.
@@ -38,45 +42,236 @@ func newConnection(db *Database) (*Connection, error) {
 	if err != nil {
 		return nil, err
 	}
-	// Perform authentication and database selection.
+	return conn, nil
+}
+
+// Do executes one Redis command and returns
+// the result as result set. If the connection is broken
+// it is dropped. Commands allowed by the retry policy are
+// then executed again on a new connection. If replicas are
+// configured read-only commands outside of transactions
+// are executed there.
+func (conn *Connection) Do(cmd string, args ...interface{}) (*ResultSet, error) {
+	return conn.execute(cmd, args, false)
+}
+
+// DoPrimary executes one Redis command like Do() but always
+// on the primary, e.g. to read own writes immediately.
+func (conn *Connection) DoPrimary(cmd string, args ...interface{}) (*ResultSet, error) {
+	return conn.execute(cmd, args, true)
+}
+
+// execute routes a command to a replica or the primary
+// and retries it there if allowed.
+func (conn *Connection) execute(cmd string, args []interface{}, primary bool) (*ResultSet, error) {
+	cmd = strings.ToLower(cmd)
+	if conn.database.commands.is(cmd, FlagSubscribe) {
+		return nil, errors.New(ErrUseSubscription, errorMessages)
+	}
+	ci, _ := conn.database.commands.lookup(cmd)
+	if ci.Is(FlagBlocking) && !conn.transaction {
+		return conn.doBlocking(ci, args)
+	}
+	readOnly := ci.Is(FlagReadOnly)
+	if !primary && !conn.transaction && conn.database.replicas != nil && readOnly {
+		result, done, err := conn.doOnReplica(cmd, args)
+		if done {
+			return result, err
+		}
+	}
+	failed := 0
+	for {
+		result, err := conn.do(cmd, args)
+		broken := errors.IsError(err, ErrConnectionBroken)
+		redialed := failed > 0 && errors.IsError(err, ErrConnectionEstablishing)
+		if err == nil || !(broken || redialed) {
+			conn.trackTransaction(cmd, err)
+			return result, err
+		}
+		// Connection is broken, drop it and retry if allowed.
+		if conn.resp != nil {
+			conn.database.pool.kill(conn.resp)
+			conn.resp = nil
+		}
+		failed++
+		if conn.transaction || !conn.database.retry.allows(cmd, readOnly, failed) {
+			conn.transaction = false
+			return nil, err
+		}
+		conn.database.retry.wait(failed)
+	}
+}
+
+// do performs one execution of a command.
+func (conn *Connection) do(cmd string, args []interface{}) (*ResultSet, error) {
+	if conn.database.monitoring {
+		m := monitoring.BeginMeasuring(identifier.Identifier("redis", "command", cmd))
+		defer m.EndMeasuring()
+	}
+	err := conn.send(cmd, args)
 	if err != nil {
 		return nil, err
 	}
-	err = conn.resp.authenticate()
-	if err != nil {
+	return conn.resp.receiveResultSet()
+}
+
+// DoBlocking executes one blocking Redis command like BLPOP, BRPOP,
+// BZPOPMIN, or XREAD. The timeout is passed as argument in the format
+// the command needs, so it must not be part of args. If the server
+// timeout is reached the returned result set is nil, see rs.IsNil().
+func (conn *Connection) DoBlocking(cmd string, timeout time.Duration, args ...interface{}) (*ResultSet, error) {
+	switch strings.ToLower(cmd) {
+	case "xread", "xreadgroup":
+		ms := int64(timeout / time.Millisecond)
+		args = append([]interface{}{"block", ms}, args...)
+	default:
+		args = append(args, timeout.Seconds())
+	}
+	return conn.Do(cmd, args...)
+}
+
+// doBlocking executes a blocking command. The read deadline is set
+// to the timeout of the command plus a margin. If it is exceeded the
+// connection is dropped, as the server may still send the response.
+func (conn *Connection) doBlocking(ci CommandInfo, args []interface{}) (*ResultSet, error) {
+	var deadline time.Time
+	if timeout := ci.blockingTimeout(args); timeout > 0 {
+		deadline = time.Now().Add(timeout + blockingMargin)
+	}
+	if conn.database.monitoring {
+		m := monitoring.BeginMeasuring(identifier.Identifier("redis", "command", ci.Name))
+		defer m.EndMeasuring()
+	}
+	err := conn.send(ci.Name, args)
+	if err == nil {
+		err = conn.resp.conn.SetReadDeadline(deadline)
+	}
+	var result *ResultSet
+	if err == nil {
+		result, err = conn.resp.receiveResultSet()
+	}
+	switch {
+	case err == nil:
+		err = conn.resp.conn.SetReadDeadline(time.Time{})
+		return result, err
+	case errors.IsError(err, ErrTimeout):
+		// Server timeout returns a nil array.
+		err = conn.resp.conn.SetReadDeadline(time.Time{})
+		return newNilResultSet(), err
+	}
+	if conn.resp != nil {
 		conn.database.pool.kill(conn.resp)
-		return nil, err
+		conn.resp = nil
+	}
+	if !deadline.IsZero() && time.Now().After(deadline) {
+		return nil, errors.Annotate(err, ErrTimeout, errorMessages)
+	}
+	return nil, err
+}
+
+// doOnReplica executes a command on a replica. If it fails due to
+// the connection the replica is marked as unhealthy and done is
+// false, so that the command can be executed on the primary.
+func (conn *Connection) doOnReplica(cmd string, args []interface{}) (result *ResultSet, done bool, err error) {
+	r := conn.database.replicas.choose()
+	if r == nil {
+		return nil, false, nil
+	}
+	if conn.database.monitoring {
+		m := monitoring.BeginMeasuring(identifier.Identifier("redis", "command", cmd))
+		defer m.EndMeasuring()
 	}
-	err = conn.resp.selectDatabase()
+	p, err := r.pool.pull(true)
 	if err != nil {
-		conn.database.pool.kill(conn.resp)
-		return nil, err
+		conn.database.replicas.fail(r)
+		return nil, false, nil
 	}
-	return conn, nil
+	if !p.ready {
+		err = p.handshake()
+	}
+	if err == nil {
+		err = p.sendCommand(cmd, args...)
+		logCommand(cmd, args, err, conn.database.logging)
+		if err == nil {
+			result, err = p.receiveResultSet()
+		}
+	}
+	if err != nil && !errors.IsError(err, ErrServerResponse) && !errors.IsError(err, ErrTimeout) {
+		r.pool.kill(p)
+		conn.database.replicas.fail(r)
+		return nil, false, nil
+	}
+	r.pool.push(p)
+	return result, true, err
 }
 
-// Do executes one Redis command and returns
-// the result as result set.
-func (conn *Connection) Do(cmd string, args ...interface{}) (*ResultSet, error) {
+// DoStream executes one Redis command returning a bulk value, e.g.
+// GET, and returns a reader on the value. So large values can be
+// read without buffering them completely. The reader has to be read
+// completely before the connection is used again, otherwise the rest
+// will be discarded. If the value is nil the reader is nil too.
+func (conn *Connection) DoStream(cmd string, args ...interface{}) (io.Reader, error) {
 	cmd = strings.ToLower(cmd)
-	if strings.Contains(cmd, "subscribe") {
+	if conn.database.commands.is(cmd, FlagSubscribe) {
 		return nil, errors.New(ErrUseSubscription, errorMessages)
 	}
-	err := conn.ensureProtocol()
-	if err != nil {
-		return nil, err
-	}
 	if conn.database.monitoring {
 		m := monitoring.BeginMeasuring(identifier.Identifier("redis", "command", cmd))
 		defer m.EndMeasuring()
 	}
-	err = conn.resp.sendCommand(cmd, args...)
-	logCommand(cmd, args, err, conn.database.logging)
+	err := conn.send(cmd, args)
+	if err == nil {
+		conn.stream, err = conn.resp.receiveStream()
+	}
 	if err != nil {
+		if errors.IsError(err, ErrConnectionBroken) && conn.resp != nil {
+			conn.database.pool.kill(conn.resp)
+			conn.resp = nil
+		}
 		return nil, err
 	}
-	result, err := conn.resp.receiveResultSet()
-	return result, err
+	if conn.stream == nil {
+		return nil, nil
+	}
+	return conn.stream, nil
+}
+
+// send sends a command after the remaining data of a former
+// stream has been discarded.
+func (conn *Connection) send(cmd string, args []interface{}) error {
+	err := conn.drainStream()
+	if err != nil {
+		return err
+	}
+	err = conn.ensureProtocol()
+	if err != nil {
+		return err
+	}
+	err = conn.resp.sendCommand(cmd, args...)
+	logCommand(cmd, args, err, conn.database.logging)
+	return err
+}
+
+// drainStream discards the unread data of a stream.
+func (conn *Connection) drainStream() error {
+	if conn.stream == nil {
+		return nil
+	}
+	err := conn.stream.drain()
+	conn.stream = nil
+	return err
+}
+
+// trackTransaction remembers if the connection is inside a
+// transaction. Those commands must not be retried on a new
+// connection.
+func (conn *Connection) trackTransaction(cmd string, err error) {
+	switch cmd {
+	case "multi":
+		conn.transaction = err == nil
+	case "exec", "discard":
+		conn.transaction = false
+	}
 }
 
 // DoValue executes one Redis command and returns a single value.
@@ -188,20 +383,58 @@ func (conn *Connection) DoScan(cmd string, args ...interface{}) (int, *ResultSet
 	return result.Scanned()
 }
 
+// RefreshCommands retrieves the infos about the passed commands
+// or all commands if none are passed from the server and updates
+// the command table of the database.
+func (conn *Connection) RefreshCommands(cmds ...string) error {
+	var result *ResultSet
+	var err error
+	if len(cmds) == 0 {
+		result, err = conn.DoPrimary("command")
+	} else {
+		result, err = conn.DoPrimary("command", "info", cmds)
+	}
+	if err != nil {
+		return err
+	}
+	cis, err := parseCommandInfos(result)
+	if err != nil {
+		return err
+	}
+	conn.database.commands.update(cis)
+	return nil
+}
+
 // Return passes the connection back into the database pool.
 func (conn *Connection) Return() error {
+	if conn.resp == nil {
+		return nil
+	}
+	if err := conn.drainStream(); err != nil {
+		conn.database.pool.kill(conn.resp)
+		conn.resp = nil
+		return err
+	}
 	err := conn.database.pool.push(conn.resp)
 	conn.resp = nil
 	return err
 }
 
-// ensureProtocol retrieves a protocol from the pool if needed.
+// ensureProtocol retrieves a protocol from the pool if needed
+// and performs authentication and database selection if it's
+// not yet done.
 func (conn *Connection) ensureProtocol() error {
 	if conn.resp == nil {
 		p, err := conn.database.pool.pull(true)
 		if err != nil {
 			return err
 		}
+		if !p.ready {
+			if err = p.handshake(); err != nil {
+				conn.database.pool.kill(p)
+				return err
+			}
+		}
 		conn.resp = p
 	}
 	return nil
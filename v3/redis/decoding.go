@@ -0,0 +1,305 @@
+// Tideland Go Data Management - Redis Client - Decoding
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// DECODING
+//--------------------
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	durationType  = reflect.TypeOf(time.Duration(0))
+	valueType     = reflect.TypeOf(Value{})
+	resultSetType = reflect.TypeOf(&ResultSet{})
+)
+
+// Scan copies the items of the result set into the values pointed
+// at by dest, the first item into the first destination and so on.
+// A nil destination skips the item. See Decode() for the supported
+// types.
+func (rs *ResultSet) Scan(dest ...interface{}) error {
+	if len(dest) > len(rs.items) {
+		return errors.New(ErrIllegalItemIndex, errorMessages, len(dest)-1, len(rs.items))
+	}
+	for index, d := range dest {
+		if d == nil {
+			continue
+		}
+		rv, err := destinationValue(d)
+		if err != nil {
+			return err
+		}
+		if err = decodeItem(rs.items[index], rv, itemPath("", index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decode decodes the whole result set into the value pointed at
+// by dest. Values can be decoded into ints, uints, floats, bools,
+// strings, byte slices, times, durations, and types implementing
+// encoding.BinaryUnmarshaler or encoding.TextUnmarshaler. Result
+// sets can be decoded into slices, maps, and structs. Maps and
+// structs expect alternating keys and values like returned by
+// HGETALL. Struct fields are matched by their name or a tag like
+// `redis:"name"`, the tag "-" skips a field. A nil value sets the
+// destination to its zero value.
+func (rs *ResultSet) Decode(dest interface{}) error {
+	rv, err := destinationValue(dest)
+	if err != nil {
+		return err
+	}
+	return decodeItem(rs, rv, "")
+}
+
+// destinationValue checks if the destination is a pointer and
+// returns the value it's pointing to.
+func destinationValue(dest interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return reflect.Value{}, errors.New(ErrInvalidDestination, errorMessages, dest, "pointer")
+	}
+	return rv.Elem(), nil
+}
+
+// decodeItem decodes a value or a nested result set into
+// the destination.
+func decodeItem(item interface{}, rv reflect.Value, path string) error {
+	// Some types are set directly.
+	switch rv.Type() {
+	case resultSetType:
+		rs, ok := item.(*ResultSet)
+		if !ok {
+			return illegalItemType(nil, path, "result set")
+		}
+		rv.Set(reflect.ValueOf(rs))
+		return nil
+	case valueType:
+		value, ok := item.(Value)
+		if !ok {
+			return illegalItemType(nil, path, "value")
+		}
+		rv.SetBytes(value)
+		return nil
+	}
+	if rv.Kind() == reflect.Interface && rv.NumMethod() == 0 {
+		rv.Set(reflect.ValueOf(item))
+		return nil
+	}
+	switch typedItem := item.(type) {
+	case Value:
+		return decodeValue(typedItem, rv, path)
+	case *ResultSet:
+		return decodeResultSet(typedItem, rv, path)
+	}
+	return illegalItemType(nil, path, rv.Type().String())
+}
+
+// decodeValue decodes a single value into the destination.
+func decodeValue(value Value, rv reflect.Value, path string) error {
+	if value.IsNil() {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+	// Check types needing special handling.
+	switch rv.Type() {
+	case timeType:
+		t, err := value.Time()
+		if err != nil {
+			return illegalItemType(err, path, "time")
+		}
+		rv.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		d, err := value.Duration()
+		if err != nil {
+			return illegalItemType(err, path, "duration")
+		}
+		rv.SetInt(int64(d))
+		return nil
+	}
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return decodeValue(value, rv.Elem(), path)
+	}
+	if rv.CanAddr() {
+		switch u := rv.Addr().Interface().(type) {
+		case encoding.BinaryUnmarshaler:
+			if err := u.UnmarshalBinary(value.Bytes()); err != nil {
+				return illegalItemType(err, path, rv.Type().String())
+			}
+			return nil
+		case encoding.TextUnmarshaler:
+			if err := u.UnmarshalText(value.Bytes()); err != nil {
+				return illegalItemType(err, path, rv.Type().String())
+			}
+			return nil
+		}
+	}
+	// Now the standard types.
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(value.String())
+	case reflect.Bool:
+		b, err := value.Bool()
+		if err != nil {
+			return illegalItemType(err, path, "bool")
+		}
+		rv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := value.Int64()
+		if err != nil || rv.OverflowInt(i) {
+			return illegalItemType(err, path, rv.Type().String())
+		}
+		rv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := value.Uint64()
+		if err != nil || rv.OverflowUint(u) {
+			return illegalItemType(err, path, rv.Type().String())
+		}
+		rv.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := value.Float64()
+		if err != nil || rv.OverflowFloat(f) {
+			return illegalItemType(err, path, rv.Type().String())
+		}
+		rv.SetFloat(f)
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() != reflect.Uint8 {
+			return illegalItemType(nil, path, rv.Type().String())
+		}
+		b := make([]byte, len(value))
+		copy(b, value)
+		rv.SetBytes(b)
+	default:
+		return illegalItemType(nil, path, rv.Type().String())
+	}
+	return nil
+}
+
+// decodeResultSet decodes a result set into the destination.
+func decodeResultSet(rs *ResultSet, rv reflect.Value, path string) error {
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return decodeResultSet(rs, rv.Elem(), path)
+	case reflect.Slice:
+		slice := reflect.MakeSlice(rv.Type(), len(rs.items), len(rs.items))
+		for index, item := range rs.items {
+			if err := decodeItem(item, slice.Index(index), itemPath(path, index)); err != nil {
+				return err
+			}
+		}
+		rv.Set(slice)
+		return nil
+	case reflect.Array:
+		if rv.Len() < len(rs.items) {
+			return errors.New(ErrIllegalItemIndex, errorMessages, rv.Len(), len(rs.items))
+		}
+		for index, item := range rs.items {
+			if err := decodeItem(item, rv.Index(index), itemPath(path, index)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMap(rv.Type()))
+		}
+		for index := 0; index+1 < len(rs.items); index += 2 {
+			key := reflect.New(rv.Type().Key()).Elem()
+			if err := decodeItem(rs.items[index], key, itemPath(path, index)); err != nil {
+				return err
+			}
+			value := reflect.New(rv.Type().Elem()).Elem()
+			if err := decodeItem(rs.items[index+1], value, itemPath(path, index+1)); err != nil {
+				return err
+			}
+			rv.SetMapIndex(key, value)
+		}
+		return nil
+	case reflect.Struct:
+		if rv.Type() == timeType {
+			break
+		}
+		for index := 0; index+1 < len(rs.items); index += 2 {
+			name, ok := rs.items[index].(Value)
+			if !ok {
+				return illegalItemType(nil, itemPath(path, index), "value")
+			}
+			field := structField(rv, name.String())
+			if !field.IsValid() {
+				continue
+			}
+			if err := decodeItem(rs.items[index+1], field, itemPath(path, index+1)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return illegalItemType(nil, path, rv.Type().String())
+}
+
+// structField returns the settable field of a struct matching
+// the passed name by tag or name.
+func structField(rv reflect.Value, name string) reflect.Value {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" {
+			// Unexported field.
+			continue
+		}
+		tag := sf.Tag.Get("redis")
+		switch {
+		case tag == "-":
+			continue
+		case tag == name, tag == "" && strings.EqualFold(sf.Name, name):
+			return rv.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+// itemPath appends the index to the path.
+func itemPath(path string, index int) string {
+	return fmt.Sprintf("%s[%d]", path, index)
+}
+
+// illegalItemType returns the error for an item at the path
+// not matching the destination type.
+func illegalItemType(err error, path, descr string) error {
+	if path == "" {
+		path = "[]"
+	}
+	if err != nil {
+		return errors.Annotate(err, ErrIllegalItemType, errorMessages, path, descr)
+	}
+	return errors.New(ErrIllegalItemType, errorMessages, path, descr)
+}
+
+// EOF
@@ -15,6 +15,22 @@
 // a result set with helpers to access the returned values and convert
 // them into Go types. For typical returnings there are conn.DoXxx() methods.
 //
+// The options for Open() can also be created out of an URL with
+// ParseURL() or out of environment variables with OptionsFromEnv(),
+// see the redisurl package. Username() and TLS() set the according
+// options directly.
+//
+// Arguments of commands are encoded depending on their type. Floats
+// are passed without exponent, bools as 1 or 0, times in RFC 3339
+// format and durations as milliseconds. Types implementing ArgEncoder,
+// encoding.BinaryMarshaler, or encoding.TextMarshaler are encoded by
+// their own methods. Slices and maps are expanded into multiple
+// arguments.
+//
+// Result sets can also be decoded into Go values using rs.Scan() for
+// the individual items and rs.Decode() for the whole set. Here nested
+// result sets can be decoded into slices, maps, and structs.
+//
 // All conn.Do() methods work atomically and are able to run all commands
 // except subscriptions. Also the execution of scripts is possible that
 // way. Additionally the execution of commands can be pipelined. The
@@ -23,11 +39,64 @@
 // be collected with ppl.Collect(), which returns a sice of result sets
 // containing the responses of the commands.
 //
+// Large bulk values can be read with conn.DoStream(), which returns a
+// reader directly on the connection instead of the value. In the other
+// direction a SizedReader passed as argument is streamed to the server.
+//
+// The option Replicas() allows to pass the addresses of replicas. Then
+// read-only commands are executed on them, selected round robin or by
+// the lowest load. Failing replicas are skipped for a while. To read
+// own writes conn.DoPrimary() forces the execution on the primary.
+//
+// The client knows the arity, flags, and key positions of the commonly
+// used commands. They are used to reject calls with a wrong number of
+// arguments before sending and to route commands. The table can be
+// retrieved with db.CommandInfo() and refreshed from the server with
+// conn.RefreshCommands().
+//
+// Blocking commands like BLPOP or XREAD BLOCK set a read deadline
+// matching their timeout, conn.DoBlocking() helps to pass it. A timeout
+// on the server side returns a nil result set, see rs.IsNil(). If the
+// deadline is exceeded first the connection is dropped.
+//
+// If the connection to the server breaks it is dropped. With the option
+// Retry() read-only commands and those explicitly named as idempotent
+// are executed again on a new connection after a growing backoff.
+//
 // Due to the nature of the subscription the client provides an own
 // type which can be retrieved with db.Subscription(). Here channels,
 // in the sense of the Redis Pub/Sub, can be subscribed or unsubscribed.
 // Published values can be retrieved with sub.Pop(). If the subscription
-// is not needed anymore it can be closed using sub.Close().
+// is not needed anymore it can be closed using sub.Close(). The kind
+// of a published value is one of the PublishedKind constants.
+//
+// Values are published with db.Publish(), it returns the number of
+// receiving subscribers. Strings, byte slices, and values are sent
+// unchanged, all others are encoded as JSON. A Subscriber created with
+// NewSubscriber[T]() decodes the payloads into T. Decoding errors are
+// returned inside the message without breaking the subscription.
+//
+// Some replies have own types. conn.DoGeoLocations() returns the members
+// found by GEOSEARCH or GEORADIUS with their optional distance, hash,
+// and coordinates. conn.PFAdd(), conn.PFCount(), and conn.PFMerge() work
+// on HyperLogLogs. A BitField created with NewBitField() collects GET,
+// SET, and INCRBY operations with their overflow policies, it's
+// executed with conn.DoBitField().
+//
+// A FunctionLibrary manages a library of Redis functions. fl.Sync() loads
+// it only if it's missing or differs from the server, fl.Call() and
+// fl.CallRO() call its functions. conn.FunctionDump() and
+// conn.FunctionRestore() transfer all libraries, e.g. during deploys.
+//
+// Commands can be executed asynchronously with db.Go() and pipelines
+// with db.GoPipeline(). Both return a Future, its result sets are
+// retrieved with f.Wait() or f.WaitResults(), f.Done() returns a channel
+// closed after the execution. WaitAll() and WaitAny() wait for several
+// futures, e.g. when reading many keys in parallel. At most as many
+// executions as the pool size run in parallel.
+//
+// The parsing of replies as well as Value, Hash, and KeyValue are shared
+// with version 2 of the client using the resp package.
 package redis
 
 // EOF
@@ -13,6 +13,7 @@ package redis
 
 import (
 	"github.com/tideland/goas/v3/errors"
+	"github.com/tideland/godm/v3/resp"
 )
 
 //--------------------
@@ -31,10 +32,26 @@ const (
 	ErrAuthenticate
 	ErrSelectDatabase
 	ErrUseSubscription
-	ErrInvalidType
-	ErrInvalidKey
+	_
+	_
 	ErrIllegalItemIndex
 	ErrIllegalItemType
+	_
+	ErrInvalidArity
+	ErrEncodePayload
+	ErrDecodePayload
+	ErrInvalidDestination
+	ErrWaitCancelled
+	ErrInvalidBitField
+	ErrInvalidLibrary
+	ErrLoadingLibrary
+)
+
+// Error codes of the shared protocol package.
+const (
+	ErrInvalidType    = resp.ErrInvalidType
+	ErrInvalidKey     = resp.ErrInvalidKey
+	ErrEncodeArgument = resp.ErrEncodeArgument
 )
 
 var errorMessages = errors.Messages{
@@ -48,10 +65,16 @@ var errorMessages = errors.Messages{
 	ErrAuthenticate:           "cannot authenticate",
 	ErrSelectDatabase:         "cannot select database",
 	ErrUseSubscription:        "use subscription type for subscriptions",
-	ErrInvalidType:            "invalid type conversion of \"%v\" to %q",
-	ErrInvalidKey:             "invalid key %q",
 	ErrIllegalItemIndex:       "item index %d is illegal for result set size %d",
-	ErrIllegalItemType:        "item at index %d is no %s",
+	ErrIllegalItemType:        "item at index %v is no %s",
+	ErrInvalidArity:           "wrong number of arguments (%d) for command %q",
+	ErrEncodePayload:          "cannot encode payload for channel %q",
+	ErrDecodePayload:          "cannot decode payload of channel %q",
+	ErrInvalidDestination:     "invalid destination %v, %s needed",
+	ErrWaitCancelled:          "waiting for future cancelled",
+	ErrInvalidBitField:        "invalid bit field %s %v",
+	ErrInvalidLibrary:         "invalid library header %q, needs name",
+	ErrLoadingLibrary:         "cannot load library %q",
 }
 
 // EOF
@@ -0,0 +1,47 @@
+// Tideland Go Data Management - Redis Client - Export for Unit Tests
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bufio"
+	"io"
+	"time"
+)
+
+//--------------------
+// EXPORT
+//--------------------
+
+// NewCommandWriter returns a function encoding commands like a
+// connection into the writer, so that the encoding can be tested
+// and benchmarked without server.
+func NewCommandWriter(w io.Writer) func(cmd string, args ...interface{}) error {
+	r := &protocol{
+		database: &Database{commands: newCommandTable()},
+		writer:   bufio.NewWriter(w),
+		scratch:  make([]byte, 0, 64),
+	}
+	return r.sendCommand
+}
+
+// LookupCommand returns the information about a command
+// out of the built-in command table.
+func LookupCommand(cmd string) (CommandInfo, bool) {
+	return newCommandTable().lookup(cmd)
+}
+
+// BlockingTimeout returns the timeout passed to a blocking command.
+func BlockingTimeout(ci CommandInfo, args ...interface{}) time.Duration {
+	return ci.blockingTimeout(args)
+}
+
+// EOF
@@ -0,0 +1,335 @@
+// Tideland Go Data Management - Redis Client - Functions
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"strings"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// FUNCTION LIBRARY
+//--------------------
+
+// FunctionInfo describes one function of a library.
+type FunctionInfo struct {
+	Name        string
+	Description string
+	Flags       []string
+}
+
+// LibraryInfo describes a library loaded on the server.
+type LibraryInfo struct {
+	Name      string
+	Engine    string
+	Functions []FunctionInfo
+	Code      string
+}
+
+// FunctionLibrary manages a library of Redis functions. Its name
+// is taken from the first line of the code, like in
+// "#!lua name=mylib".
+type FunctionLibrary struct {
+	database *Database
+	name     string
+	code     string
+}
+
+// NewFunctionLibrary creates the management for the library
+// with the passed code. It's not loaded yet.
+func NewFunctionLibrary(db *Database, code string) (*FunctionLibrary, error) {
+	name, err := libraryName(code)
+	if err != nil {
+		return nil, err
+	}
+	return &FunctionLibrary{
+		database: db,
+		name:     name,
+		code:     code,
+	}, nil
+}
+
+// Name returns the name of the library.
+func (fl *FunctionLibrary) Name() string {
+	return fl.name
+}
+
+// Load loads the library, an already loaded one with
+// the same name is replaced.
+func (fl *FunctionLibrary) Load() error {
+	conn, err := fl.database.Connection()
+	if err != nil {
+		return err
+	}
+	defer conn.Return()
+	value, err := conn.DoValue("function", "load", "replace", fl.code)
+	if err != nil {
+		return err
+	}
+	if err := serverError(value); err != nil {
+		return errors.Annotate(err, ErrLoadingLibrary, errorMessages, fl.name)
+	}
+	return nil
+}
+
+// Sync loads the library only if it's missing on the server or
+// differs from the own code. It returns true if it has been loaded.
+func (fl *FunctionLibrary) Sync() (bool, error) {
+	drifted, err := fl.Drifted()
+	if err != nil || !drifted {
+		return false, err
+	}
+	if err := fl.Load(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Drifted returns true if the library is missing on the server
+// or its code differs from the own one.
+func (fl *FunctionLibrary) Drifted() (bool, error) {
+	info, ok, err := fl.Info()
+	if err != nil {
+		return false, err
+	}
+	return !ok || info.Code != fl.code, nil
+}
+
+// Info returns the description of the library as it is
+// loaded on the server, false if it's missing.
+func (fl *FunctionLibrary) Info() (LibraryInfo, bool, error) {
+	conn, err := fl.database.Connection()
+	if err != nil {
+		return LibraryInfo{}, false, err
+	}
+	defer conn.Return()
+	infos, err := conn.FunctionList(fl.name, true)
+	if err != nil {
+		return LibraryInfo{}, false, err
+	}
+	for _, info := range infos {
+		if info.Name == fl.name {
+			return info, true, nil
+		}
+	}
+	return LibraryInfo{}, false, nil
+}
+
+// Call calls the function of the library with FCALL.
+func (fl *FunctionLibrary) Call(function string, keys []string, args ...interface{}) (*ResultSet, error) {
+	return fl.call("fcall", function, keys, args)
+}
+
+// CallRO calls the function of the library with FCALL_RO. The
+// function has to be flagged as no-writes, it may be executed
+// on a replica.
+func (fl *FunctionLibrary) CallRO(function string, keys []string, args ...interface{}) (*ResultSet, error) {
+	return fl.call("fcall_ro", function, keys, args)
+}
+
+// call performs the calling of a function.
+func (fl *FunctionLibrary) call(cmd, function string, keys []string, args []interface{}) (*ResultSet, error) {
+	conn, err := fl.database.Connection()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Return()
+	return conn.Do(cmd, function, len(keys), keys, args)
+}
+
+// Delete deletes the library on the server.
+func (fl *FunctionLibrary) Delete() error {
+	conn, err := fl.database.Connection()
+	if err != nil {
+		return err
+	}
+	defer conn.Return()
+	value, err := conn.DoValue("function", "delete", fl.name)
+	if err != nil {
+		return err
+	}
+	return serverError(value)
+}
+
+// libraryName returns the name of the library out
+// of the first line of its code.
+func libraryName(code string) (string, error) {
+	line := strings.SplitN(code, "\n", 2)[0]
+	if !strings.HasPrefix(line, "#!") {
+		return "", errors.New(ErrInvalidLibrary, errorMessages, line)
+	}
+	for _, field := range strings.Fields(line[2:]) {
+		if strings.HasPrefix(field, "name=") && len(field) > 5 {
+			return field[5:], nil
+		}
+	}
+	return "", errors.New(ErrInvalidLibrary, errorMessages, line)
+}
+
+// serverError returns an error if the value is an
+// error reply of the server.
+func serverError(value Value) error {
+	if len(value) > 0 && value[0] == '-' {
+		return errors.New(ErrServerResponse, errorMessages, value.String()[1:])
+	}
+	return nil
+}
+
+//--------------------
+// FUNCTION MANAGEMENT
+//--------------------
+
+// RestorePolicy defines how FUNCTION RESTORE handles
+// existing libraries.
+type RestorePolicy string
+
+// Restore policies.
+const (
+	RestoreAppend  RestorePolicy = "append"
+	RestoreReplace RestorePolicy = "replace"
+	RestoreFlush   RestorePolicy = "flush"
+)
+
+// FunctionList returns the libraries loaded on the server whose names
+// match the pattern, an empty pattern returns all. The code is only
+// returned if requested.
+func (conn *Connection) FunctionList(pattern string, withCode bool) ([]LibraryInfo, error) {
+	args := []interface{}{"list"}
+	if pattern != "" {
+		args = append(args, "libraryname", pattern)
+	}
+	if withCode {
+		args = append(args, "withcode")
+	}
+	result, err := conn.DoPrimary("function", args...)
+	if err != nil {
+		return nil, err
+	}
+	infos := []LibraryInfo{}
+	for index := 0; index < result.Len(); index++ {
+		library, err := result.ResultSetAt(index)
+		if err != nil {
+			return nil, err
+		}
+		info, err := library.libraryInfo()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// FunctionDump returns the serialized payload of all
+// loaded libraries.
+func (conn *Connection) FunctionDump() ([]byte, error) {
+	value, err := conn.DoPrimary("function", "dump")
+	if err != nil {
+		return nil, err
+	}
+	payload, err := value.ValueAt(0)
+	if err != nil {
+		return nil, err
+	}
+	if err := serverError(payload); err != nil {
+		return nil, err
+	}
+	return payload.Bytes(), nil
+}
+
+// FunctionRestore restores the libraries of a payload created
+// with FunctionDump().
+func (conn *Connection) FunctionRestore(payload []byte, policy RestorePolicy) error {
+	switch policy {
+	case RestoreAppend, RestoreReplace, RestoreFlush:
+	default:
+		return errors.New(ErrInvalidConfiguration, errorMessages, "restore policy", policy)
+	}
+	value, err := conn.DoValue("function", "restore", payload, string(policy))
+	if err != nil {
+		return err
+	}
+	return serverError(value)
+}
+
+// libraryInfo converts the alternating keys and values
+// of a library description.
+func (rs *ResultSet) libraryInfo() (LibraryInfo, error) {
+	info := LibraryInfo{}
+	for index := 0; index+1 < rs.Len(); index += 2 {
+		key, err := rs.StringAt(index)
+		if err != nil {
+			return info, err
+		}
+		switch key {
+		case "library_name":
+			info.Name, err = rs.StringAt(index + 1)
+		case "engine":
+			info.Engine, err = rs.StringAt(index + 1)
+		case "library_code":
+			info.Code, err = rs.StringAt(index + 1)
+		case "functions":
+			info.Functions, err = rs.functionInfos(index + 1)
+		}
+		if err != nil {
+			return info, err
+		}
+	}
+	return info, nil
+}
+
+// functionInfos converts the nested descriptions of
+// the functions of a library.
+func (rs *ResultSet) functionInfos(index int) ([]FunctionInfo, error) {
+	functions, err := rs.ResultSetAt(index)
+	if err != nil {
+		return nil, err
+	}
+	infos := []FunctionInfo{}
+	for i := 0; i < functions.Len(); i++ {
+		function, err := functions.ResultSetAt(i)
+		if err != nil {
+			return nil, err
+		}
+		info := FunctionInfo{}
+		for j := 0; j+1 < function.Len(); j += 2 {
+			key, err := function.StringAt(j)
+			if err != nil {
+				return nil, err
+			}
+			switch key {
+			case "name":
+				info.Name, err = function.StringAt(j + 1)
+			case "description":
+				var value Value
+				value, err = function.ValueAt(j + 1)
+				if !value.IsNil() {
+					info.Description = value.String()
+				}
+			case "flags":
+				var flags *ResultSet
+				flags, err = function.ResultSetAt(j + 1)
+				if err == nil {
+					info.Flags = flags.Strings()
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// EOF
@@ -0,0 +1,146 @@
+// Tideland Go Data Management - Redis Client - Future
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// FUTURE
+//--------------------
+
+// Future contains the result sets of an asynchronous execution,
+// see db.Go() and db.GoPipeline(). They are available as soon
+// as the future is done.
+type Future struct {
+	done    chan struct{}
+	results []*ResultSet
+	err     error
+}
+
+// newFuture creates a future which is not yet done.
+func newFuture() *Future {
+	return &Future{
+		done: make(chan struct{}),
+	}
+}
+
+// Done returns a channel which is closed when the
+// execution is done.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait waits until the execution is done or the context is
+// cancelled. It returns the result set of the command, in case
+// of a pipeline the one of the first command. A cancelled wait
+// doesn't stop the execution.
+func (f *Future) Wait(ctx context.Context) (*ResultSet, error) {
+	results, err := f.WaitResults(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return newResultSet(), nil
+	}
+	return results[0], nil
+}
+
+// WaitResults works like Wait() but returns all result sets,
+// for pipelines one per command.
+func (f *Future) WaitResults(ctx context.Context) ([]*ResultSet, error) {
+	select {
+	case <-f.done:
+		return f.results, f.err
+	case <-ctx.Done():
+		return nil, errors.Annotate(ctx.Err(), ErrWaitCancelled, errorMessages)
+	}
+}
+
+// set sets the results and marks the future as done.
+func (f *Future) set(results []*ResultSet, err error) {
+	f.results = results
+	f.err = err
+	close(f.done)
+}
+
+// WaitAll waits until all futures are done and returns their
+// result sets in the same order. If one of the executions fails
+// or the context is cancelled the first error is returned.
+func WaitAll(ctx context.Context, futures ...*Future) ([]*ResultSet, error) {
+	results := make([]*ResultSet, len(futures))
+	for i, f := range futures {
+		result, err := f.Wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+// WaitAny waits until the first of the futures is done and
+// returns its index and result set. Without any futures the
+// index is -1.
+func WaitAny(ctx context.Context, futures ...*Future) (int, *ResultSet, error) {
+	if len(futures) == 0 {
+		return -1, nil, nil
+	}
+	cases := make([]reflect.SelectCase, len(futures)+1)
+	for i, f := range futures {
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(f.done)}
+	}
+	cases[len(futures)] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}
+	chosen, _, _ := reflect.Select(cases)
+	if chosen == len(futures) {
+		return -1, nil, errors.Annotate(ctx.Err(), ErrWaitCancelled, errorMessages)
+	}
+	result, err := futures[chosen].Wait(ctx)
+	return chosen, result, err
+}
+
+//--------------------
+// ASYNCHRONOUS EXECUTION
+//--------------------
+
+// goAsync runs the function in the background and sets its results
+// in the returned future. The number of parallel executions is limited
+// to the pool size.
+func (db *Database) goAsync(execute func() ([]*ResultSet, error)) *Future {
+	f := newFuture()
+	go func() {
+		db.async <- struct{}{}
+		defer func() { <-db.async }()
+		f.set(execute())
+	}()
+	return f
+}
+
+// awaitPool calls the function as long as the pool limit is reached
+// by other users, at most until the timeout of the database.
+func (db *Database) awaitPool(pull func() error) error {
+	deadline := time.Now().Add(db.timeout)
+	for {
+		err := pull()
+		if err == nil || !errors.IsError(err, ErrPoolLimitReached) || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(asyncPollInterval)
+	}
+}
+
+// EOF
@@ -0,0 +1,185 @@
+// Tideland Go Data Management - Redis Client - Geo
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// GEO LOCATION
+//--------------------
+
+// GeoLocation is one member returned by GEOSEARCH or GEORADIUS.
+// The distance, the hash, and the coordinates are only set if
+// requested with WITHDIST, WITHHASH, and WITHCOORD.
+type GeoLocation struct {
+	Member string
+	Dist   float64
+	Hash   int64
+	Lon    float64
+	Lat    float64
+}
+
+// String returs the geo location as string.
+func (gl GeoLocation) String() string {
+	return fmt.Sprintf("%s (%f / %f, %f)", gl.Member, gl.Dist, gl.Lon, gl.Lat)
+}
+
+// GeoLocations is a set of GeoLocations.
+type GeoLocations []GeoLocation
+
+// Len returns the number of geo locations in the set.
+func (gls GeoLocations) Len() int {
+	return len(gls)
+}
+
+// Members returns the members of the geo locations.
+func (gls GeoLocations) Members() []string {
+	members := make([]string, len(gls))
+	for i, gl := range gls {
+		members[i] = gl.Member
+	}
+	return members
+}
+
+// String returs the geo locations as string.
+func (gls GeoLocations) String() string {
+	glss := []string{}
+	for _, gl := range gls {
+		glss = append(glss, gl.String())
+	}
+	return fmt.Sprintf("[%s]", strings.Join(glss, " / "))
+}
+
+//--------------------
+// RESULT SET
+//--------------------
+
+// GeoLocations returns the result set as geo locations. The flags
+// have to match the options WITHDIST, WITHHASH, and WITHCOORD of the
+// command, as they define the elements of the nested result sets.
+func (rs *ResultSet) GeoLocations(withDist, withHash, withCoord bool) (GeoLocations, error) {
+	gls := GeoLocations{}
+	for index, item := range rs.items {
+		switch typedItem := item.(type) {
+		case Value:
+			// Only the member without any options.
+			gls = append(gls, GeoLocation{Member: typedItem.String()})
+		case *ResultSet:
+			gl, err := typedItem.geoLocation(withDist, withHash, withCoord)
+			if err != nil {
+				return nil, err
+			}
+			gls = append(gls, gl)
+		default:
+			return nil, errors.New(ErrIllegalItemType, errorMessages, index, "geo location")
+		}
+	}
+	return gls, nil
+}
+
+// geoLocation converts a nested result set into a geo location.
+func (rs *ResultSet) geoLocation(withDist, withHash, withCoord bool) (GeoLocation, error) {
+	gl := GeoLocation{}
+	member, err := rs.StringAt(0)
+	if err != nil {
+		return gl, err
+	}
+	gl.Member = member
+	index := 1
+	if withDist {
+		value, err := rs.ValueAt(index)
+		if err != nil {
+			return gl, err
+		}
+		if gl.Dist, err = value.Float64(); err != nil {
+			return gl, err
+		}
+		index++
+	}
+	if withHash {
+		value, err := rs.ValueAt(index)
+		if err != nil {
+			return gl, err
+		}
+		if gl.Hash, err = value.Int64(); err != nil {
+			return gl, err
+		}
+		index++
+	}
+	if withCoord {
+		coord, err := rs.ResultSetAt(index)
+		if err != nil {
+			return gl, err
+		}
+		if gl.Lon, gl.Lat, err = coord.coordinates(); err != nil {
+			return gl, err
+		}
+	}
+	return gl, nil
+}
+
+// coordinates returns the longitude and latitude of a
+// nested result set.
+func (rs *ResultSet) coordinates() (float64, float64, error) {
+	lonValue, err := rs.ValueAt(0)
+	if err != nil {
+		return 0.0, 0.0, err
+	}
+	lon, err := lonValue.Float64()
+	if err != nil {
+		return 0.0, 0.0, err
+	}
+	latValue, err := rs.ValueAt(1)
+	if err != nil {
+		return 0.0, 0.0, err
+	}
+	lat, err := latValue.Float64()
+	if err != nil {
+		return 0.0, 0.0, err
+	}
+	return lon, lat, nil
+}
+
+//--------------------
+// CONNECTION
+//--------------------
+
+// DoGeoLocations executes one of the geo search commands and
+// interpretes the result as geo locations. The options WITHDIST,
+// WITHHASH, and WITHCOORD are detected in the arguments.
+func (conn *Connection) DoGeoLocations(cmd string, args ...interface{}) (GeoLocations, error) {
+	var withDist, withHash, withCoord bool
+	for _, arg := range args {
+		if s, ok := arg.(string); ok {
+			switch strings.ToLower(s) {
+			case "withdist":
+				withDist = true
+			case "withhash":
+				withHash = true
+			case "withcoord":
+				withCoord = true
+			}
+		}
+	}
+	result, err := conn.Do(cmd, args...)
+	if err != nil {
+		return nil, err
+	}
+	return result.GeoLocations(withDist, withHash, withCoord)
+}
+
+// EOF
@@ -0,0 +1,33 @@
+// Tideland Go Data Management - Redis Client - HyperLogLog
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis
+
+//--------------------
+// HYPERLOGLOG
+//--------------------
+
+// PFAdd adds the elements to the HyperLogLog at the key. It returns
+// true if the estimated cardinality has changed.
+func (conn *Connection) PFAdd(key string, elements ...interface{}) (bool, error) {
+	return conn.DoBool("pfadd", key, elements)
+}
+
+// PFCount returns the estimated cardinality of the HyperLogLog at
+// the key or of the union of the HyperLogLogs at multiple keys.
+func (conn *Connection) PFCount(key string, keys ...string) (int, error) {
+	return conn.DoInt("pfcount", key, keys)
+}
+
+// PFMerge merges the HyperLogLogs at the source keys into the
+// one at the destination key.
+func (conn *Connection) PFMerge(destination string, sources ...string) error {
+	_, err := conn.DoOK("pfmerge", destination, sources)
+	return err
+}
+
+// EOF
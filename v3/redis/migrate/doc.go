@@ -0,0 +1,21 @@
+// Tideland Go Data Management - Redis Client - Migration
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// The migration package copies keys between Redis databases.
+//
+// Migrate() scans the source database for keys matching a pattern,
+// dumps them together with their time to live, and restores them in
+// the target database replacing existing keys. The work is done by
+// a configurable number of workers using pipelines, each needing an
+// own connection out of the pools of the databases. Export() and
+// Import() do the same using a portable file instead of one of the
+// databases, so snapshots can be kept without access to the RDB
+// files. A progress function can be set to be informed about the
+// current state, a dry run only scans the keys.
+package migrate
+
+// EOF
@@ -0,0 +1,43 @@
+// Tideland Go Data Management - Redis Client - Migration - Errors
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package migrate
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// Error codes.
+const (
+	ErrInvalidConfiguration = iota
+	ErrScanning
+	ErrDumping
+	ErrRestoring
+	ErrWritingFile
+	ErrReadingFile
+	ErrInvalidFile
+)
+
+var errorMessages = errors.Messages{
+	ErrInvalidConfiguration: "invalid configuration value in field %q: %v",
+	ErrScanning:             "cannot scan keys",
+	ErrDumping:              "cannot dump keys",
+	ErrRestoring:            "cannot restore keys",
+	ErrWritingFile:          "cannot write dump file",
+	ErrReadingFile:          "cannot read dump file",
+	ErrInvalidFile:          "invalid dump file: %s",
+}
+
+// EOF
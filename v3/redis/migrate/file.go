@@ -0,0 +1,185 @@
+// Tideland Go Data Management - Redis Client - Migration - File
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package migrate
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"sync"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// FILE FORMAT
+//--------------------
+
+// The file starts with the magic header. It's followed by the
+// records, each starting with a record marker, then the length
+// and the bytes of the key, the time to live in milliseconds,
+// and the length and the bytes of the dumped data. All numbers
+// are varints. The end marker closes the file.
+const (
+	fileHeader   = "GODM-REDIS-DUMP 1\n"
+	recordMarker = 1
+	endMarker    = 0
+)
+
+//--------------------
+// FILE WRITER
+//--------------------
+
+// fileWriter writes records into a dump file.
+type fileWriter struct {
+	mux    sync.Mutex
+	writer *bufio.Writer
+	buf    [binary.MaxVarintLen64]byte
+}
+
+// newFileWriter creates a file writer and writes the header.
+func newFileWriter(w io.Writer) (*fileWriter, error) {
+	fw := &fileWriter{
+		writer: bufio.NewWriter(w),
+	}
+	if _, err := fw.writer.WriteString(fileHeader); err != nil {
+		return nil, errors.Annotate(err, ErrWritingFile, errorMessages)
+	}
+	return fw, nil
+}
+
+// write writes the passed records.
+func (fw *fileWriter) write(records []*record) error {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	for _, rec := range records {
+		fw.writer.WriteByte(recordMarker)
+		fw.writeUvarint(uint64(len(rec.key)))
+		fw.writer.WriteString(rec.key)
+		fw.writer.Write(fw.buf[:binary.PutVarint(fw.buf[:], rec.ttl)])
+		fw.writeUvarint(uint64(len(rec.data)))
+		if _, err := fw.writer.Write(rec.data); err != nil {
+			return errors.Annotate(err, ErrWritingFile, errorMessages)
+		}
+	}
+	return nil
+}
+
+// close flushes the file. The end marker is only
+// written if the file is complete.
+func (fw *fileWriter) close(complete bool) error {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if complete {
+		fw.writer.WriteByte(endMarker)
+	}
+	if err := fw.writer.Flush(); err != nil {
+		return errors.Annotate(err, ErrWritingFile, errorMessages)
+	}
+	return nil
+}
+
+// writeUvarint writes an unsigned varint.
+func (fw *fileWriter) writeUvarint(u uint64) {
+	fw.writer.Write(fw.buf[:binary.PutUvarint(fw.buf[:], u)])
+}
+
+//--------------------
+// FILE READER
+//--------------------
+
+// fileReader reads records from a dump file.
+type fileReader struct {
+	reader *bufio.Reader
+}
+
+// newFileReader creates a file reader and checks the header.
+func newFileReader(r io.Reader) (*fileReader, error) {
+	fr := &fileReader{
+		reader: bufio.NewReader(r),
+	}
+	header := make([]byte, len(fileHeader))
+	if _, err := io.ReadFull(fr.reader, header); err != nil {
+		return nil, errors.Annotate(err, ErrReadingFile, errorMessages)
+	}
+	if string(header) != fileHeader {
+		return nil, errors.New(ErrInvalidFile, errorMessages, "unknown header")
+	}
+	return fr, nil
+}
+
+// read reads the next record. It returns nil
+// at the end of the file.
+func (fr *fileReader) read() (*record, error) {
+	marker, err := fr.reader.ReadByte()
+	if err != nil {
+		return nil, fr.readError(err)
+	}
+	switch marker {
+	case endMarker:
+		return nil, nil
+	case recordMarker:
+	default:
+		return nil, errors.New(ErrInvalidFile, errorMessages, "unknown record marker")
+	}
+	key, err := fr.readBytes()
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := binary.ReadVarint(fr.reader)
+	if err != nil {
+		return nil, fr.readError(err)
+	}
+	if ttl < 0 {
+		return nil, errors.New(ErrInvalidFile, errorMessages, "negative time to live")
+	}
+	data, err := fr.readBytes()
+	if err != nil {
+		return nil, err
+	}
+	return &record{
+		key:  string(key),
+		ttl:  ttl,
+		data: data,
+	}, nil
+}
+
+// readBytes reads a length prefixed byte slice.
+func (fr *fileReader) readBytes() ([]byte, error) {
+	length, err := binary.ReadUvarint(fr.reader)
+	if err != nil {
+		return nil, fr.readError(err)
+	}
+	if length > uint64(maxLength) {
+		return nil, errors.New(ErrInvalidFile, errorMessages, "length too large")
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(fr.reader, b); err != nil {
+		return nil, fr.readError(err)
+	}
+	return b, nil
+}
+
+// readError annotates errors while reading, an unexpected
+// end of the file means it's truncated.
+func (fr *fileReader) readError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errors.New(ErrInvalidFile, errorMessages, "truncated")
+	}
+	return errors.Annotate(err, ErrReadingFile, errorMessages)
+}
+
+// maxLength is the maximum length of a key or dumped value,
+// it's the maximum size of a Redis string.
+const maxLength = 512 * 1024 * 1024
+
+// EOF
@@ -0,0 +1,350 @@
+// Tideland Go Data Management - Redis Client - Migration
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package migrate
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"io"
+	"sync"
+
+	"github.com/tideland/goas/v3/errors"
+	"github.com/tideland/godm/v3/redis"
+)
+
+//--------------------
+// MIGRATION
+//--------------------
+
+// Migrate copies the keys matching the pattern from the source to the
+// target database. Existing keys in the target are replaced. It returns
+// the final progress. Each worker uses one connection of the source and
+// one of the target, scanning uses one more of the source. So the pool
+// size of the source has to be larger than the number of workers, see
+// redis.PoolSize().
+func Migrate(source, target *redis.Database, opts ...Option) (Progress, error) {
+	m, err := newMigration(opts)
+	if err != nil {
+		return Progress{}, err
+	}
+	batches := m.scan(source)
+	m.work(batches, func(records []*record) error {
+		if m.options.dryRun {
+			return nil
+		}
+		records, err := m.dump(source, records)
+		if err != nil {
+			return err
+		}
+		return m.restore(target, records)
+	})
+	return m.result()
+}
+
+// Export writes the keys matching the pattern of the source
+// database into a portable file. Like with Migrate() the pool
+// size of the source has to be larger than the number of workers.
+func Export(source *redis.Database, w io.Writer, opts ...Option) (Progress, error) {
+	m, err := newMigration(opts)
+	if err != nil {
+		return Progress{}, err
+	}
+	fw, err := newFileWriter(w)
+	if err != nil {
+		return Progress{}, err
+	}
+	batches := m.scan(source)
+	m.work(batches, func(records []*record) error {
+		if m.options.dryRun {
+			return nil
+		}
+		records, err := m.dump(source, records)
+		if err != nil {
+			return err
+		}
+		if err := fw.write(records); err != nil {
+			return err
+		}
+		m.update(Progress{Migrated: len(records)})
+		return nil
+	})
+	// Only a complete export gets the end marker, so
+	// that an import fails on a stopped one.
+	_, err = m.result()
+	if err := fw.close(err == nil); err != nil {
+		m.fail(err)
+	}
+	return m.result()
+}
+
+// Import restores all keys of a portable file written by
+// Export() in the target database. The pattern is not
+// used here.
+func Import(r io.Reader, target *redis.Database, opts ...Option) (Progress, error) {
+	m, err := newMigration(opts)
+	if err != nil {
+		return Progress{}, err
+	}
+	fr, err := newFileReader(r)
+	if err != nil {
+		return Progress{}, err
+	}
+	batches := m.read(fr)
+	m.work(batches, func(records []*record) error {
+		if m.options.dryRun {
+			return nil
+		}
+		return m.restore(target, records)
+	})
+	return m.result()
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// record contains one dumped key with its time to
+// live in milliseconds, 0 means no expiration.
+type record struct {
+	key  string
+	ttl  int64
+	data []byte
+}
+
+// migration contains the state of one migration.
+type migration struct {
+	options  *options
+	mux      sync.Mutex
+	progress Progress
+	stopOnce sync.Once
+	stop     chan struct{}
+	err      error
+}
+
+// newMigration creates a migration with the passed options.
+func newMigration(opts []Option) (*migration, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &migration{
+		options: o,
+		stop:    make(chan struct{}),
+	}, nil
+}
+
+// scan scans the keys of the database and sends them
+// in batches.
+func (m *migration) scan(db *redis.Database) <-chan []*record {
+	batches := make(chan []*record, m.options.workers)
+	go func() {
+		defer close(batches)
+		conn, err := db.Connection()
+		if err != nil {
+			m.fail(errors.Annotate(err, ErrScanning, errorMessages))
+			return
+		}
+		defer conn.Return()
+		cursor := 0
+		for {
+			next, result, err := conn.DoScan("scan", cursor, "match", m.options.pattern, "count", m.options.batchSize)
+			if err != nil {
+				m.fail(errors.Annotate(err, ErrScanning, errorMessages))
+				return
+			}
+			keys := result.Strings()
+			if len(keys) > 0 {
+				records := make([]*record, len(keys))
+				for i, key := range keys {
+					records[i] = &record{key: key}
+				}
+				m.update(Progress{Scanned: len(keys)})
+				select {
+				case batches <- records:
+				case <-m.stop:
+					return
+				}
+			}
+			if next == 0 {
+				return
+			}
+			cursor = next
+		}
+	}()
+	return batches
+}
+
+// read reads the records of a file and sends them in batches.
+func (m *migration) read(fr *fileReader) <-chan []*record {
+	batches := make(chan []*record, m.options.workers)
+	go func() {
+		defer close(batches)
+		for {
+			records := []*record{}
+			for len(records) < m.options.batchSize {
+				rec, err := fr.read()
+				if err != nil {
+					m.fail(err)
+					return
+				}
+				if rec == nil {
+					break
+				}
+				records = append(records, rec)
+			}
+			if len(records) == 0 {
+				return
+			}
+			m.update(Progress{Scanned: len(records)})
+			select {
+			case batches <- records:
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+	return batches
+}
+
+// work lets the configured number of workers process the batches.
+func (m *migration) work(batches <-chan []*record, process func([]*record) error) {
+	var wg sync.WaitGroup
+	for i := 0; i < m.options.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for records := range batches {
+				if err := process(records); err != nil {
+					m.fail(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// dump retrieves the dumped data and the time to live of the
+// records. Keys not existing anymore are skipped, keys the
+// server can't dump count as failed.
+func (m *migration) dump(db *redis.Database, records []*record) ([]*record, error) {
+	ppl, err := db.Pipeline()
+	if err != nil {
+		return nil, errors.Annotate(err, ErrDumping, errorMessages)
+	}
+	for _, rec := range records {
+		ppl.Do("dump", rec.key)
+		ppl.Do("pttl", rec.key)
+	}
+	results, err := ppl.Collect()
+	if err != nil {
+		return nil, errors.Annotate(err, ErrDumping, errorMessages)
+	}
+	dumped := []*record{}
+	skipped := 0
+	failed := 0
+	for i, rec := range records {
+		data, err := results[i*2].ValueAt(0)
+		if err != nil {
+			return nil, errors.Annotate(err, ErrDumping, errorMessages)
+		}
+		ttl, err := results[i*2+1].IntAt(0)
+		if err != nil {
+			return nil, errors.Annotate(err, ErrDumping, errorMessages)
+		}
+		if isServerError(data) {
+			failed++
+			continue
+		}
+		if data.IsNil() || ttl == -2 {
+			// Key vanished in the meantime.
+			skipped++
+			continue
+		}
+		if ttl < 0 {
+			ttl = 0
+		}
+		rec.ttl = int64(ttl)
+		rec.data = data.Bytes()
+		dumped = append(dumped, rec)
+	}
+	m.update(Progress{Skipped: skipped, Failed: failed})
+	return dumped, nil
+}
+
+// restore restores the records in the database.
+func (m *migration) restore(db *redis.Database, records []*record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	ppl, err := db.Pipeline()
+	if err != nil {
+		return errors.Annotate(err, ErrRestoring, errorMessages)
+	}
+	for _, rec := range records {
+		ppl.Do("restore", rec.key, rec.ttl, rec.data, "replace")
+	}
+	results, err := ppl.Collect()
+	if err != nil {
+		return errors.Annotate(err, ErrRestoring, errorMessages)
+	}
+	migrated := 0
+	failed := 0
+	for _, result := range results {
+		value, err := result.ValueAt(0)
+		if err != nil || !value.IsOK() {
+			failed++
+			continue
+		}
+		migrated++
+	}
+	m.update(Progress{Migrated: migrated, Failed: failed})
+	return nil
+}
+
+// isServerError checks if the value is an error reply of the
+// server. Dumped data never starts with the error marker, its
+// first byte is the type of the value.
+func isServerError(value redis.Value) bool {
+	return len(value) > 0 && value[0] == '-'
+}
+
+// update adds the passed numbers to the progress and
+// reports it.
+func (m *migration) update(p Progress) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.progress.Scanned += p.Scanned
+	m.progress.Migrated += p.Migrated
+	m.progress.Skipped += p.Skipped
+	m.progress.Failed += p.Failed
+	if m.options.progress != nil {
+		m.options.progress(m.progress)
+	}
+}
+
+// fail stops the migration with the first error.
+func (m *migration) fail(err error) {
+	m.stopOnce.Do(func() {
+		m.mux.Lock()
+		defer m.mux.Unlock()
+		m.err = err
+		close(m.stop)
+	})
+}
+
+// result returns the final progress and error.
+func (m *migration) result() (Progress, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.progress, m.err
+}
+
+// EOF
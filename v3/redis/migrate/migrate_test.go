@@ -0,0 +1,211 @@
+// Tideland Go Data Management - Redis Client - Migration - Unit Tests
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package migrate_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tideland/godm/v3/redis"
+	"github.com/tideland/godm/v3/redis/migrate"
+	"github.com/tideland/godm/v3/redis/redistest"
+	"github.com/tideland/gots/v3/asserts"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+func TestMigrate(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	source, sconn, srestore := openDatabase(assert, testSourceIndex)
+	defer srestore()
+	target, tconn, trestore := openDatabase(assert, testTargetIndex)
+	defer trestore()
+	fillDatabase(assert, sconn)
+
+	// Dry run only scans.
+	progress, err := migrate.Migrate(source, target, migrate.Match("migrate:*"), migrate.DryRun())
+	assert.Nil(err)
+	assert.Equal(progress.Scanned, 110)
+	assert.Equal(progress.Migrated, 0)
+	size, err := tconn.Do("dbsize")
+	assert.Nil(err)
+	keys, err := size.IntAt(0)
+	assert.Nil(err)
+	assert.Equal(keys, 0)
+
+	// Now migrate the matching keys.
+	reported := 0
+	progress, err = migrate.Migrate(source, target,
+		migrate.Match("migrate:*"),
+		migrate.Workers(3),
+		migrate.BatchSize(7),
+		migrate.ReportProgress(func(p migrate.Progress) {
+			reported++
+		}))
+	assert.Nil(err)
+	assert.Equal(progress, migrate.Progress{Scanned: 110, Migrated: 110})
+	assert.True(reported > 0)
+	checkDatabase(assert, tconn)
+	exists, err := tconn.Do("exists", "other")
+	assert.Nil(err)
+	found, err := exists.BoolAt(0)
+	assert.Nil(err)
+	assert.False(found)
+}
+
+func TestExportImport(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	source, sconn, srestore := openDatabase(assert, testSourceIndex)
+	defer srestore()
+	target, tconn, trestore := openDatabase(assert, testTargetIndex)
+	defer trestore()
+	fillDatabase(assert, sconn)
+
+	// Export into a buffer.
+	buf := &bytes.Buffer{}
+	progress, err := migrate.Export(source, buf, migrate.Match("migrate:*"), migrate.BatchSize(10))
+	assert.Nil(err)
+	assert.Equal(progress.Migrated, 110)
+
+	// Import into the target.
+	data := buf.Bytes()
+	progress, err = migrate.Import(bytes.NewReader(data), target)
+	assert.Nil(err)
+	assert.Equal(progress, migrate.Progress{Scanned: 110, Migrated: 110})
+	checkDatabase(assert, tconn)
+
+	// Invalid files.
+	_, err = migrate.Import(bytes.NewBufferString("no dump file"), target)
+	assert.ErrorMatch(err, `.* invalid dump file: unknown header`)
+	_, err = migrate.Import(bytes.NewReader(data[:len(data)/2]), target)
+	assert.ErrorMatch(err, `.* invalid dump file: truncated`)
+}
+
+func TestExportFailures(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	srv, err := redistest.NewServer()
+	assert.Nil(err)
+	defer srv.Close()
+	db, err := redis.Open(redis.TcpConnection(srv.Addr(), 0), redis.Index(testSourceIndex, ""))
+	assert.Nil(err)
+	defer db.Close()
+	conn, err := db.Connection()
+	assert.Nil(err)
+	for i := 0; i < 3; i++ {
+		_, err = conn.Do("set", fmt.Sprintf("migrate:string:%d", i), i)
+		assert.Nil(err)
+	}
+	conn.Return()
+
+	// The fake server answers DUMP with an error.
+	buf := &bytes.Buffer{}
+	progress, err := migrate.Export(db, buf, migrate.Match("migrate:*"))
+	assert.Nil(err)
+	assert.Equal(progress, migrate.Progress{Scanned: 3, Failed: 3})
+	progress, err = migrate.Import(bytes.NewReader(buf.Bytes()), db)
+	assert.Nil(err)
+	assert.Equal(progress, migrate.Progress{})
+
+	// A stopped export has no end marker.
+	srv.Close()
+	buf.Reset()
+	_, err = migrate.Export(db, buf)
+	assert.NotNil(err)
+	_, err = migrate.Import(bytes.NewReader(buf.Bytes()), db)
+	assert.ErrorMatch(err, `.* invalid dump file: truncated`)
+}
+
+func TestInvalidOptions(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	_, err := migrate.Migrate(nil, nil, migrate.Workers(-1))
+	assert.ErrorMatch(err, `.* invalid configuration value in field "workers": -1`)
+	_, err = migrate.Migrate(nil, nil, migrate.BatchSize(-1))
+	assert.ErrorMatch(err, `.* invalid configuration value in field "batch size": -1`)
+}
+
+//--------------------
+// TOOLS
+//--------------------
+
+const (
+	testSourceIndex = 98
+	testTargetIndex = 99
+)
+
+// openDatabase opens and flushes the database with the given
+// index and returns it, a connection, and a function for closing.
+func openDatabase(assert asserts.Assertion, index int) (*redis.Database, *redis.Connection, func()) {
+	db, err := redis.Open(redis.Index(index, ""))
+	assert.Nil(err)
+	conn, err := db.Connection()
+	assert.Nil(err)
+	_, err = conn.Do("flushdb")
+	assert.Nil(err)
+	return db, conn, func() {
+		conn.Return()
+		db.Close()
+	}
+}
+
+// fillDatabase writes strings, lists, and hashes, some of them
+// with expiration, and one key not matching the pattern.
+func fillDatabase(assert asserts.Assertion, conn *redis.Connection) {
+	for i := 0; i < 50; i++ {
+		_, err := conn.Do("set", fmt.Sprintf("migrate:string:%d", i), i)
+		assert.Nil(err)
+		_, err = conn.Do("rpush", fmt.Sprintf("migrate:list:%d", i), "a", "b", i)
+		assert.Nil(err)
+	}
+	for i := 0; i < 10; i++ {
+		_, err := conn.Do("hset", fmt.Sprintf("migrate:hash:%d", i), "field", i)
+		assert.Nil(err)
+		_, err = conn.Do("expire", fmt.Sprintf("migrate:hash:%d", i), time.Hour/time.Second)
+		assert.Nil(err)
+	}
+	_, err := conn.Do("set", "other", "value")
+	assert.Nil(err)
+}
+
+// checkDatabase checks if the keys of fillDatabase() are in
+// the database.
+func checkDatabase(assert asserts.Assertion, conn *redis.Connection) {
+	value, err := conn.Do("get", "migrate:string:42")
+	assert.Nil(err)
+	s, err := value.StringAt(0)
+	assert.Nil(err)
+	assert.Equal(s, "42")
+	list, err := conn.Do("lrange", "migrate:list:7", 0, -1)
+	assert.Nil(err)
+	assert.Equal(list.Strings(), []string{"a", "b", "7"})
+	field, err := conn.Do("hget", "migrate:hash:3", "field")
+	assert.Nil(err)
+	s, err = field.StringAt(0)
+	assert.Nil(err)
+	assert.Equal(s, "3")
+	ttl, err := conn.Do("ttl", "migrate:hash:3")
+	assert.Nil(err)
+	seconds, err := ttl.IntAt(0)
+	assert.Nil(err)
+	assert.True(seconds > 0 && seconds <= 3600)
+	ttl, err = conn.Do("ttl", "migrate:string:42")
+	assert.Nil(err)
+	seconds, err = ttl.IntAt(0)
+	assert.Nil(err)
+	assert.Equal(seconds, -1)
+}
+
+// EOF
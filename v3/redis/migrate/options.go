@@ -0,0 +1,126 @@
+// Tideland Go Data Management - Redis Client - Migration - Options
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package migrate
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// OPTIONS
+//--------------------
+
+const (
+	defaultPattern   = "*"
+	defaultWorkers   = 4
+	defaultBatchSize = 100
+)
+
+// Progress contains the numbers of keys handled so far.
+type Progress struct {
+	Scanned  int
+	Migrated int
+	Skipped  int
+	Failed   int
+}
+
+// ProgressFunc is called each time a batch of keys is done.
+type ProgressFunc func(p Progress)
+
+// options contains the configuration of a migration.
+type options struct {
+	pattern   string
+	workers   int
+	batchSize int
+	dryRun    bool
+	progress  ProgressFunc
+}
+
+// Option defines a function setting an option.
+type Option func(o *options) error
+
+// Match sets the pattern for the keys to migrate. The
+// default is "*".
+func Match(pattern string) Option {
+	return func(o *options) error {
+		if pattern == "" {
+			pattern = defaultPattern
+		}
+		o.pattern = pattern
+		return nil
+	}
+}
+
+// Workers sets the number of concurrent workers. The
+// default is 4. Each one needs an own connection of the
+// pools of the databases.
+func Workers(workers int) Option {
+	return func(o *options) error {
+		if workers < 0 {
+			return errors.New(ErrInvalidConfiguration, errorMessages, "workers", workers)
+		} else if workers == 0 {
+			workers = defaultWorkers
+		}
+		o.workers = workers
+		return nil
+	}
+}
+
+// BatchSize sets the number of keys scanned and pipelined
+// at once. The default is 100.
+func BatchSize(size int) Option {
+	return func(o *options) error {
+		if size < 0 {
+			return errors.New(ErrInvalidConfiguration, errorMessages, "batch size", size)
+		} else if size == 0 {
+			size = defaultBatchSize
+		}
+		o.batchSize = size
+		return nil
+	}
+}
+
+// DryRun lets the migration only scan the keys without
+// dumping and restoring them.
+func DryRun() Option {
+	return func(o *options) error {
+		o.dryRun = true
+		return nil
+	}
+}
+
+// ReportProgress sets a function which is called after
+// each batch of keys with the current progress.
+func ReportProgress(f ProgressFunc) Option {
+	return func(o *options) error {
+		o.progress = f
+		return nil
+	}
+}
+
+// newOptions creates the options with the defaults
+// and applies the passed ones.
+func newOptions(opts []Option) (*options, error) {
+	o := &options{
+		pattern:   defaultPattern,
+		workers:   defaultWorkers,
+		batchSize: defaultBatchSize,
+	}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// EOF
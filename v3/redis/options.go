@@ -12,6 +12,8 @@ package redis
 //--------------------
 
 import (
+	"crypto/tls"
+	"strings"
 	"time"
 
 	"github.com/tideland/goas/v3/errors"
@@ -31,6 +33,16 @@ const (
 	defaultPoolSize   = 10
 	defaultLogging    = false
 	defaultMonitoring = false
+
+	defaultRetryAttempts   = 3
+	defaultRetryBackoff    = 50 * time.Millisecond
+	defaultRetryMaxBackoff = 5 * time.Second
+
+	defaultReplicaDowntime = 30 * time.Second
+
+	blockingMargin = time.Second
+
+	asyncPollInterval = 10 * time.Millisecond
 )
 
 // Option defines a function setting an option.
@@ -87,6 +99,25 @@ func Index(index int, password string) Option {
 	}
 }
 
+// Username sets the username for the authentication with the
+// password set by Index(). It's needed if the server uses access
+// control lists.
+func Username(username string) Option {
+	return func(d *Database) error {
+		d.username = username
+		return nil
+	}
+}
+
+// TLS sets the configuration for TCP connections using TLS. If
+// the server name isn't set it's taken from the address.
+func TLS(config *tls.Config) Option {
+	return func(d *Database) error {
+		d.tls = config
+		return nil
+	}
+}
+
 // PoolSize sets the pool size of the database. The default is 10.
 func PoolSize(poolsize int) Option {
 	return func(d *Database) error {
@@ -100,6 +131,67 @@ func PoolSize(poolsize int) Option {
 	}
 }
 
+// Retry sets a policy for the retrying of commands if the connection
+// to the server is broken. A command is executed up to attempts times,
+// the waiting time between two attempts starts with backoff and doubles
+// each time. Only read-only commands like GET, HGETALL, or ZRANGE are
+// retried. Write commands known to be idempotent can be added by
+// passing their names. By default commands are not retried, the
+// default values for a set policy are 3 attempts and 50 milliseconds.
+func Retry(attempts int, backoff time.Duration, idempotent ...string) Option {
+	return func(d *Database) error {
+		if attempts < 0 {
+			return errors.New(ErrInvalidConfiguration, errorMessages, "retry attempts", attempts)
+		} else if attempts == 0 {
+			attempts = defaultRetryAttempts
+		}
+		if backoff < 0 {
+			return errors.New(ErrInvalidConfiguration, errorMessages, "retry backoff", backoff)
+		} else if backoff == 0 {
+			backoff = defaultRetryBackoff
+		}
+		d.retry = newRetryPolicy(attempts, backoff, idempotent)
+		return nil
+	}
+}
+
+// ReplicaSelection defines how the replica for the
+// execution of a read-only command is selected.
+type ReplicaSelection int
+
+// Selections of replicas.
+const (
+	RoundRobin ReplicaSelection = iota
+	LeastLoaded
+)
+
+// Replicas sets the addresses of replicas of the database. They use
+// the same network, timeout, index, and password like the primary.
+// Read-only commands are executed on the replicas, selected round
+// robin or by the least number of connections in use. If a replica
+// fails it won't be used for the downtime, default are 30 seconds.
+func Replicas(selection ReplicaSelection, downtime time.Duration, addresses ...string) Option {
+	return func(d *Database) error {
+		if selection != RoundRobin && selection != LeastLoaded {
+			return errors.New(ErrInvalidConfiguration, errorMessages, "replica selection", selection)
+		}
+		if downtime < 0 {
+			return errors.New(ErrInvalidConfiguration, errorMessages, "replica downtime", downtime)
+		} else if downtime == 0 {
+			downtime = defaultReplicaDowntime
+		}
+		for _, address := range addresses {
+			if address == "" {
+				return errors.New(ErrInvalidConfiguration, errorMessages, "replica address", address)
+			}
+		}
+		d.replicaAddresses = addresses
+		d.replicaSelection = selection
+		d.replicaDowntime = downtime
+		return nil
+	}
+}
+
 // Monitoring sets logging and monitoring, logging and
 // monitoring are switched off by default.
 func Monitoring(logging, monitoring bool) Option {
@@ -110,4 +202,53 @@ func Monitoring(logging, monitoring bool) Option {
 	}
 }
 
+//--------------------
+// RETRY POLICY
+//--------------------
+
+// retryPolicy defines how often and which commands are
+// retried if the connection is broken. Beside the read-only
+// commands these are the ones marked as idempotent.
+type retryPolicy struct {
+	attempts int
+	backoff  time.Duration
+	commands map[string]bool
+}
+
+// newRetryPolicy creates a retry policy for the passed
+// idempotent commands.
+func newRetryPolicy(attempts int, backoff time.Duration, idempotent []string) *retryPolicy {
+	rp := &retryPolicy{
+		attempts: attempts,
+		backoff:  backoff,
+		commands: make(map[string]bool),
+	}
+	for _, cmd := range idempotent {
+		rp.commands[strings.ToLower(cmd)] = true
+	}
+	return rp
+}
+
+// allows checks if the command may be executed again
+// after the given number of failed attempts.
+func (rp *retryPolicy) allows(cmd string, readOnly bool, failed int) bool {
+	if rp == nil || failed >= rp.attempts {
+		return false
+	}
+	return readOnly || rp.commands[cmd]
+}
+
+// wait sleeps the backoff time for the given number
+// of failed attempts.
+func (rp *retryPolicy) wait(failed int) {
+	backoff := rp.backoff
+	for i := 1; i < failed && backoff < defaultRetryMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > defaultRetryMaxBackoff {
+		backoff = defaultRetryMaxBackoff
+	}
+	time.Sleep(backoff)
+}
+
 // EOF
@@ -27,8 +27,10 @@ import (
 // pipelined commands.
 type Pipeline struct {
 	database *Database
-	resp     *resp
+	resp     *protocol
 	counter  int
+	err      error
+	lost     error
 }
 
 // newPipeline creates a new pipeline instance.
@@ -40,20 +42,6 @@ func newPipeline(db *Database) (*Pipeline, error) {
 	if err != nil {
 		return nil, err
 	}
-	// Perform authentication and database selection.
-	if err != nil {
-		return nil, err
-	}
-	err = ppl.resp.authenticate()
-	if err != nil {
-		ppl.database.pool.kill(ppl.resp)
-		return nil, err
-	}
-	err = ppl.resp.selectDatabase()
-	if err != nil {
-		ppl.database.pool.kill(ppl.resp)
-		return nil, err
-	}
 	return ppl, nil
 }
 
@@ -61,8 +49,11 @@ func newPipeline(db *Database) (*Pipeline, error) {
 // the result as result set.
 func (ppl *Pipeline) Do(cmd string, args ...interface{}) error {
 	cmd = strings.ToLower(cmd)
-	if strings.Contains(cmd, "subscribe") {
-		return errors.New(ErrUseSubscription, errorMessages)
+	if ppl.database.commands.is(cmd, FlagSubscribe) {
+		return ppl.fail(errors.New(ErrUseSubscription, errorMessages))
+	}
+	if ppl.lost != nil {
+		return ppl.lost
 	}
 	err := ppl.ensureProtocol()
 	if err != nil {
@@ -75,18 +66,30 @@ func (ppl *Pipeline) Do(cmd string, args ...interface{}) error {
 	err = ppl.resp.sendCommand(cmd, args...)
 	logCommand(cmd, args, err, ppl.database.logging)
 	if err != nil {
-		return err
+		if errors.IsError(err, ErrConnectionBroken) {
+			// The command may be written partially, so the
+			// connection and the commands sent before are lost.
+			ppl.database.pool.kill(ppl.resp)
+			ppl.resp = nil
+			ppl.lost = err
+		}
+		return ppl.fail(err)
 	}
 	ppl.counter++
 	return err
 }
 
 // Collect collects all the result sets of the commands and returns
-// the connection back into the pool.
+// the connection back into the pool. If the connection has been lost
+// while sending a command its error is returned.
 func (ppl *Pipeline) Collect() ([]*ResultSet, error) {
 	defer func() {
 		ppl.resp = nil
+		ppl.lost = nil
 	}()
+	if ppl.lost != nil {
+		return nil, ppl.lost
+	}
 	err := ppl.ensureProtocol()
 	if err != nil {
 		return nil, err
@@ -104,15 +107,33 @@ func (ppl *Pipeline) Collect() ([]*ResultSet, error) {
 	return results, nil
 }
 
-// ensureProtocol retrieves a protocol from the pool if needed.
+// fail keeps the first error of the commands for
+// asynchronous pipelines and returns it.
+func (ppl *Pipeline) fail(err error) error {
+	if ppl.err == nil {
+		ppl.err = err
+	}
+	return err
+}
+
+// ensureProtocol retrieves a protocol from the pool if needed
+// and performs authentication and database selection if it's
+// not yet done.
 func (ppl *Pipeline) ensureProtocol() error {
 	if ppl.resp == nil {
 		p, err := ppl.database.pool.pull(false)
 		if err != nil {
 			return err
 		}
+		if !p.ready {
+			if err = p.handshake(); err != nil {
+				ppl.database.pool.kill(p)
+				return err
+			}
+		}
 		ppl.resp = p
 		ppl.counter = 0
+		ppl.err = nil
 	}
 	return nil
 }
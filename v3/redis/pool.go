@@ -30,17 +30,19 @@ const (
 type pool struct {
 	mux       sync.Mutex
 	database  *Database
-	available map[*resp]*resp
-	inUse     map[*resp]*resp
+	address   string
+	available map[*protocol]*protocol
+	inUse     map[*protocol]*protocol
 }
 
 // newPool creates a connection pool with uninitialized
-// protocol instances.
-func newPool(db *Database) *pool {
+// protocol instances for the given address.
+func newPool(db *Database, address string) *pool {
 	return &pool{
 		database:  db,
-		available: make(map[*resp]*resp),
-		inUse:     make(map[*resp]*resp),
+		address:   address,
+		available: make(map[*protocol]*protocol),
+		inUse:     make(map[*protocol]*protocol),
 	}
 }
 
@@ -65,12 +67,13 @@ func (p *pool) close() error {
 // pull returns a protocol out of the pool. If none is available
 // but the configured pool sized isn't reached a new one will be
 // established.
-func (p *pool) pull(forced bool) (*resp, error) {
+func (p *pool) pull(forced bool) (*protocol, error) {
 	p.mux.Lock()
 	defer p.mux.Unlock()
 	// Check if connections are available.
 	if len(p.available) > 0 {
 		for conn := range p.available {
+			delete(p.available, conn)
 			p.inUse[conn] = conn
 			return conn, nil
 		}
@@ -78,7 +81,7 @@ func (p *pool) pull(forced bool) (*resp, error) {
 	// No connection available, so create a new one if not all
 	// in use or the creation is forced.
 	if len(p.inUse) < p.database.poolsize || forced {
-		resp, err := newResp(p.database)
+		resp, err := newProtocol(p.database, p.address)
 		if err != nil {
 			return nil, err
 		}
@@ -89,7 +92,7 @@ func (p *pool) pull(forced bool) (*resp, error) {
 }
 
 // push returns a protocol back into the pool.
-func (p *pool) push(resp *resp) error {
+func (p *pool) push(resp *protocol) error {
 	p.mux.Lock()
 	defer p.mux.Unlock()
 	delete(p.inUse, resp)
@@ -100,8 +103,15 @@ func (p *pool) push(resp *resp) error {
 	return resp.close()
 }
 
+// load returns the number of protocols in use.
+func (p *pool) load() int {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return len(p.inUse)
+}
+
 // kill closes the connection and removes it from the pool.
-func (p *pool) kill(resp *resp) error {
+func (p *pool) kill(resp *protocol) error {
 	p.mux.Lock()
 	defer p.mux.Unlock()
 	delete(p.inUse, resp)
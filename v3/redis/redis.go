@@ -12,8 +12,13 @@ package redis
 //--------------------
 
 import (
+	"crypto/tls"
+	stderrors "errors"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/tideland/goas/v3/errors"
 )
 
 //--------------------
@@ -27,11 +32,21 @@ type Database struct {
 	network    string
 	timeout    time.Duration
 	index      int
+	username   string
 	password   string
+	tls        *tls.Config
 	poolsize   int
 	logging    bool
 	monitoring bool
+	retry      *retryPolicy
+	commands   *commandTable
 	pool       *pool
+	async      chan struct{}
+
+	replicaAddresses []string
+	replicaSelection ReplicaSelection
+	replicaDowntime  time.Duration
+	replicas         *replicaSet
 }
 
 // Open opens the connection to a Redis database based on the
@@ -52,7 +67,12 @@ func Open(options ...Option) (*Database, error) {
 			return nil, err
 		}
 	}
-	db.pool = newPool(db)
+	db.commands = newCommandTable()
+	db.pool = newPool(db, db.address)
+	db.async = make(chan struct{}, db.poolsize)
+	if len(db.replicaAddresses) > 0 {
+		db.replicas = newReplicaSet(db)
+	}
 	return db, nil
 }
 
@@ -73,6 +93,55 @@ func (db *Database) Pipeline() (*Pipeline, error) {
 	return newPipeline(db)
 }
 
+// Go executes the command asynchronously on one of the pooled
+// connections. The result set is retrieved with the returned future.
+// At most as many commands as the pool size are executed in parallel,
+// the others wait.
+func (db *Database) Go(cmd string, args ...interface{}) *Future {
+	return db.goAsync(func() ([]*ResultSet, error) {
+		var conn *Connection
+		err := db.awaitPool(func() (err error) {
+			conn, err = db.Connection()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Return()
+		result, err := conn.Do(cmd, args...)
+		if err != nil {
+			return nil, err
+		}
+		return []*ResultSet{result}, nil
+	})
+}
+
+// GoPipeline executes the function asynchronously on one of the
+// pooled connections running in pipeline mode. The commands of the
+// pipeline are collected afterwards, the result sets are retrieved
+// with the returned future.
+func (db *Database) GoPipeline(f func(ppl *Pipeline)) *Future {
+	return db.goAsync(func() ([]*ResultSet, error) {
+		var ppl *Pipeline
+		err := db.awaitPool(func() (err error) {
+			ppl, err = db.Pipeline()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		f(ppl)
+		results, err := ppl.Collect()
+		if err != nil {
+			return nil, err
+		}
+		if ppl.err != nil {
+			return nil, ppl.err
+		}
+		return results, nil
+	})
+}
+
 // Subscription returns a subscription with a connection to the
 // Redis server. It has to be closed with sub.Close() after usage.
 func (db *Database) Subscription() (*Subscription, error) {
@@ -81,11 +150,42 @@ func (db *Database) Subscription() (*Subscription, error) {
 	return newSubscription(db)
 }
 
-// Close closes the database client.
+// Publish publishes the value to the channel and returns the number
+// of subscribers having received it. Strings, byte slices, and values
+// are published unchanged, all other values are encoded as JSON. See
+// NewSubscriber() for the decoding.
+func (db *Database) Publish(channel string, value interface{}) (int, error) {
+	payload, err := encodePayload(value)
+	if err != nil {
+		return 0, errors.Annotate(err, ErrEncodePayload, errorMessages, channel)
+	}
+	conn, err := db.Connection()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Return()
+	return conn.DoInt("publish", channel, payload)
+}
+
+// CommandInfo returns the info about the command. It's taken
+// from the built-in table or a refreshed one, see
+// conn.RefreshCommands().
+func (db *Database) CommandInfo(cmd string) (CommandInfo, bool) {
+	return db.commands.lookup(strings.ToLower(cmd))
+}
+
+// Close closes the database client. The pools of the
+// primary and the replicas are closed even if one fails,
+// the errors are combined.
 func (db *Database) Close() error {
 	db.mux.Lock()
 	defer db.mux.Unlock()
-	return db.pool.close()
+	var errs []error
+	if db.replicas != nil {
+		errs = append(errs, db.replicas.close())
+	}
+	errs = append(errs, db.pool.close())
+	return stderrors.Join(errs...)
 }
 
 // EOF
@@ -12,10 +12,17 @@ package redis_test
 //--------------------
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"testing"
+	"time"
 
 	"github.com/tideland/goas/v2/logger"
+	"github.com/tideland/goas/v3/errors"
 	"github.com/tideland/godm/v3/redis"
+	"github.com/tideland/godm/v3/redis/redistest"
+	"github.com/tideland/godm/v3/redisurl"
 	"github.com/tideland/gots/V3/asserts"
 )
 
@@ -61,6 +68,29 @@ func TestTcpConnection(t *testing.T) {
 	assertEqualString(assert, result, 0, "+PONG")
 }
 
+func TestURLConnection(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	t.Setenv("REDIS_TEST_URL", fmt.Sprintf("redis://127.0.0.1:6379/%d", testDatabaseIndex))
+	t.Setenv("REDIS_TEST_POOL_SIZE", "5")
+
+	options, err := redis.OptionsFromEnv("redis_test")
+	assert.Nil(err)
+	db, err := redis.Open(options...)
+	assert.Nil(err)
+	defer db.Close()
+	conn, err := db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+	result, err := conn.Do("ping")
+	assert.Nil(err)
+	assertEqualString(assert, result, 0, "+PONG")
+
+	_, err = redis.ParseURL("redis://127.0.0.1/x?timeout=soon")
+	report, ok := err.(redisurl.Report)
+	assert.True(ok)
+	assert.Length(report, 2)
+}
+
 func BenchmarkTcpConnection(b *testing.B) {
 	assert := asserts.NewTestingAssertion(b, true)
 	conn, restore := connectDatabase(assert, redis.TcpConnection("", 0))
@@ -73,6 +103,18 @@ func BenchmarkTcpConnection(b *testing.B) {
 	}
 }
 
+func BenchmarkCommandEncoding(b *testing.B) {
+	send := redis.NewCommandWriter(io.Discard)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		err := send("hmset", "bench:hash", "a", "foo", "b", i, "c", 3.3, "d", true)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func TestPipelining(t *testing.T) {
 	assert := asserts.NewTestingAssertion(t, true)
 	ppl, restore := pipelineDatabase(assert)
@@ -90,6 +132,87 @@ func TestPipelining(t *testing.T) {
 	for _, result := range results {
 		assertEqualString(assert, result, 0, "+PONG")
 	}
+
+	// A partially written command loses the connection.
+	err = ppl.Do("ping")
+	assert.Nil(err)
+	err = ppl.Do("set", "ppl:flaky", []interface{}{&flakyEncoder{}})
+	assert.True(errors.IsError(err, redis.ErrConnectionBroken))
+	err = ppl.Do("ping")
+	assert.True(errors.IsError(err, redis.ErrConnectionBroken))
+	_, err = ppl.Collect()
+	assert.True(errors.IsError(err, redis.ErrConnectionBroken))
+
+	err = ppl.Do("ping")
+	assert.Nil(err)
+	results, err = ppl.Collect()
+	assert.Nil(err)
+	assert.Length(results, 1)
+}
+
+func TestFutures(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	db, err := redis.Open(redis.Index(testDatabaseIndex, ""), redis.PoolSize(5))
+	assert.Nil(err)
+	defer db.Close()
+	ctx := context.Background()
+
+	_, err = db.Go("flushdb").Wait(ctx)
+	assert.Nil(err)
+
+	// Fan-out with more futures than pooled connections.
+	futures := []*redis.Future{}
+	for i := 0; i < 50; i++ {
+		futures = append(futures, db.Go("set", fmt.Sprintf("future:%d", i), i))
+	}
+	_, err = redis.WaitAll(ctx, futures...)
+	assert.Nil(err)
+	futures = []*redis.Future{}
+	for i := 0; i < 50; i++ {
+		futures = append(futures, db.Go("get", fmt.Sprintf("future:%d", i)))
+	}
+	results, err := redis.WaitAll(ctx, futures...)
+	assert.Nil(err)
+	assert.Length(results, 50)
+	for i, result := range results {
+		assertEqualInt(assert, result, 0, i)
+	}
+
+	// Pipeline.
+	fut := db.GoPipeline(func(ppl *redis.Pipeline) {
+		ppl.Do("incr", "future:counter")
+		ppl.Do("incr", "future:counter")
+		ppl.Do("get", "future:counter")
+	})
+	<-fut.Done()
+	results, err = fut.WaitResults(ctx)
+	assert.Nil(err)
+	assert.Length(results, 3)
+	assertEqualInt(assert, results[2], 0, 2)
+
+	// Any and cancelled waiting.
+	slow := db.Go("blpop", "future:empty", 1)
+	fast := db.Go("ping")
+	index, result, err := redis.WaitAny(ctx, slow, fast)
+	assert.Nil(err)
+	assert.Equal(index, 1)
+	assertEqualString(assert, result, 0, "+PONG")
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, err = slow.Wait(timeoutCtx)
+	assert.True(errors.IsError(err, redis.ErrWaitCancelled))
+	result, err = slow.Wait(ctx)
+	assert.Nil(err)
+	assert.True(result.IsNil())
+
+	// Errors.
+	_, err = db.Go("set", "future:error").Wait(ctx)
+	assert.True(errors.IsError(err, redis.ErrInvalidArity))
+	_, err = db.GoPipeline(func(ppl *redis.Pipeline) {
+		ppl.Do("subscribe", "future")
+		ppl.Do("ping")
+	}).WaitResults(ctx)
+	assert.True(errors.IsError(err, redis.ErrUseSubscription))
 }
 
 func BenchmarkPipelining(b *testing.B) {
@@ -110,6 +233,79 @@ func BenchmarkPipelining(b *testing.B) {
 	}
 }
 
+func TestRetry(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	conn, restore := connectDatabase(assert, redis.Retry(3, 10*time.Millisecond))
+	defer restore()
+	killer, killerRestore := connectDatabase(assert)
+	defer killerRestore()
+
+	ok, err := conn.DoOK("set", "retry:a", "foo")
+	assert.Nil(err)
+	assert.True(ok)
+
+	// Read-only commands are retried on a new connection.
+	killClient(assert, conn, killer)
+	value, err := conn.DoString("get", "retry:a")
+	assert.Nil(err)
+	assert.Equal(value, "foo")
+
+	// Write commands are not retried.
+	killClient(assert, conn, killer)
+	_, err = conn.Do("incr", "retry:b")
+	assert.True(errors.IsError(err, redis.ErrConnectionBroken))
+	valueB, err := conn.DoInt("incr", "retry:b")
+	assert.Nil(err)
+	assert.Equal(valueB, 1)
+}
+
+func TestConnectionState(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	conn, restore := connectDatabase(assert, redis.PoolSize(1))
+	defer restore()
+
+	ok, err := conn.DoOK("set", "state:a", "foo")
+	assert.Nil(err)
+	assert.True(ok)
+	id, err := conn.DoInt("client", "id")
+	assert.Nil(err)
+
+	// Changing the database leads to a new handshake
+	// when the connection is used again.
+	ok, err = conn.DoOK("select", testDatabaseIndex-1)
+	assert.Nil(err)
+	assert.True(ok)
+	assert.Nil(conn.Return())
+	value, err := conn.DoString("get", "state:a")
+	assert.Nil(err)
+	assert.Equal(value, "foo")
+	sameID, err := conn.DoInt("client", "id")
+	assert.Nil(err)
+	assert.Equal(sameID, id)
+}
+
+func TestReplicas(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	// Use the primary itself and an unreachable address as replicas.
+	conn, restore := connectDatabase(assert,
+		redis.TcpConnection("", 0),
+		redis.Replicas(redis.RoundRobin, time.Minute, "127.0.0.1:6379", "127.0.0.1:1"),
+	)
+	defer restore()
+
+	ok, err := conn.DoOK("set", "replica:a", "foo")
+	assert.Nil(err)
+	assert.True(ok)
+	for i := 0; i < 10; i++ {
+		value, err := conn.DoString("get", "replica:a")
+		assert.Nil(err)
+		assert.Equal(value, "foo")
+	}
+	result, err := conn.DoPrimary("get", "replica:a")
+	assert.Nil(err)
+	assertEqualString(assert, result, 0, "foo")
+}
+
 //--------------------
 // TOOLS
 //--------------------
@@ -142,6 +338,33 @@ func connectDatabase(assert asserts.Assertion, options ...redis.Option) (*redis.
 	}
 }
 
+// fakeDatabase starts a fake server and returns a connection to it
+// and a function for closing. This function shall be called with defer.
+func fakeDatabase(assert asserts.Assertion, options ...redis.Option) (*redis.Connection, func()) {
+	srv, err := redistest.NewServer()
+	assert.Nil(err)
+	options = append(options, redis.TcpConnection(srv.Addr(), 0), redis.Index(testDatabaseIndex, ""))
+	db, err := redis.Open(options...)
+	assert.Nil(err)
+	conn, err := db.Connection()
+	assert.Nil(err)
+	return conn, func() {
+		conn.Return()
+		db.Close()
+		srv.Close()
+	}
+}
+
+// killClient kills only the client of the connection, other
+// clients of the server stay untouched.
+func killClient(assert asserts.Assertion, conn, killer *redis.Connection) {
+	id, err := conn.DoInt("client", "id")
+	assert.Nil(err)
+	killed, err := killer.DoInt("client", "kill", "id", id)
+	assert.Nil(err)
+	assert.Equal(killed, 1)
+}
+
 // pipelineDatabase connects to a Redis database with the given options
 // and returns a pipeling and a function for closing. This function
 // shall be called with a defer.
@@ -0,0 +1,383 @@
+// Tideland Go Data Management - Redis Client - Cache
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package rediscache
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/tideland/goas/v2/identifier"
+	"github.com/tideland/goas/v3/errors"
+	"github.com/tideland/godm/v2/cache"
+	"github.com/tideland/godm/v3/redis"
+)
+
+//--------------------
+// CACHE
+//--------------------
+
+// unlockScript deletes the lock only if it's still
+// held by the instance.
+const unlockScript = `if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`
+
+// Cache manages the cached values of one namespace in a
+// Redis database.
+type Cache struct {
+	mux          sync.Mutex
+	database     *redis.Database
+	namespace    string
+	instance     string
+	serializer   Serializer
+	lockTimeout  time.Duration
+	values       map[string]map[*cachedValue]bool
+	subscription *redis.Subscription
+	done         chan struct{}
+}
+
+// New creates a cache for the namespace in the passed database
+// and subscribes to the invalidations of the other instances.
+func New(db *redis.Database, namespace string, opts ...Option) (*Cache, error) {
+	c := &Cache{
+		database:    db,
+		namespace:   namespace,
+		instance:    identifier.NewUUID().String(),
+		serializer:  JSON(),
+		lockTimeout: defaultLockTimeout,
+		values:      make(map[string]map[*cachedValue]bool),
+		done:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	sub, err := db.Subscription()
+	if err != nil {
+		return nil, err
+	}
+	if err = sub.Subscribe(c.channel()); err != nil {
+		return nil, err
+	}
+	// Wait for the confirmation, so no invalidation is missed.
+	if _, err = sub.Pop(); err != nil {
+		return nil, err
+	}
+	c.subscription = sub
+	go c.backendLoop()
+	return c, nil
+}
+
+// CachedValue creates a cached value for the key. The retrieval
+// func is responsible for the retrieval of the value while ttl
+// defines how long the value is valid. Values read from Redis are
+// unmarshalled into a new value of the type of prototype, nil lets
+// the serializer decide.
+func (c *Cache) CachedValue(key string, prototype interface{}, r cache.RetrievalFunc, ttl time.Duration) cache.CachedValue {
+	v := &cachedValue{
+		cache:         c,
+		key:           key,
+		retrievalFunc: r,
+		ttl:           ttl,
+	}
+	if prototype != nil {
+		v.prototype = reflect.TypeOf(prototype)
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.values[key] == nil {
+		c.values[key] = make(map[*cachedValue]bool)
+	}
+	c.values[key][v] = true
+	return v
+}
+
+// Close ends the subscription to the invalidations.
+func (c *Cache) Close() error {
+	if err := c.subscription.Unsubscribe(c.channel()); err != nil {
+		return err
+	}
+	<-c.done
+	return c.subscription.Close()
+}
+
+// backendLoop receives the invalidations and clears the
+// in-process values.
+func (c *Cache) backendLoop() {
+	defer close(c.done)
+	for {
+		pv, err := c.subscription.Pop()
+		if err != nil {
+			return
+		}
+		switch pv.Kind {
+		case redis.KindMessage:
+			c.invalidate(pv.Value.String())
+		case redis.KindUnsubscribe:
+			return
+		}
+	}
+}
+
+// invalidate clears the in-process values of the key.
+func (c *Cache) invalidate(key string) {
+	c.mux.Lock()
+	values := make([]*cachedValue, 0, len(c.values[key]))
+	for v := range c.values[key] {
+		values = append(values, v)
+	}
+	c.mux.Unlock()
+	for _, v := range values {
+		v.clearLocal()
+	}
+}
+
+// remove removes the value from the cache.
+func (c *Cache) remove(v *cachedValue) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	delete(c.values[v.key], v)
+	if len(c.values[v.key]) == 0 {
+		delete(c.values, v.key)
+	}
+}
+
+// valueKey returns the Redis key of a value.
+func (c *Cache) valueKey(key string) string {
+	return c.namespace + ":value:" + key
+}
+
+// lockKey returns the Redis key of a retrieval lock.
+func (c *Cache) lockKey(key string) string {
+	return c.namespace + ":lock:" + key
+}
+
+// channel returns the channel for the invalidations.
+func (c *Cache) channel() string {
+	return c.namespace + ":invalidate"
+}
+
+//--------------------
+// CACHED VALUE
+//--------------------
+
+// cachedValue implements the cache.CachedValue interface.
+type cachedValue struct {
+	mux           sync.Mutex
+	cache         *Cache
+	key           string
+	prototype     reflect.Type
+	retrievalFunc cache.RetrievalFunc
+	ttl           time.Duration
+	value         interface{}
+	valid         bool
+	expires       time.Time
+	removed       bool
+	loading       chan struct{}
+	generation    int
+}
+
+// Value implements the cache.CachedValue interface. The value is
+// loaded without holding the mutex, so that invalidations aren't
+// blocked. Concurrent calls wait for the running load.
+func (v *cachedValue) Value() (interface{}, error) {
+	v.mux.Lock()
+	for {
+		if v.removed {
+			v.mux.Unlock()
+			return nil, errors.New(ErrRemoved, errorMessages, v.key)
+		}
+		if v.valid && time.Now().Before(v.expires) {
+			value := v.value
+			v.mux.Unlock()
+			return value, nil
+		}
+		if v.loading == nil {
+			break
+		}
+		loading := v.loading
+		v.mux.Unlock()
+		<-loading
+		v.mux.Lock()
+	}
+	v.valid = false
+	loading := make(chan struct{})
+	v.loading = loading
+	generation := v.generation
+	r := v.retrievalFunc
+	v.mux.Unlock()
+
+	value, ttl, err := v.load(r)
+
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	v.loading = nil
+	close(loading)
+	if err != nil {
+		return nil, err
+	}
+	if v.removed {
+		return nil, errors.New(ErrRemoved, errorMessages, v.key)
+	}
+	// Keep the value only if it hasn't been
+	// invalidated during the load.
+	if v.generation == generation {
+		v.value = value
+		v.valid = true
+		v.expires = time.Now().Add(ttl)
+	}
+	return value, nil
+}
+
+// Clear implements the cache.CachedValue interface. The value
+// is deleted in Redis and the other instances are informed.
+func (v *cachedValue) Clear() {
+	v.clearLocal()
+	conn, err := v.cache.database.Connection()
+	if err != nil {
+		return
+	}
+	defer conn.Return()
+	conn.Do("del", v.cache.valueKey(v.key))
+	conn.Do("publish", v.cache.channel(), v.key)
+}
+
+// Remove implements the cache.CachedValue interface.
+func (v *cachedValue) Remove() {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	v.cache.remove(v)
+	v.value = nil
+	v.valid = false
+	v.retrievalFunc = nil
+	v.removed = true
+	v.generation++
+}
+
+// clearLocal clears only the in-process value.
+func (v *cachedValue) clearLocal() {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	v.value = nil
+	v.valid = false
+	v.generation++
+}
+
+// load reads the value from Redis. If it's not found there the
+// value is retrieved by the instance getting the lock while the
+// others wait. It returns the value and its remaining time to live.
+func (v *cachedValue) load(r cache.RetrievalFunc) (interface{}, time.Duration, error) {
+	conn, err := v.cache.database.Connection()
+	if err != nil {
+		return nil, 0, errors.Annotate(err, ErrBackend, errorMessages, v.key)
+	}
+	defer conn.Return()
+	deadline := time.Now().Add(v.cache.lockTimeout)
+	for {
+		value, ttl, found, err := v.fetch(conn)
+		if err != nil || found {
+			return value, ttl, err
+		}
+		locked, err := conn.DoOK("set", v.cache.lockKey(v.key), v.cache.instance, "nx", "px", v.cache.lockTimeout)
+		if err != nil {
+			return nil, 0, errors.Annotate(err, ErrBackend, errorMessages, v.key)
+		}
+		if locked {
+			defer conn.Do("eval", unlockScript, 1, v.cache.lockKey(v.key), v.cache.instance)
+			return v.retrieve(conn, r)
+		}
+		if time.Now().After(deadline) {
+			// The lock holder takes too long, so do it here.
+			return v.retrieve(conn, r)
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// fetch reads the value and its time to live from Redis.
+func (v *cachedValue) fetch(conn *redis.Connection) (interface{}, time.Duration, bool, error) {
+	data, err := conn.DoValue("get", v.cache.valueKey(v.key))
+	if err != nil {
+		return nil, 0, false, errors.Annotate(err, ErrBackend, errorMessages, v.key)
+	}
+	if data.IsNil() {
+		return nil, 0, false, nil
+	}
+	pttl, err := conn.DoInt("pttl", v.cache.valueKey(v.key))
+	if err != nil {
+		return nil, 0, false, errors.Annotate(err, ErrBackend, errorMessages, v.key)
+	}
+	ttl := v.ttl
+	if pttl >= 0 && time.Duration(pttl)*time.Millisecond < ttl {
+		ttl = time.Duration(pttl) * time.Millisecond
+	}
+	value, err := v.unmarshal(data.Bytes())
+	if err != nil {
+		return nil, 0, false, err
+	}
+	return value, ttl, true, nil
+}
+
+// retrieve calls the retrieval function and stores
+// the value in Redis.
+func (v *cachedValue) retrieve(conn *redis.Connection, r cache.RetrievalFunc) (interface{}, time.Duration, error) {
+	value, err := callRetrievalFunc(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	data, err := v.cache.serializer.Marshal(value)
+	if err != nil {
+		return nil, 0, errors.Annotate(err, ErrSerialization, errorMessages, v.key)
+	}
+	args := []interface{}{v.cache.valueKey(v.key), data}
+	if v.ttl > 0 {
+		args = append(args, "px", v.ttl)
+	}
+	if _, err = conn.Do("set", args...); err != nil {
+		return nil, 0, errors.Annotate(err, ErrBackend, errorMessages, v.key)
+	}
+	return value, v.ttl, nil
+}
+
+// callRetrievalFunc calls the retrieval function and
+// handles a panic.
+func callRetrievalFunc(r cache.RetrievalFunc) (value interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			value = nil
+			err = errors.New(ErrCannotRetrieve, errorMessages, r)
+		}
+	}()
+	return r()
+}
+
+// unmarshal converts the data into a new value
+// of the prototype type.
+func (v *cachedValue) unmarshal(data []byte) (interface{}, error) {
+	if v.prototype == nil {
+		var value interface{}
+		if err := v.cache.serializer.Unmarshal(data, &value); err != nil {
+			return nil, errors.Annotate(err, ErrSerialization, errorMessages, v.key)
+		}
+		return value, nil
+	}
+	pv := reflect.New(v.prototype)
+	if err := v.cache.serializer.Unmarshal(data, pv.Interface()); err != nil {
+		return nil, errors.Annotate(err, ErrSerialization, errorMessages, v.key)
+	}
+	return pv.Elem().Interface(), nil
+}
+
+// EOF
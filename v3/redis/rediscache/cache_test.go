@@ -0,0 +1,243 @@
+// Tideland Go Data Management - Redis Client - Cache - Unit Tests
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package rediscache_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tideland/godm/v3/redis"
+	"github.com/tideland/godm/v3/redis/rediscache"
+	"github.com/tideland/gots/v3/asserts"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// Test the sharing of values between caches.
+func TestSharedValue(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	db, restore := openDatabase(assert)
+	defer restore()
+	ca := newCache(assert, db)
+	defer ca.Close()
+	cb := newCache(assert, db)
+	defer cb.Close()
+
+	var mux sync.Mutex
+	ctr := 0
+	count := func() (interface{}, error) {
+		mux.Lock()
+		defer mux.Unlock()
+		ctr++
+		return ctr, nil
+	}
+	cva := ca.CachedValue("counter", 0, count, time.Minute)
+	defer cva.Remove()
+	cvb := cb.CachedValue("counter", 0, count, time.Minute)
+	defer cvb.Remove()
+
+	// First retrieval, then read from Redis.
+	v, err := cva.Value()
+	assert.Nil(err)
+	assert.Equal(v, 1)
+	v, err = cvb.Value()
+	assert.Nil(err)
+	assert.Equal(v, 1)
+
+	// Clearing invalidates the other instance too.
+	cva.Clear()
+	time.Sleep(50 * time.Millisecond)
+	v, err = cvb.Value()
+	assert.Nil(err)
+	assert.Equal(v, 2)
+	v, err = cva.Value()
+	assert.Nil(err)
+	assert.Equal(v, 2)
+
+	// Removed values cannot be retrieved anymore.
+	cva.Remove()
+	_, err = cva.Value()
+	assert.ErrorMatch(err, `.* cached value "counter" has been removed`)
+}
+
+// Test that concurrent retrievals are done only once.
+func TestStampede(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	db, restore := openDatabase(assert)
+	defer restore()
+
+	var mux sync.Mutex
+	ctr := 0
+	slow := func() (interface{}, error) {
+		time.Sleep(100 * time.Millisecond)
+		mux.Lock()
+		defer mux.Unlock()
+		ctr++
+		return "slow", nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		c := newCache(assert, db)
+		defer c.Close()
+		cv := c.CachedValue("slow", "", slow, time.Minute)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := cv.Value()
+			assert.Nil(err)
+			assert.Equal(v, "slow")
+		}()
+	}
+	wg.Wait()
+	assert.Equal(ctr, 1)
+}
+
+// Test that invalidations aren't blocked by a running load
+// and that the loaded value isn't kept afterwards.
+func TestInvalidationWhileLoading(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	db, restore := openDatabase(assert)
+	defer restore()
+	c := newCache(assert, db)
+	defer c.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	ctr := 0
+	blocking := func() (interface{}, error) {
+		ctr++
+		if ctr == 1 {
+			close(started)
+			<-release
+		}
+		return ctr, nil
+	}
+	cv := c.CachedValue("blocking", 0, blocking, time.Minute)
+	defer cv.Remove()
+
+	loaded := make(chan interface{}, 1)
+	go func() {
+		v, err := cv.Value()
+		assert.Nil(err)
+		loaded <- v
+	}()
+	<-started
+	cleared := make(chan struct{})
+	go func() {
+		cv.Clear()
+		close(cleared)
+	}()
+	select {
+	case <-cleared:
+	case <-time.After(time.Second):
+		assert.Fail("clearing blocked by the load")
+	}
+	close(release)
+	assert.Equal(<-loaded, 1)
+
+	// The value loaded before the invalidation isn't kept
+	// locally. Delete it in Redis too, where the load has
+	// stored it after the clearing, so it's retrieved again.
+	conn, err := db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+	_, err = conn.Do("del", "test:value:blocking")
+	assert.Nil(err)
+	v, err := cv.Value()
+	assert.Nil(err)
+	assert.Equal(v, 2)
+}
+
+// Test the serialization of structs with gob.
+func TestGobSerialization(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	db, restore := openDatabase(assert)
+	defer restore()
+	ca := newCache(assert, db, rediscache.Serialization(rediscache.Gob()))
+	defer ca.Close()
+	cb := newCache(assert, db, rediscache.Serialization(rediscache.Gob()))
+	defer cb.Close()
+
+	type order struct {
+		No    int
+		Items []string
+	}
+	retrieve := func() (interface{}, error) {
+		return order{4711, []string{"foo", "bar"}}, nil
+	}
+	cva := ca.CachedValue("order", order{}, retrieve, time.Minute)
+	cvb := cb.CachedValue("order", order{}, nil, time.Minute)
+
+	va, err := cva.Value()
+	assert.Nil(err)
+	vb, err := cvb.Value()
+	assert.Nil(err)
+	assert.Equal(vb, va)
+}
+
+// Test the retrieving with errors and panics.
+func TestRetrieveError(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	db, restore := openDatabase(assert)
+	defer restore()
+	c := newCache(assert, db)
+	defer c.Close()
+
+	ctr := 0
+	efunc := func() (interface{}, error) {
+		ctr++
+		return nil, fmt.Errorf("ouch %d", ctr)
+	}
+	cv := c.CachedValue("error", nil, efunc, time.Minute)
+	_, err := cv.Value()
+	assert.ErrorMatch(err, "ouch 1")
+	_, err = cv.Value()
+	assert.ErrorMatch(err, "ouch 2")
+
+	pfunc := func() (interface{}, error) {
+		panic("ouch")
+	}
+	cv = c.CachedValue("panic", nil, pfunc, time.Minute)
+	_, err = cv.Value()
+	assert.ErrorMatch(err, `.* cannot retrieve cached value: ouch`)
+}
+
+//--------------------
+// TOOLS
+//--------------------
+
+const testDatabaseIndex = 99
+
+// openDatabase opens and flushes the test database.
+func openDatabase(assert asserts.Assertion) (*redis.Database, func()) {
+	db, err := redis.Open(redis.Index(testDatabaseIndex, ""))
+	assert.Nil(err)
+	conn, err := db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+	_, err = conn.Do("flushdb")
+	assert.Nil(err)
+	return db, func() { db.Close() }
+}
+
+// newCache creates a cache for the test namespace.
+func newCache(assert asserts.Assertion, db *redis.Database, opts ...rediscache.Option) *rediscache.Cache {
+	c, err := rediscache.New(db, "test", opts...)
+	assert.Nil(err)
+	return c
+}
+
+// EOF
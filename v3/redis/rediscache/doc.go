@@ -0,0 +1,22 @@
+// Tideland Go Data Management - Redis Client - Cache
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// The rediscache package provides cached values like the cache package
+// but shared between instances of a service using Redis.
+//
+// A Cache is created for a Redis database and a namespace, e.g. the name
+// of the service. Its cached values implement cache.CachedValue, so they
+// can replace values created with cache.NewCachedValue(). Each value is
+// held in-process until its time to live is exceeded. Then it's read from
+// Redis and only if it's not found there the retrieval function is called.
+// A lock in Redis ensures that only one instance retrieves a value while
+// the others wait for it. Values are stored using a Serializer, JSON and
+// gob are provided. Clearing a value deletes it in Redis and informs all
+// other instances using Pub/Sub.
+package rediscache
+
+// EOF
@@ -0,0 +1,39 @@
+// Tideland Go Data Management - Redis Client - Cache - Errors
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package rediscache
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// Error codes.
+const (
+	ErrInvalidConfiguration = iota + 1
+	ErrCannotRetrieve
+	ErrSerialization
+	ErrBackend
+	ErrRemoved
+)
+
+var errorMessages = errors.Messages{
+	ErrInvalidConfiguration: "invalid configuration value in field %q: %v",
+	ErrCannotRetrieve:       "cannot retrieve cached value: %v",
+	ErrSerialization:        "cannot serialize cached value %q",
+	ErrBackend:              "cannot access cached value %q in Redis",
+	ErrRemoved:              "cached value %q has been removed",
+}
+
+// EOF
@@ -0,0 +1,59 @@
+// Tideland Go Data Management - Redis Client - Cache - Options
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package rediscache
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"time"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// OPTIONS
+//--------------------
+
+const (
+	defaultLockTimeout = 5 * time.Second
+	lockPollInterval   = 10 * time.Millisecond
+)
+
+// Option defines a function setting an option of the cache.
+type Option func(c *Cache) error
+
+// Serialization sets the serializer for the values stored
+// in Redis. The default is JSON.
+func Serialization(s Serializer) Option {
+	return func(c *Cache) error {
+		if s == nil {
+			return errors.New(ErrInvalidConfiguration, errorMessages, "serializer", s)
+		}
+		c.serializer = s
+		return nil
+	}
+}
+
+// LockTimeout sets how long the lock for the retrieval of a
+// value is held at most. Other instances waiting longer for the
+// value retrieve it on their own. The default is 5 seconds.
+func LockTimeout(timeout time.Duration) Option {
+	return func(c *Cache) error {
+		if timeout < 0 {
+			return errors.New(ErrInvalidConfiguration, errorMessages, "lock timeout", timeout)
+		} else if timeout == 0 {
+			timeout = defaultLockTimeout
+		}
+		c.lockTimeout = timeout
+		return nil
+	}
+}
+
+// EOF
@@ -0,0 +1,76 @@
+// Tideland Go Data Management - Redis Client - Cache - Serializer
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package rediscache
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+//--------------------
+// SERIALIZER
+//--------------------
+
+// Serializer converts cached values into bytes stored in
+// Redis and back.
+type Serializer interface {
+	// Marshal converts the value into bytes.
+	Marshal(v interface{}) ([]byte, error)
+
+	// Unmarshal converts the bytes into the value pointed
+	// at by v.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSON returns a serializer using JSON.
+func JSON() Serializer {
+	return jsonSerializer{}
+}
+
+// jsonSerializer implements Serializer using JSON.
+type jsonSerializer struct{}
+
+// Marshal implements the Serializer interface.
+func (s jsonSerializer) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal implements the Serializer interface.
+func (s jsonSerializer) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Gob returns a serializer using gob. Here cached
+// values need a prototype.
+func Gob() Serializer {
+	return gobSerializer{}
+}
+
+// gobSerializer implements Serializer using gob.
+type gobSerializer struct{}
+
+// Marshal implements the Serializer interface.
+func (s gobSerializer) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal implements the Serializer interface.
+func (s gobSerializer) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// EOF
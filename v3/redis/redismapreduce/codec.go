@@ -0,0 +1,62 @@
+// Tideland Go Data Management - Redis Client - Map/Reduce - Codec
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redismapreduce
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/tideland/godm/v2/mapreduce"
+)
+
+//--------------------
+// CODEC
+//--------------------
+
+// Codec converts the key/values passed between coordinator
+// and workers into bytes and back.
+type Codec interface {
+	// Encode converts the key/value into bytes.
+	Encode(kv mapreduce.KeyValue) ([]byte, error)
+
+	// Decode converts the bytes into a key/value.
+	Decode(data []byte) (mapreduce.KeyValue, error)
+}
+
+// Gob returns a codec using gob. The concrete types of the
+// key/values have to be registered with gob.Register().
+func Gob() Codec {
+	return gobCodec{}
+}
+
+// gobCodec implements Codec using gob.
+type gobCodec struct{}
+
+// Encode implements the Codec interface.
+func (c gobCodec) Encode(kv mapreduce.KeyValue) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&kv); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode implements the Codec interface.
+func (c gobCodec) Decode(data []byte) (mapreduce.KeyValue, error) {
+	var kv mapreduce.KeyValue
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&kv); err != nil {
+		return nil, err
+	}
+	return kv, nil
+}
+
+// EOF
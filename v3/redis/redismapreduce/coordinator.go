@@ -0,0 +1,331 @@
+// Tideland Go Data Management - Redis Client - Map/Reduce - Coordinator
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redismapreduce
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"time"
+
+	"github.com/tideland/goas/v3/errors"
+	"github.com/tideland/godm/v2/mapreduce"
+	"github.com/tideland/godm/v3/redis"
+)
+
+//--------------------
+// COORDINATOR
+//--------------------
+
+// MapReduce coordinates the distributed map/reducing of the job. The
+// input of the MapReducer is mapped and reduced by the workers of the
+// job, the results are passed to its Consume() method. It waits until
+// all tasks are done, so at least one worker has to run. It fails if
+// tasks failed too often or if the optional timeout passed.
+func MapReduce(db *redis.Database, name string, mr mapreduce.MapReducer, opts ...Option) error {
+	s, err := newSettings(opts)
+	if err != nil {
+		return err
+	}
+	c := &coordinator{
+		database: db,
+		job:      job(name),
+		mr:       mr,
+		settings: s,
+	}
+	return c.run()
+}
+
+// coordinator distributes the tasks of one job.
+type coordinator struct {
+	database  *redis.Database
+	job       job
+	mr        mapreduce.MapReducer
+	settings  *settings
+	recovered time.Time
+	deadline  time.Time
+}
+
+// run performs the phases of the job.
+func (c *coordinator) run() error {
+	if c.settings.timeout > 0 {
+		c.deadline = time.Now().Add(c.settings.timeout)
+	}
+	if err := c.prepare(); err != nil {
+		return err
+	}
+	defer c.cleanup()
+	count, err := c.pushInput()
+	if err != nil {
+		return err
+	}
+	if err = c.await(c.job.mapped(), count); err != nil {
+		return err
+	}
+	if err = c.pushReduceTasks(); err != nil {
+		return err
+	}
+	if err = c.await(c.job.reduced(), c.settings.partitions); err != nil {
+		return err
+	}
+	return c.consume()
+}
+
+// prepare removes the data of a former run of the job
+// and the tasks of dead workers.
+func (c *coordinator) prepare() error {
+	if err := c.recoverWorkers(false); err != nil {
+		return err
+	}
+	return c.cleanup()
+}
+
+// cleanup deletes the data of the job.
+func (c *coordinator) cleanup() error {
+	conn, err := c.database.Connection()
+	if err != nil {
+		return c.failed(err)
+	}
+	defer conn.Return()
+	keys := []string{
+		c.job.tasks(), c.job.output(), c.job.mapped(), c.job.reduced(),
+		c.job.attempts(), c.job.dead(),
+	}
+	for partition := 0; partition < c.settings.partitions; partition++ {
+		keys = append(keys, c.job.partition(partition))
+	}
+	if _, err = conn.Do("del", keys); err != nil {
+		return c.failed(err)
+	}
+	return nil
+}
+
+// pushInput pushes the input of the MapReducer as map
+// tasks and returns their number.
+func (c *coordinator) pushInput() (int, error) {
+	input := c.mr.Input()
+	conn, err := c.database.Connection()
+	if err != nil {
+		go drain(input)
+		return 0, c.failed(err)
+	}
+	defer conn.Return()
+	count := 0
+	tasks := []interface{}{}
+	push := func() error {
+		if len(tasks) == 0 {
+			return nil
+		}
+		if _, err := conn.Do("rpush", c.job.tasks(), tasks); err != nil {
+			return c.failed(err)
+		}
+		count += len(tasks)
+		tasks = tasks[:0]
+		return nil
+	}
+	for kv := range input {
+		data, err := c.settings.codec.Encode(kv)
+		if err != nil {
+			go drain(input)
+			return 0, errors.Annotate(err, ErrEncoding, errorMessages)
+		}
+		tasks = append(tasks, newMapTask(c.settings.partitions, data))
+		if len(tasks) == chunkSize {
+			if err := push(); err != nil {
+				go drain(input)
+				return 0, err
+			}
+		}
+	}
+	if err := push(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// pushReduceTasks pushes one reduce task per partition.
+func (c *coordinator) pushReduceTasks() error {
+	conn, err := c.database.Connection()
+	if err != nil {
+		return c.failed(err)
+	}
+	defer conn.Return()
+	tasks := []interface{}{}
+	for partition := 0; partition < c.settings.partitions; partition++ {
+		tasks = append(tasks, newReduceTask(partition))
+	}
+	if _, err = conn.Do("rpush", c.job.tasks(), tasks); err != nil {
+		return c.failed(err)
+	}
+	return nil
+}
+
+// await waits until the counter reaches the expected number of
+// done tasks. Meanwhile the tasks of dead workers are recovered.
+// Dead tasks and the passed deadline end the waiting.
+func (c *coordinator) await(counter string, expected int) error {
+	for {
+		done, err := c.count(counter)
+		if err != nil {
+			return err
+		}
+		if done >= expected {
+			return nil
+		}
+		dead, err := c.countDead()
+		if err != nil {
+			return err
+		}
+		if dead > 0 {
+			return errors.New(ErrDeadTasks, errorMessages, dead, string(c.job))
+		}
+		if !c.deadline.IsZero() && time.Now().After(c.deadline) {
+			return errors.New(ErrTimeout, errorMessages, string(c.job))
+		}
+		if time.Since(c.recovered) >= c.settings.heartbeat {
+			if err = c.recoverWorkers(true); err != nil {
+				return err
+			}
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// count reads a counter of done tasks.
+func (c *coordinator) count(counter string) (int, error) {
+	conn, err := c.database.Connection()
+	if err != nil {
+		return 0, c.failed(err)
+	}
+	defer conn.Return()
+	value, err := conn.DoValue("get", counter)
+	if err != nil {
+		return 0, c.failed(err)
+	}
+	if value.IsNil() {
+		return 0, nil
+	}
+	done, err := value.Int()
+	if err != nil {
+		return 0, c.failed(err)
+	}
+	return done, nil
+}
+
+// countDead reads the number of tasks failed too often.
+func (c *coordinator) countDead() (int, error) {
+	conn, err := c.database.Connection()
+	if err != nil {
+		return 0, c.failed(err)
+	}
+	defer conn.Return()
+	dead, err := conn.DoInt("llen", c.job.dead())
+	if err != nil {
+		return 0, c.failed(err)
+	}
+	return dead, nil
+}
+
+// recoverWorkers removes the workers without heartbeat. Their
+// tasks are retried like failed ones if wanted, otherwise they
+// are deleted.
+func (c *coordinator) recoverWorkers(requeue bool) error {
+	c.recovered = time.Now()
+	conn, err := c.database.Connection()
+	if err != nil {
+		return c.failed(err)
+	}
+	defer conn.Return()
+	ids, err := conn.DoStrings("smembers", c.job.workers())
+	if err != nil {
+		return c.failed(err)
+	}
+	for _, id := range ids {
+		alive, err := conn.DoBool("exists", c.job.alive(id))
+		if err != nil {
+			return c.failed(err)
+		}
+		if alive {
+			continue
+		}
+		if requeue {
+			rs, err := conn.Do("lrange", c.job.processing(id), 0, -1)
+			if err != nil {
+				return c.failed(err)
+			}
+			for _, value := range rs.Values() {
+				if _, err = conn.Do("eval", c.job.retry(id, value.Bytes(), c.settings.attempts)...); err != nil {
+					return c.failed(err)
+				}
+			}
+		} else if _, err = conn.Do("del", c.job.processing(id)); err != nil {
+			return c.failed(err)
+		}
+		if _, err = conn.Do("srem", c.job.workers(), id); err != nil {
+			return c.failed(err)
+		}
+	}
+	return nil
+}
+
+// consume passes the reduced key/values to the MapReducer.
+func (c *coordinator) consume() error {
+	in := make(mapreduce.KeyValueChan)
+	consumed := make(chan error, 1)
+	go func() {
+		consumed <- c.mr.Consume(in)
+	}()
+	abort := func(err error) error {
+		in.Close()
+		<-consumed
+		return err
+	}
+	conn, err := c.database.Connection()
+	if err != nil {
+		return abort(c.failed(err))
+	}
+	defer conn.Return()
+	for start := 0; ; start += chunkSize {
+		rs, err := conn.Do("lrange", c.job.output(), start, start+chunkSize-1)
+		if err != nil {
+			return abort(c.failed(err))
+		}
+		if rs.Len() == 0 {
+			break
+		}
+		for _, value := range rs.Values() {
+			kv, err := c.settings.codec.Decode(value.Bytes())
+			if err != nil {
+				return abort(errors.Annotate(err, ErrEncoding, errorMessages))
+			}
+			select {
+			case in <- kv:
+			case err := <-consumed:
+				// Consumer ended early.
+				return err
+			}
+		}
+	}
+	in.Close()
+	return <-consumed
+}
+
+// failed annotates an error accessing Redis.
+func (c *coordinator) failed(err error) error {
+	return errors.Annotate(err, ErrBackend, errorMessages, string(c.job))
+}
+
+// drain reads the rest of an input channel, so that
+// its producer isn't blocked.
+func drain(input mapreduce.KeyValueChan) {
+	for range input {
+	}
+}
+
+// EOF
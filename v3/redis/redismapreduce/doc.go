@@ -0,0 +1,36 @@
+// Tideland Go Data Management - Redis Client - Map/Reduce
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// The redismapreduce package distributes the map/reducing of the
+// mapreduce package to worker processes using Redis lists.
+//
+// MapReduce() is the coordinator of a job. It pushes the key/values
+// of the input as tasks into a list of the job. Workers created with
+// NewWorker() for the same job run the Map() method of the same
+// MapReducer and push the emitted key/values into one list per
+// partition, chosen by mapreduce.Partition(). When all input is mapped
+// the coordinator pushes one reduce task per partition. The results of
+// Reduce() are sent back and passed to the Consume() method of the
+// coordinators MapReducer.
+//
+// The key/values are encoded with a Codec, by default with gob. So
+// their concrete types have to be registered with gob.Register().
+//
+// Each worker moves its current task into an own processing list and
+// signals its liveness with a heartbeat. If the heartbeat stops, e.g.
+// because the worker crashed, the coordinator gives its task to another
+// worker. A worker whose Map() or Reduce() panics gives the task back
+// itself and continues. Results are only accepted if the task still
+// belongs to the worker, so each task is processed exactly once.
+//
+// The attempts of each task are counted. After the number set with
+// Attempts() the task is moved into a list of dead tasks and the
+// coordinator fails, instead of waiting forever for a task which
+// always fails. Additionally Timeout() limits the waiting.
+package redismapreduce
+
+// EOF
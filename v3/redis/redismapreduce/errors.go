@@ -0,0 +1,82 @@
+// Tideland Go Data Management - Redis Client - Map/Reduce - Errors
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redismapreduce
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// Error codes.
+const (
+	ErrInvalidConfiguration = iota + 1
+	ErrBackend
+	ErrEncoding
+	ErrInvalidTask
+	ErrPanic
+	ErrDeadTasks
+	ErrTimeout
+)
+
+var errorMessages = errors.Messages{
+	ErrInvalidConfiguration: "invalid configuration value in field %q: %v",
+	ErrBackend:              "cannot access job %q in Redis",
+	ErrEncoding:             "cannot encode or decode key/value",
+	ErrInvalidTask:          "invalid task %q",
+	ErrPanic:                "task panicked: %v",
+	ErrDeadTasks:            "%d task(s) of job %q failed too often",
+	ErrTimeout:              "job %q timed out",
+}
+
+//--------------------
+// ERRORS
+//--------------------
+
+// IsInvalidConfigurationError tests the error type.
+func IsInvalidConfigurationError(err error) bool {
+	return errors.IsError(err, ErrInvalidConfiguration)
+}
+
+// IsBackendError tests the error type.
+func IsBackendError(err error) bool {
+	return errors.IsError(err, ErrBackend)
+}
+
+// IsEncodingError tests the error type.
+func IsEncodingError(err error) bool {
+	return errors.IsError(err, ErrEncoding)
+}
+
+// IsInvalidTaskError tests the error type.
+func IsInvalidTaskError(err error) bool {
+	return errors.IsError(err, ErrInvalidTask)
+}
+
+// IsPanicError tests the error type.
+func IsPanicError(err error) bool {
+	return errors.IsError(err, ErrPanic)
+}
+
+// IsDeadTasksError tests the error type.
+func IsDeadTasksError(err error) bool {
+	return errors.IsError(err, ErrDeadTasks)
+}
+
+// IsTimeoutError tests the error type.
+func IsTimeoutError(err error) bool {
+	return errors.IsError(err, ErrTimeout)
+}
+
+// EOF
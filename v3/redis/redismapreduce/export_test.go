@@ -0,0 +1,20 @@
+// Tideland Go Data Management - Redis Client - Map/Reduce - Export for Unit Tests
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redismapreduce
+
+//--------------------
+// EXPORT
+//--------------------
+
+// Scripts of the jobs, so that the fake server can emulate them.
+const (
+	AckScript   = ackScript
+	RetryScript = retryScript
+)
+
+// EOF
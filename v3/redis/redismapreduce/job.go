@@ -0,0 +1,184 @@
+// Tideland Go Data Management - Redis Client - Map/Reduce - Jobs
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redismapreduce
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// JOB
+//--------------------
+
+// ackScript acknowledges a task only if it's still in the processing
+// list of the worker, otherwise it has been given to another worker and
+// the results are dropped. KEYS contains the lists to push the values
+// to after the processing list and the counter, ARGV the task followed
+// by the values.
+const ackScript = `if redis.call("lrem", KEYS[1], 1, ARGV[1]) == 0 then
+	return 0
+end
+for i = 3, #KEYS do
+	redis.call("rpush", KEYS[i], ARGV[i - 1])
+end
+redis.call("incr", KEYS[2])
+return 1`
+
+// retryScript removes a failed task from the processing list of its
+// worker and counts the attempt. The task is pushed back to the open
+// tasks or, after the maximum number of attempts, into the list of
+// dead tasks. ARGV contains the task and the maximum number.
+const retryScript = `if redis.call("lrem", KEYS[1], 1, ARGV[1]) == 0 then
+	return 0
+end
+if redis.call("hincrby", KEYS[2], ARGV[1], 1) >= tonumber(ARGV[2]) then
+	redis.call("rpush", KEYS[4], ARGV[1])
+	return -1
+end
+redis.call("rpush", KEYS[3], ARGV[1])
+return 1`
+
+// job provides the Redis keys of a job.
+type job string
+
+// tasks returns the key of the list of open tasks.
+func (j job) tasks() string {
+	return string(j) + ":tasks"
+}
+
+// workers returns the key of the set of registered workers.
+func (j job) workers() string {
+	return string(j) + ":workers"
+}
+
+// processing returns the key of the list of the task of a worker.
+func (j job) processing(id string) string {
+	return string(j) + ":processing:" + id
+}
+
+// alive returns the key of the heartbeat of a worker.
+func (j job) alive(id string) string {
+	return string(j) + ":alive:" + id
+}
+
+// attempts returns the key of the hash of failed attempts per task.
+func (j job) attempts() string {
+	return string(j) + ":attempts"
+}
+
+// dead returns the key of the list of tasks failed too often.
+func (j job) dead() string {
+	return string(j) + ":dead"
+}
+
+// ack returns the arguments of EVAL for the acknowledgement of
+// a performed task of a worker. The results are pairs of the list
+// keys and the values to push.
+func (j job) ack(id, counter string, encoded []byte, results []interface{}) []interface{} {
+	keys := []interface{}{j.processing(id), counter}
+	values := []interface{}{encoded}
+	for i := 0; i < len(results); i += 2 {
+		keys = append(keys, results[i])
+		values = append(values, results[i+1])
+	}
+	args := append([]interface{}{ackScript, len(keys)}, keys...)
+	return append(args, values...)
+}
+
+// retry returns the arguments of EVAL for the retry
+// of a failed task of a worker.
+func (j job) retry(id string, encoded []byte, attempts int) []interface{} {
+	return []interface{}{retryScript, 4, j.processing(id), j.attempts(), j.tasks(), j.dead(), encoded, attempts}
+}
+
+// partition returns the key of the list of a partition.
+func (j job) partition(partition int) string {
+	return string(j) + ":partition:" + strconv.Itoa(partition)
+}
+
+// output returns the key of the list of reduced key/values.
+func (j job) output() string {
+	return string(j) + ":output"
+}
+
+// mapped returns the key of the counter of mapped tasks.
+func (j job) mapped() string {
+	return string(j) + ":mapped"
+}
+
+// reduced returns the key of the counter of reduced tasks.
+func (j job) reduced() string {
+	return string(j) + ":reduced"
+}
+
+//--------------------
+// TASK
+//--------------------
+
+// Kinds of tasks.
+const (
+	mapTask    = 'm'
+	reduceTask = 'r'
+)
+
+// task is one map or reduce task. Map tasks contain the number
+// of partitions and the encoded key/value, reduce tasks the
+// partition to reduce.
+type task struct {
+	kind   byte
+	number int
+	data   []byte
+}
+
+// newMapTask creates the encoded map task for a key/value.
+func newMapTask(partitions int, data []byte) []byte {
+	encoded := append([]byte{mapTask}, strconv.Itoa(partitions)...)
+	encoded = append(encoded, ':')
+	return append(encoded, data...)
+}
+
+// newReduceTask creates the encoded reduce task for a partition.
+func newReduceTask(partition int) []byte {
+	return append([]byte{reduceTask}, strconv.Itoa(partition)...)
+}
+
+// parseTask decodes a task.
+func parseTask(encoded []byte) (*task, error) {
+	if len(encoded) < 2 {
+		return nil, errors.New(ErrInvalidTask, errorMessages, encoded)
+	}
+	t := &task{kind: encoded[0]}
+	number := encoded[1:]
+	switch t.kind {
+	case mapTask:
+		colon := bytes.IndexByte(encoded, ':')
+		if colon < 0 {
+			return nil, errors.New(ErrInvalidTask, errorMessages, encoded)
+		}
+		number = encoded[1:colon]
+		t.data = encoded[colon+1:]
+	case reduceTask:
+	default:
+		return nil, errors.New(ErrInvalidTask, errorMessages, encoded)
+	}
+	n, err := strconv.Atoi(string(number))
+	if err != nil || n < 0 || (t.kind == mapTask && n == 0) {
+		return nil, errors.New(ErrInvalidTask, errorMessages, encoded)
+	}
+	t.number = n
+	return t, nil
+}
+
+// EOF
@@ -0,0 +1,133 @@
+// Tideland Go Data Management - Redis Client - Map/Reduce - Options
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redismapreduce
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// OPTIONS
+//--------------------
+
+const (
+	defaultHeartbeat = 5 * time.Second
+	defaultAttempts  = 3
+	pollInterval     = 50 * time.Millisecond
+	taskTimeout      = time.Second
+	chunkSize        = 100
+)
+
+// settings contains the settings of coordinators and workers.
+type settings struct {
+	codec      Codec
+	partitions int
+	heartbeat  time.Duration
+	attempts   int
+	timeout    time.Duration
+}
+
+// Option defines a function setting an option of a
+// coordinator or a worker.
+type Option func(s *settings) error
+
+// newSettings creates the settings with the defaults
+// and applies the options.
+func newSettings(opts []Option) (*settings, error) {
+	s := &settings{
+		codec:      Gob(),
+		partitions: runtime.NumCPU(),
+		heartbeat:  defaultHeartbeat,
+		attempts:   defaultAttempts,
+	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Encoding sets the codec for the key/values. Coordinator and
+// workers have to use the same one. The default is gob.
+func Encoding(c Codec) Option {
+	return func(s *settings) error {
+		if c == nil {
+			return errors.New(ErrInvalidConfiguration, errorMessages, "codec", c)
+		}
+		s.codec = c
+		return nil
+	}
+}
+
+// Partitions sets the number of partitions for the reducing
+// of a coordinator. The default is the number of CPUs.
+func Partitions(partitions int) Option {
+	return func(s *settings) error {
+		if partitions < 0 {
+			return errors.New(ErrInvalidConfiguration, errorMessages, "partitions", partitions)
+		} else if partitions == 0 {
+			partitions = runtime.NumCPU()
+		}
+		s.partitions = partitions
+		return nil
+	}
+}
+
+// Heartbeat sets how long a worker is considered alive after its
+// last heartbeat. Workers renew it three times per interval, the
+// coordinator checks it once. The default is 5 seconds.
+func Heartbeat(heartbeat time.Duration) Option {
+	return func(s *settings) error {
+		if heartbeat < 0 {
+			return errors.New(ErrInvalidConfiguration, errorMessages, "heartbeat", heartbeat)
+		} else if heartbeat == 0 {
+			heartbeat = defaultHeartbeat
+		}
+		s.heartbeat = heartbeat
+		return nil
+	}
+}
+
+// Attempts sets how often a task is tried before it's moved into the
+// list of dead tasks. Failed tasks are those whose Map() or Reduce()
+// panicked, which couldn't be decoded, or whose worker died. Dead
+// tasks let the coordinator fail. Coordinator and workers have to
+// use the same number. The default is 3.
+func Attempts(attempts int) Option {
+	return func(s *settings) error {
+		if attempts < 0 {
+			return errors.New(ErrInvalidConfiguration, errorMessages, "attempts", attempts)
+		} else if attempts == 0 {
+			attempts = defaultAttempts
+		}
+		s.attempts = attempts
+		return nil
+	}
+}
+
+// Timeout sets how long the coordinator waits for the job to
+// be done. The default of 0 waits without limit.
+func Timeout(timeout time.Duration) Option {
+	return func(s *settings) error {
+		if timeout < 0 {
+			return errors.New(ErrInvalidConfiguration, errorMessages, "timeout", timeout)
+		}
+		s.timeout = timeout
+		return nil
+	}
+}
+
+// EOF
@@ -0,0 +1,332 @@
+// Tideland Go Data Management - Redis Client - Map/Reduce - Unit Tests
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redismapreduce_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"encoding/gob"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tideland/godm/v2/mapreduce"
+	"github.com/tideland/godm/v3/redis"
+	"github.com/tideland/godm/v3/redis/redismapreduce"
+	"github.com/tideland/godm/v3/redis/redistest"
+	"github.com/tideland/gots/v3/asserts"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// Test the distributed map/reducing with multiple workers.
+func TestMapReduce(t *testing.T) {
+	forDatabases(t, func(assert asserts.Assertion, db *redis.Database) {
+		workers := startWorkers(assert, db, 3, newWordCounter(nil))
+
+		wc := newWordCounter(testLines)
+		err := redismapreduce.MapReduce(db, "words", wc, redismapreduce.Partitions(4))
+		assert.Nil(err)
+		assert.Equal(wc.counts, expectedCounts)
+
+		stopWorkers(assert, workers)
+	})
+}
+
+// Test the recovery of the task of a died worker.
+func TestWorkerFailure(t *testing.T) {
+	forDatabases(t, func(assert asserts.Assertion, db *redis.Database) {
+		heartbeat := redismapreduce.Heartbeat(300 * time.Millisecond)
+		wc := newWordCounter(testLines)
+		done := make(chan error, 1)
+		go func() {
+			done <- redismapreduce.MapReduce(db, "words", wc, heartbeat)
+		}()
+
+		// Let a worker without heartbeat take a task.
+		conn, err := db.Connection()
+		assert.Nil(err)
+		defer conn.Return()
+		for {
+			n, err := conn.DoInt("llen", "words:tasks")
+			assert.Nil(err)
+			if n == len(testLines) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		_, err = conn.Do("lmove", "words:tasks", "words:processing:died", "left", "right")
+		assert.Nil(err)
+		_, err = conn.Do("sadd", "words:workers", "died")
+		assert.Nil(err)
+
+		workers := startWorkers(assert, db, 2, newWordCounter(nil), heartbeat)
+		select {
+		case err := <-done:
+			assert.Nil(err)
+		case <-time.After(10 * time.Second):
+			assert.Fail("map/reducing not finished")
+		}
+		assert.Equal(wc.counts, expectedCounts)
+
+		stopWorkers(assert, workers)
+	})
+}
+
+// Test the dead tasks of always panicking mappings.
+func TestDeadTasks(t *testing.T) {
+	forDatabases(t, func(assert asserts.Assertion, db *redis.Database) {
+		attempts := redismapreduce.Attempts(2)
+		pwc := newWordCounter(nil)
+		pwc.panicking = "dog"
+		workers := startWorkers(assert, db, 2, pwc, attempts)
+
+		wc := newWordCounter(testLines)
+		done := make(chan error, 1)
+		go func() {
+			done <- redismapreduce.MapReduce(db, "words", wc, attempts)
+		}()
+		select {
+		case err := <-done:
+			assert.ErrorMatch(err, `.* task\(s\) of job "words" failed too often`)
+			assert.True(redismapreduce.IsDeadTasksError(err))
+		case <-time.After(10 * time.Second):
+			assert.Fail("map/reducing not failed")
+		}
+
+		// Workers continue after panics.
+		stopWorkers(assert, workers)
+	})
+}
+
+// Test the timeout of the coordinator.
+func TestTimeout(t *testing.T) {
+	forDatabases(t, func(assert asserts.Assertion, db *redis.Database) {
+		wc := newWordCounter(testLines)
+		err := redismapreduce.MapReduce(db, "words", wc, redismapreduce.Timeout(200*time.Millisecond))
+		assert.True(redismapreduce.IsTimeoutError(err))
+	})
+}
+
+// Test invalid options.
+func TestInvalidOptions(t *testing.T) {
+	forDatabases(t, func(assert asserts.Assertion, db *redis.Database) {
+		err := redismapreduce.MapReduce(db, "words", newWordCounter(nil), redismapreduce.Partitions(-1))
+		assert.True(redismapreduce.IsInvalidConfigurationError(err))
+		err = redismapreduce.MapReduce(db, "words", newWordCounter(nil), redismapreduce.Timeout(-time.Second))
+		assert.True(redismapreduce.IsInvalidConfigurationError(err))
+		_, err = redismapreduce.NewWorker(db, "words", newWordCounter(nil), redismapreduce.Heartbeat(-time.Second))
+		assert.True(redismapreduce.IsInvalidConfigurationError(err))
+		_, err = redismapreduce.NewWorker(db, "words", newWordCounter(nil), redismapreduce.Encoding(nil))
+		assert.True(redismapreduce.IsInvalidConfigurationError(err))
+		_, err = redismapreduce.NewWorker(db, "words", newWordCounter(nil), redismapreduce.Attempts(-1))
+		assert.True(redismapreduce.IsInvalidConfigurationError(err))
+	})
+}
+
+//--------------------
+// HELPER
+//--------------------
+
+// testDatabaseIndex defines the database for the tests.
+const testDatabaseIndex = 99
+
+// forDatabases runs the test function as subtests, once with the
+// live Redis and once with a fake server.
+func forDatabases(t *testing.T, f func(assert asserts.Assertion, db *redis.Database)) {
+	databases := []struct {
+		name string
+		open func(assert asserts.Assertion) (*redis.Database, func())
+	}{
+		{"redis", openDatabase},
+		{"fake", fakeDatabase},
+	}
+	for _, database := range databases {
+		open := database.open
+		t.Run(database.name, func(t *testing.T) {
+			assert := asserts.NewTestingAssertion(t, true)
+			db, restore := open(assert)
+			defer restore()
+			f(assert, db)
+		})
+	}
+}
+
+// openDatabase opens and flushes the test database.
+func openDatabase(assert asserts.Assertion) (*redis.Database, func()) {
+	db, err := redis.Open(redis.Index(testDatabaseIndex, ""))
+	assert.Nil(err)
+	conn, err := db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+	_, err = conn.Do("flushdb")
+	assert.Nil(err)
+	return db, func() { db.Close() }
+}
+
+// fakeDatabase starts a fake server emulating the scripts
+// of the jobs and opens its database.
+func fakeDatabase(assert asserts.Assertion) (*redis.Database, func()) {
+	srv, err := redistest.NewServer()
+	assert.Nil(err)
+	srv.Script(redismapreduce.AckScript, func(call redistest.Call, keys, args []string) interface{} {
+		if call("lrem", keys[0], "1", args[0]) == 0 {
+			return 0
+		}
+		for i := 2; i < len(keys); i++ {
+			call("rpush", keys[i], args[i-1])
+		}
+		call("incr", keys[1])
+		return 1
+	})
+	srv.Script(redismapreduce.RetryScript, func(call redistest.Call, keys, args []string) interface{} {
+		if call("lrem", keys[0], "1", args[0]) == 0 {
+			return 0
+		}
+		attempts, _ := strconv.ParseInt(args[1], 10, 64)
+		if call("hincrby", keys[1], args[0], "1").(int64) >= attempts {
+			call("rpush", keys[3], args[0])
+			return -1
+		}
+		call("rpush", keys[2], args[0])
+		return 1
+	})
+	db, err := redis.Open(redis.TcpConnection(srv.Addr(), 0), redis.Index(testDatabaseIndex, ""))
+	assert.Nil(err)
+	return db, func() {
+		db.Close()
+		srv.Close()
+	}
+}
+
+// startWorkers starts a number of workers for the words.
+func startWorkers(assert asserts.Assertion, db *redis.Database, n int, mr mapreduce.MapReducer, opts ...redismapreduce.Option) []*redismapreduce.Worker {
+	workers := []*redismapreduce.Worker{}
+	for i := 0; i < n; i++ {
+		w, err := redismapreduce.NewWorker(db, "words", mr, opts...)
+		assert.Nil(err)
+		workers = append(workers, w)
+	}
+	return workers
+}
+
+// stopWorkers stops the workers.
+func stopWorkers(assert asserts.Assertion, workers []*redismapreduce.Worker) {
+	for _, w := range workers {
+		assert.Nil(w.Stop())
+	}
+}
+
+// testLines are the input lines of the word counting.
+var testLines = []string{
+	"the quick brown fox",
+	"jumps over the lazy dog",
+	"the dog sleeps",
+	"a fox is quick",
+}
+
+// expectedCounts are the word counts of the test lines.
+var expectedCounts = map[string]int{
+	"the": 3, "quick": 2, "brown": 1, "fox": 2, "jumps": 1, "over": 1,
+	"lazy": 1, "dog": 2, "sleeps": 1, "a": 1, "is": 1,
+}
+
+// Line is one input line.
+type Line struct {
+	Number int
+	Text   string
+}
+
+func (l *Line) Key() string {
+	return strconv.Itoa(l.Number)
+}
+
+func (l *Line) Value() interface{} {
+	return l.Text
+}
+
+// Count is the count of a word.
+type Count struct {
+	Word  string
+	Count int
+}
+
+func (c *Count) Key() string {
+	return c.Word
+}
+
+func (c *Count) Value() interface{} {
+	return c.Count
+}
+
+func init() {
+	gob.Register(&Line{})
+	gob.Register(&Count{})
+}
+
+// wordCounter counts the words of lines. If panicking is
+// set it panics when mapping lines containing the word.
+type wordCounter struct {
+	lines     []string
+	counts    map[string]int
+	panicking string
+}
+
+func newWordCounter(lines []string) *wordCounter {
+	return &wordCounter{
+		lines:  lines,
+		counts: make(map[string]int),
+	}
+}
+
+func (wc *wordCounter) Input() mapreduce.KeyValueChan {
+	input := make(mapreduce.KeyValueChan)
+	go func() {
+		defer input.Close()
+		for i, line := range wc.lines {
+			input <- &Line{i, line}
+		}
+	}()
+	return input
+}
+
+func (wc *wordCounter) Map(in mapreduce.KeyValue, emit mapreduce.KeyValueChan) {
+	words := strings.Fields(in.Value().(string))
+	for _, word := range words {
+		if word == wc.panicking {
+			panic("panicking mapping")
+		}
+	}
+	for _, word := range words {
+		emit <- &Count{word, 1}
+	}
+}
+
+func (wc *wordCounter) Reduce(in, emit mapreduce.KeyValueChan) {
+	counts := make(map[string]int)
+	for kv := range in {
+		counts[kv.Key()] += kv.Value().(int)
+	}
+	for word, count := range counts {
+		emit <- &Count{word, count}
+	}
+}
+
+func (wc *wordCounter) Consume(in mapreduce.KeyValueChan) error {
+	for kv := range in {
+		wc.counts[kv.Key()] += kv.Value().(int)
+	}
+	return nil
+}
+
+// EOF
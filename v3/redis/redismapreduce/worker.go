@@ -0,0 +1,342 @@
+// Tideland Go Data Management - Redis Client - Map/Reduce - Worker
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redismapreduce
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tideland/goas/v2/identifier"
+	"github.com/tideland/goas/v2/logger"
+	"github.com/tideland/goas/v3/errors"
+	"github.com/tideland/godm/v2/mapreduce"
+	"github.com/tideland/godm/v3/redis"
+)
+
+//--------------------
+// WORKER
+//--------------------
+
+// Worker performs the map and reduce tasks of a job. Only the Map()
+// and Reduce() methods of its MapReducer are used.
+type Worker struct {
+	database *redis.Database
+	job      job
+	id       string
+	mr       mapreduce.MapReducer
+	settings *settings
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+	err      error
+}
+
+// NewWorker registers a worker for the job and starts it. Workers may
+// be started before or while the coordinator runs.
+func NewWorker(db *redis.Database, name string, mr mapreduce.MapReducer, opts ...Option) (*Worker, error) {
+	s, err := newSettings(opts)
+	if err != nil {
+		return nil, err
+	}
+	w := &Worker{
+		database: db,
+		job:      job(name),
+		id:       identifier.NewUUID().String(),
+		mr:       mr,
+		settings: s,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if err = w.heartbeat(); err != nil {
+		return nil, err
+	}
+	go w.backendLoop()
+	return w, nil
+}
+
+// Stop ends the worker after its current task and returns the
+// error which may have ended it before, e.g. a failing backend.
+func (w *Worker) Stop() error {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+	return w.err
+}
+
+// backendLoop takes and performs the tasks. Failed tasks are retried,
+// the worker continues. An error of the backend ends the loop without
+// deregistering, so that the task is recovered by the coordinator
+// after the heartbeat timed out.
+func (w *Worker) backendLoop() {
+	defer close(w.done)
+	beating := make(chan struct{})
+	defer close(beating)
+	go w.heartbeatLoop(beating)
+	for {
+		select {
+		case <-w.stop:
+			w.err = w.deregister()
+			return
+		default:
+		}
+		encoded, err := w.nextTask()
+		if err != nil {
+			w.err = err
+			return
+		}
+		if encoded == nil {
+			continue
+		}
+		if err = w.perform(encoded); err != nil {
+			if IsBackendError(err) {
+				w.err = err
+				return
+			}
+			if err = w.retry(encoded, err); err != nil {
+				w.err = err
+				return
+			}
+		}
+	}
+}
+
+// heartbeatLoop renews the heartbeat until the
+// passed channel is closed.
+func (w *Worker) heartbeatLoop(beating chan struct{}) {
+	ticker := time.NewTicker(w.settings.heartbeat / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-beating:
+			return
+		case <-ticker.C:
+			// A failing heartbeat is noticed by the
+			// coordinator, the task is recovered.
+			w.heartbeat()
+		}
+	}
+}
+
+// heartbeat signals that the worker is alive. It registers the
+// worker again, in case it has been removed after a stall.
+func (w *Worker) heartbeat() error {
+	conn, err := w.database.Connection()
+	if err != nil {
+		return w.failed(err)
+	}
+	defer conn.Return()
+	ms := int64(w.settings.heartbeat / time.Millisecond)
+	if _, err = conn.Do("set", w.job.alive(w.id), 1, "px", ms); err != nil {
+		return w.failed(err)
+	}
+	if _, err = conn.Do("sadd", w.job.workers(), w.id); err != nil {
+		return w.failed(err)
+	}
+	return nil
+}
+
+// deregister removes the worker after stopping.
+func (w *Worker) deregister() error {
+	conn, err := w.database.Connection()
+	if err != nil {
+		return w.failed(err)
+	}
+	defer conn.Return()
+	if _, err = conn.Do("srem", w.job.workers(), w.id); err != nil {
+		return w.failed(err)
+	}
+	if _, err = conn.Do("del", w.job.alive(w.id), w.job.processing(w.id)); err != nil {
+		return w.failed(err)
+	}
+	return nil
+}
+
+// nextTask moves the next task into the processing list of the
+// worker. Without a task in time it returns nil.
+func (w *Worker) nextTask() ([]byte, error) {
+	conn, err := w.database.Connection()
+	if err != nil {
+		return nil, w.failed(err)
+	}
+	defer conn.Return()
+	rs, err := conn.DoBlocking("blmove", taskTimeout, w.job.tasks(), w.job.processing(w.id), "left", "right")
+	if err != nil {
+		return nil, w.failed(err)
+	}
+	if rs.IsNil() {
+		return nil, nil
+	}
+	encoded, err := rs.ValueAt(0)
+	if err != nil {
+		return nil, w.failed(err)
+	}
+	if encoded.IsNil() {
+		// BLMOVE returns a nil value after its timeout.
+		return nil, nil
+	}
+	return encoded.Bytes(), nil
+}
+
+// perform performs a task and acknowledges it together
+// with pushing its results.
+func (w *Worker) perform(encoded []byte) error {
+	t, err := parseTask(encoded)
+	if err != nil {
+		return err
+	}
+	var results []interface{}
+	var counter string
+	switch t.kind {
+	case mapTask:
+		results, err = w.mapping(t)
+		counter = w.job.mapped()
+	case reduceTask:
+		results, err = w.reducing(t)
+		counter = w.job.reduced()
+	}
+	if err != nil {
+		return err
+	}
+	conn, err := w.database.Connection()
+	if err != nil {
+		return w.failed(err)
+	}
+	defer conn.Return()
+	if _, err = conn.Do("eval", w.job.ack(w.id, counter, encoded, results)...); err != nil {
+		return w.failed(err)
+	}
+	return nil
+}
+
+// retry counts the failed attempt of a task. It's pushed back to
+// the open tasks or, if it failed too often, to the dead ones.
+func (w *Worker) retry(encoded []byte, cause error) error {
+	logger.Warningf("task of job %q failed: %v", string(w.job), cause)
+	conn, err := w.database.Connection()
+	if err != nil {
+		return w.failed(err)
+	}
+	defer conn.Return()
+	if _, err = conn.Do("eval", w.job.retry(w.id, encoded, w.settings.attempts)...); err != nil {
+		return w.failed(err)
+	}
+	return nil
+}
+
+// mapping maps the key/value of a map task. The results are pairs
+// of the partition list and the encoded emitted key/value.
+func (w *Worker) mapping(t *task) ([]interface{}, error) {
+	kv, err := w.settings.codec.Decode(t.data)
+	if err != nil {
+		return nil, errors.Annotate(err, ErrEncoding, errorMessages)
+	}
+	emitted, err := collect(func(emit mapreduce.KeyValueChan) {
+		w.mr.Map(kv, emit)
+	})
+	if err != nil {
+		return nil, err
+	}
+	results := make([]interface{}, 0, len(emitted)*2)
+	for _, ekv := range emitted {
+		data, err := w.settings.codec.Encode(ekv)
+		if err != nil {
+			return nil, errors.Annotate(err, ErrEncoding, errorMessages)
+		}
+		partition := mapreduce.Partition(ekv.Key(), t.number)
+		results = append(results, w.job.partition(partition), data)
+	}
+	return results, nil
+}
+
+// reducing reduces the key/values of the partition of a reduce task.
+// The results are pairs of the output list and the encoded emitted
+// key/value. The partition list is kept, so that the task can be
+// repeated after a failure.
+func (w *Worker) reducing(t *task) ([]interface{}, error) {
+	conn, err := w.database.Connection()
+	if err != nil {
+		return nil, w.failed(err)
+	}
+	rs, err := conn.Do("lrange", w.job.partition(t.number), 0, -1)
+	conn.Return()
+	if err != nil {
+		return nil, w.failed(err)
+	}
+	kvs := []mapreduce.KeyValue{}
+	for _, value := range rs.Values() {
+		kv, err := w.settings.codec.Decode(value.Bytes())
+		if err != nil {
+			return nil, errors.Annotate(err, ErrEncoding, errorMessages)
+		}
+		kvs = append(kvs, kv)
+	}
+	in := make(mapreduce.KeyValueChan)
+	abort := make(chan struct{})
+	defer close(abort)
+	go func() {
+		defer in.Close()
+		for _, kv := range kvs {
+			select {
+			case in <- kv:
+			case <-abort:
+				return
+			}
+		}
+	}()
+	emitted, err := collect(func(emit mapreduce.KeyValueChan) {
+		w.mr.Reduce(in, emit)
+	})
+	if err != nil {
+		return nil, err
+	}
+	results := make([]interface{}, 0, len(emitted)*2)
+	for _, ekv := range emitted {
+		data, err := w.settings.codec.Encode(ekv)
+		if err != nil {
+			return nil, errors.Annotate(err, ErrEncoding, errorMessages)
+		}
+		results = append(results, w.job.output(), data)
+	}
+	return results, nil
+}
+
+// failed annotates an error accessing Redis.
+func (w *Worker) failed(err error) error {
+	return errors.Annotate(err, ErrBackend, errorMessages, string(w.job))
+}
+
+// collect calls the function with an emit channel and returns
+// the emitted key/values. A panic of the function is returned
+// as error.
+func collect(f func(emit mapreduce.KeyValueChan)) ([]mapreduce.KeyValue, error) {
+	emit := make(mapreduce.KeyValueChan)
+	failed := make(chan error, 1)
+	go func() {
+		defer emit.Close()
+		defer func() {
+			if r := recover(); r != nil {
+				failed <- errors.New(ErrPanic, errorMessages, r)
+				return
+			}
+			failed <- nil
+		}()
+		f(emit)
+	}()
+	emitted := []mapreduce.KeyValue{}
+	for kv := range emit {
+		emitted = append(emitted, kv)
+	}
+	return emitted, <-failed
+}
+
+// EOF
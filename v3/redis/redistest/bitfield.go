@@ -0,0 +1,217 @@
+// Tideland Go Data Management - Redis Client - Fake Server - Bit Field
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redistest
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+//--------------------
+// BIT FIELD
+//--------------------
+
+// bitField is one integer inside of a string.
+type bitField struct {
+	signed bool
+	bits   uint
+	offset uint
+}
+
+// Errors of invalid bit fields.
+const (
+	errBitFieldType   = failure("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+	errBitFieldOffset = failure("ERR bit offset is not an integer or out of range")
+)
+
+// parseBitField parses the encoding and the offset of a bit field.
+// The returned reply is nil if both are valid.
+func parseBitField(encoding, offset string) (bitField, interface{}) {
+	bf := bitField{}
+	if len(encoding) < 2 {
+		return bf, errBitFieldType
+	}
+	bits, err := strconv.ParseUint(encoding[1:], 10, 8)
+	valid := false
+	switch encoding[0] {
+	case 'i', 'I':
+		bf.signed = true
+		valid = err == nil && bits >= 1 && bits <= 64
+	case 'u', 'U':
+		valid = err == nil && bits >= 1 && bits <= 63
+	}
+	if !valid {
+		return bf, errBitFieldType
+	}
+	bf.bits = uint(bits)
+	n, err := strconv.ParseUint(strings.TrimPrefix(offset, "#"), 10, 32)
+	if err != nil {
+		return bf, errBitFieldOffset
+	}
+	bf.offset = uint(n)
+	if strings.HasPrefix(offset, "#") {
+		bf.offset *= bf.bits
+	}
+	return bf, nil
+}
+
+// get reads the bit field out of the data.
+func (bf bitField) get(data []byte) int64 {
+	var value uint64
+	for i := uint(0); i < bf.bits; i++ {
+		pos := bf.offset + i
+		bit := uint64(0)
+		if int(pos/8) < len(data) {
+			bit = uint64(data[pos/8]>>(7-pos%8)) & 1
+		}
+		value = value<<1 | bit
+	}
+	if bf.signed && bf.bits < 64 && value&(1<<(bf.bits-1)) != 0 {
+		value |= ^uint64(0) << bf.bits
+	}
+	return int64(value)
+}
+
+// set writes the bit field into the data and returns it.
+func (bf bitField) set(data []byte, value int64) []byte {
+	if end := int((bf.offset + bf.bits + 7) / 8); end > len(data) {
+		data = append(data, make([]byte, end-len(data))...)
+	}
+	for i := uint(0); i < bf.bits; i++ {
+		pos := bf.offset + i
+		mask := byte(1) << (7 - pos%8)
+		if uint64(value)>>(bf.bits-1-i)&1 == 1 {
+			data[pos/8] |= mask
+		} else {
+			data[pos/8] &^= mask
+		}
+	}
+	return data
+}
+
+// limit applies the overflow policy to the value. It
+// returns false if the value shall not be set.
+func (bf bitField) limit(value *big.Int, overflow string) (int64, bool) {
+	size := new(big.Int).Lsh(big.NewInt(1), bf.bits)
+	low, high := big.NewInt(0), new(big.Int).Sub(size, big.NewInt(1))
+	if bf.signed {
+		half := new(big.Int).Rsh(size, 1)
+		low.Neg(half)
+		high.Sub(half, big.NewInt(1))
+	}
+	if value.Cmp(low) >= 0 && value.Cmp(high) <= 0 {
+		return value.Int64(), true
+	}
+	switch overflow {
+	case "sat":
+		if value.Cmp(low) < 0 {
+			return low.Int64(), true
+		}
+		return high.Int64(), true
+	case "fail":
+		return 0, false
+	}
+	wrapped := new(big.Int).Mod(value, size)
+	if bf.signed && wrapped.Cmp(high) > 0 {
+		wrapped.Sub(wrapped, size)
+	}
+	return wrapped.Int64(), true
+}
+
+//--------------------
+// COMMANDS
+//--------------------
+
+func (ss *session) bitfield(args []string) interface{} {
+	return ss.bitFieldOperations(args, false)
+}
+
+func (ss *session) bitfieldRO(args []string) interface{} {
+	return ss.bitFieldOperations(args, true)
+}
+
+// bitFieldOperations performs the operations of BITFIELD
+// and BITFIELD_RO on the string at the key.
+func (ss *session) bitFieldOperations(args []string, readOnly bool) interface{} {
+	db := ss.database()
+	key := args[0]
+	data, _, valid := lookup[[]byte](db, key)
+	if !valid {
+		return errWrongType
+	}
+	results := []interface{}{}
+	overflow := "wrap"
+	changed := false
+	for i := 1; i < len(args); i++ {
+		op := strings.ToLower(args[i])
+		if readOnly && op != "get" {
+			return failure("ERR BITFIELD_RO only supports the GET subcommand")
+		}
+		switch op {
+		case "overflow":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			overflow = strings.ToLower(args[i+1])
+			switch overflow {
+			case "wrap", "sat", "fail":
+			default:
+				return failure("ERR Invalid OVERFLOW type specified")
+			}
+			i++
+			continue
+		case "get", "set", "incrby":
+		default:
+			return errSyntax
+		}
+		if i+2 >= len(args) || (op != "get" && i+3 >= len(args)) {
+			return errSyntax
+		}
+		bf, reply := parseBitField(args[i+1], args[i+2])
+		if reply != nil {
+			return reply
+		}
+		if op == "get" {
+			results = append(results, bf.get(data))
+			i += 2
+			continue
+		}
+		n, ok := new(big.Int).SetString(args[i+3], 10)
+		if !ok {
+			return errNotInteger
+		}
+		i += 3
+		old := bf.get(data)
+		if op == "incrby" {
+			n.Add(n, big.NewInt(old))
+		}
+		value, ok := bf.limit(n, overflow)
+		if !ok {
+			results = append(results, []byte(nil))
+			continue
+		}
+		data = bf.set(data, value)
+		changed = true
+		if op == "set" {
+			results = append(results, old)
+		} else {
+			results = append(results, value)
+		}
+	}
+	if changed {
+		db.keys[key] = data
+	}
+	return results
+}
+
+// EOF
@@ -0,0 +1,20 @@
+// Tideland Go Data Management - Redis Client - Fake Server
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// The redistest package provides an in-process fake Redis server
+// for tests which shall run without a live Redis.
+//
+// NewServer() starts a server listening on a free local port. It
+// keeps its data in memory and understands a subset of the Redis
+// commands, unknown ones are answered with an error. All received
+// commands are recorded, so tests can check what a client sent.
+//
+// Lua scripts aren't interpreted. Instead Script() registers a Go
+// function for the source of a script, EVAL calls it atomically.
+package redistest
+
+// EOF
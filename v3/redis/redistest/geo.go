@@ -0,0 +1,352 @@
+// Tideland Go Data Management - Redis Client - Fake Server - Geo
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redistest
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//--------------------
+// GEO HASH
+//--------------------
+
+// Limits of the geo hashes like used by Redis.
+const (
+	geoLatMin     = -85.05112878
+	geoLatMax     = 85.05112878
+	geoLonMin     = -180.0
+	geoLonMax     = 180.0
+	geoStep       = 26
+	earthRadius   = 6372797.560856
+	geoHashCells  = float64(1 << geoStep)
+	geoDegreesRad = math.Pi / 180.0
+)
+
+// geoEncode returns the 52 bit geo hash of the coordinates
+// with the latitude bits at the even positions.
+func geoEncode(lon, lat float64) uint64 {
+	latOffset := uint64((lat - geoLatMin) / (geoLatMax - geoLatMin) * geoHashCells)
+	lonOffset := uint64((lon - geoLonMin) / (geoLonMax - geoLonMin) * geoHashCells)
+	hash := uint64(0)
+	for i := 0; i < geoStep; i++ {
+		hash |= (latOffset >> i & 1) << (2 * i)
+		hash |= (lonOffset >> i & 1) << (2*i + 1)
+	}
+	return hash
+}
+
+// geoDecode returns the coordinates of the center of
+// the area of the geo hash.
+func geoDecode(hash uint64) (float64, float64) {
+	latOffset, lonOffset := uint64(0), uint64(0)
+	for i := 0; i < geoStep; i++ {
+		latOffset |= (hash >> (2 * i) & 1) << i
+		lonOffset |= (hash >> (2*i + 1) & 1) << i
+	}
+	center := func(offset uint64, lowest, highest float64) float64 {
+		low := lowest + float64(offset)/geoHashCells*(highest-lowest)
+		high := lowest + float64(offset+1)/geoHashCells*(highest-lowest)
+		return math.Max(lowest, math.Min(highest, (low+high)/2))
+	}
+	return center(lonOffset, geoLonMin, geoLonMax), center(latOffset, geoLatMin, geoLatMax)
+}
+
+// geoDistance returns the distance between two coordinates in meters.
+func geoDistance(lon1, lat1, lon2, lat2 float64) float64 {
+	lat1r, lat2r := lat1*geoDegreesRad, lat2*geoDegreesRad
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((lon2 - lon1) * geoDegreesRad / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// geoUnit returns the meters of a unit.
+func geoUnit(unit string) (float64, bool) {
+	switch strings.ToLower(unit) {
+	case "m":
+		return 1, true
+	case "km":
+		return 1000, true
+	case "mi":
+		return 1609.34, true
+	case "ft":
+		return 0.3048, true
+	}
+	return 0, false
+}
+
+//--------------------
+// COMMANDS
+//--------------------
+
+// geoSet contains the geo hashes of the members.
+type geoSet map[string]uint64
+
+func (ss *session) geoadd(args []string) interface{} {
+	key, args := args[0], args[1:]
+	var nx, xx, ch bool
+options:
+	for len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "ch":
+			ch = true
+		default:
+			break options
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 || len(args)%3 != 0 || (nx && xx) {
+		return errSyntax
+	}
+	db := ss.database()
+	set, found, valid := lookup[geoSet](db, key)
+	if !valid {
+		return errWrongType
+	}
+	hashes := map[string]uint64{}
+	for i := 0; i < len(args); i += 3 {
+		lon, lonErr := strconv.ParseFloat(args[i], 64)
+		lat, latErr := strconv.ParseFloat(args[i+1], 64)
+		if lonErr != nil || latErr != nil {
+			return errNotFloat
+		}
+		if lon < geoLonMin || lon > geoLonMax || lat < geoLatMin || lat > geoLatMax {
+			return failure("ERR invalid longitude,latitude pair " + args[i] + "," + args[i+1])
+		}
+		hashes[args[i+2]] = geoEncode(lon, lat)
+	}
+	if !found {
+		set = geoSet{}
+	}
+	changed := 0
+	for member, hash := range hashes {
+		old, exists := set[member]
+		if (nx && exists) || (xx && !exists) {
+			continue
+		}
+		if !exists || (ch && old != hash) {
+			changed++
+		}
+		set[member] = hash
+	}
+	if len(set) > 0 {
+		db.keys[key] = set
+	}
+	return changed
+}
+
+func (ss *session) geopos(args []string) interface{} {
+	set, _, valid := lookup[geoSet](ss.database(), args[0])
+	if !valid {
+		return errWrongType
+	}
+	positions := []interface{}{}
+	for _, member := range args[1:] {
+		hash, ok := set[member]
+		if !ok {
+			positions = append(positions, []interface{}(nil))
+			continue
+		}
+		lon, lat := geoDecode(hash)
+		positions = append(positions, []interface{}{formatFloat(lon), formatFloat(lat)})
+	}
+	return positions
+}
+
+func (ss *session) geodist(args []string) interface{} {
+	meters := 1.0
+	if len(args) > 3 {
+		return errSyntax
+	} else if len(args) == 3 {
+		var ok bool
+		if meters, ok = geoUnit(args[2]); !ok {
+			return errUnit
+		}
+	}
+	set, _, valid := lookup[geoSet](ss.database(), args[0])
+	if !valid {
+		return errWrongType
+	}
+	hashA, okA := set[args[1]]
+	hashB, okB := set[args[2]]
+	if !okA || !okB {
+		return []byte(nil)
+	}
+	lonA, latA := geoDecode(hashA)
+	lonB, latB := geoDecode(hashB)
+	return strconv.FormatFloat(geoDistance(lonA, latA, lonB, latB)/meters, 'f', 4, 64)
+}
+
+func (ss *session) geosearch(args []string) interface{} {
+	return ss.search(args[0], args[1:])
+}
+
+func (ss *session) georadius(args []string) interface{} {
+	search := append([]string{"fromlonlat", args[1], args[2], "byradius", args[3], args[4]}, args[5:]...)
+	return ss.search(args[0], search)
+}
+
+func (ss *session) georadiusbymember(args []string) interface{} {
+	search := append([]string{"frommember", args[1], "byradius", args[2], args[3]}, args[4:]...)
+	return ss.search(args[0], search)
+}
+
+// search searches the members of a geo set inside a radius or
+// a box. It's used by GEOSEARCH and the GEORADIUS commands.
+func (ss *session) search(key string, args []string) interface{} {
+	set, _, valid := lookup[geoSet](ss.database(), key)
+	if !valid {
+		return errWrongType
+	}
+	var lon, lat, radius, width, height, meters float64
+	var withDist, withHash, withCoord, desc, center, shape bool
+	count := -1
+	float := func(i int) (float64, bool) {
+		if i >= len(args) {
+			return 0, false
+		}
+		f, err := strconv.ParseFloat(args[i], 64)
+		return f, err == nil
+	}
+	for i := 0; i < len(args); i++ {
+		var ok bool
+		switch strings.ToLower(args[i]) {
+		case "fromlonlat":
+			var latOK bool
+			lon, ok = float(i + 1)
+			lat, latOK = float(i + 2)
+			if !ok || !latOK {
+				return errNotFloat
+			}
+			center = true
+			i += 2
+		case "frommember":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			hash, found := set[args[i+1]]
+			if !found {
+				return failure("ERR could not decode requested zset member")
+			}
+			lon, lat = geoDecode(hash)
+			center = true
+			i++
+		case "byradius":
+			if radius, ok = float(i + 1); !ok || i+2 >= len(args) {
+				return errSyntax
+			}
+			if meters, ok = geoUnit(args[i+2]); !ok {
+				return errUnit
+			}
+			shape = true
+			i += 2
+		case "bybox":
+			var heightOK bool
+			width, ok = float(i + 1)
+			height, heightOK = float(i + 2)
+			if !ok || !heightOK || i+3 >= len(args) {
+				return errSyntax
+			}
+			if meters, ok = geoUnit(args[i+3]); !ok {
+				return errUnit
+			}
+			shape = true
+			i += 3
+		case "asc":
+			desc = false
+		case "desc":
+			desc = true
+		case "count":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n <= 0 {
+				return failure("ERR COUNT must be > 0")
+			}
+			count = n
+			i++
+			if i+1 < len(args) && strings.ToLower(args[i+1]) == "any" {
+				i++
+			}
+		case "withdist":
+			withDist = true
+		case "withhash":
+			withHash = true
+		case "withcoord":
+			withCoord = true
+		default:
+			return errSyntax
+		}
+	}
+	if !center || !shape {
+		return errSyntax
+	}
+	type location struct {
+		member string
+		hash   uint64
+		dist   float64
+	}
+	locations := []location{}
+	for member, hash := range set {
+		mlon, mlat := geoDecode(hash)
+		dist := geoDistance(lon, lat, mlon, mlat)
+		if width > 0 {
+			// Check the distances along the latitude and the longitude.
+			if geoDistance(lon, lat, lon, mlat) > height*meters/2 ||
+				geoDistance(lon, mlat, mlon, mlat) > width*meters/2 {
+				continue
+			}
+		} else if dist > radius*meters {
+			continue
+		}
+		locations = append(locations, location{member, hash, dist})
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		if desc {
+			return locations[i].dist > locations[j].dist
+		}
+		return locations[i].dist < locations[j].dist
+	})
+	if count > 0 && count < len(locations) {
+		locations = locations[:count]
+	}
+	results := []interface{}{}
+	for _, l := range locations {
+		if !withDist && !withHash && !withCoord {
+			results = append(results, l.member)
+			continue
+		}
+		result := []interface{}{l.member}
+		if withDist {
+			result = append(result, strconv.FormatFloat(l.dist/meters, 'f', 4, 64))
+		}
+		if withHash {
+			result = append(result, int64(l.hash))
+		}
+		if withCoord {
+			mlon, mlat := geoDecode(l.hash)
+			result = append(result, []interface{}{formatFloat(mlon), formatFloat(mlat)})
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// EOF
@@ -0,0 +1,74 @@
+// Tideland Go Data Management - Redis Client - Fake Server - HyperLogLog
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redistest
+
+//--------------------
+// COMMANDS
+//--------------------
+
+// hyperLogLog contains the elements themselves, so the
+// fake server returns the exact cardinalities.
+type hyperLogLog map[string]bool
+
+func (ss *session) pfadd(args []string) interface{} {
+	db := ss.database()
+	hll, found, valid := lookup[hyperLogLog](db, args[0])
+	if !valid {
+		return errWrongType
+	}
+	changed := !found
+	if !found {
+		hll = hyperLogLog{}
+		db.keys[args[0]] = hll
+	}
+	for _, element := range args[1:] {
+		if !hll[element] {
+			hll[element] = true
+			changed = true
+		}
+	}
+	if changed {
+		return 1
+	}
+	return 0
+}
+
+func (ss *session) pfcount(args []string) interface{} {
+	union, ok := ss.union(args)
+	if !ok {
+		return errWrongType
+	}
+	return len(union)
+}
+
+func (ss *session) pfmerge(args []string) interface{} {
+	union, ok := ss.union(args)
+	if !ok {
+		return errWrongType
+	}
+	ss.database().keys[args[0]] = union
+	return statusOK
+}
+
+// union returns the union of the HyperLogLogs at the keys.
+func (ss *session) union(keys []string) (hyperLogLog, bool) {
+	db := ss.database()
+	union := hyperLogLog{}
+	for _, key := range keys {
+		hll, _, valid := lookup[hyperLogLog](db, key)
+		if !valid {
+			return nil, false
+		}
+		for element := range hll {
+			union[element] = true
+		}
+	}
+	return union, true
+}
+
+// EOF
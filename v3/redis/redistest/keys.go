@@ -0,0 +1,174 @@
+// Tideland Go Data Management - Redis Client - Fake Server - Keys and Strings
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redistest
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//--------------------
+// COMMANDS
+//--------------------
+
+func (ss *session) del(args []string) interface{} {
+	db := ss.database()
+	removed := 0
+	for _, key := range args {
+		if _, found, _ := lookup[interface{}](db, key); found {
+			db.remove(key)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (ss *session) exists(args []string) interface{} {
+	db := ss.database()
+	existing := 0
+	for _, key := range args {
+		if _, found, _ := lookup[interface{}](db, key); found {
+			existing++
+		}
+	}
+	return existing
+}
+
+func (ss *session) pttl(args []string) interface{} {
+	db := ss.database()
+	if _, found, _ := lookup[interface{}](db, args[0]); !found {
+		return -2
+	}
+	at, ok := db.expires[args[0]]
+	if !ok {
+		return -1
+	}
+	return int(time.Until(at) / time.Millisecond)
+}
+
+// scan returns all matching keys at once, so the returned
+// cursor is always 0. Patterns are matched like paths.
+func (ss *session) scan(args []string) interface{} {
+	if _, err := strconv.Atoi(args[0]); err != nil {
+		return failure("ERR invalid cursor")
+	}
+	pattern := "*"
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return errSyntax
+		}
+		switch strings.ToLower(args[i]) {
+		case "match":
+			pattern = args[i+1]
+		case "count":
+			if _, err := strconv.Atoi(args[i+1]); err != nil {
+				return errNotInteger
+			}
+		default:
+			return errSyntax
+		}
+	}
+	db := ss.database()
+	keys := []string{}
+	for key := range db.keys {
+		if _, found, _ := lookup[interface{}](db, key); !found {
+			continue
+		}
+		if matched, _ := path.Match(pattern, key); matched {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	reply := []interface{}{}
+	for _, key := range keys {
+		reply = append(reply, key)
+	}
+	return []interface{}{"0", reply}
+}
+
+func (ss *session) get(args []string) interface{} {
+	value, found, valid := lookup[[]byte](ss.database(), args[0])
+	switch {
+	case !valid:
+		return errWrongType
+	case !found:
+		return []byte(nil)
+	}
+	return value
+}
+
+// set supports the options NX, XX, EX, and PX.
+func (ss *session) set(args []string) interface{} {
+	db := ss.database()
+	key, value := args[0], []byte(args[1])
+	var nx, xx bool
+	var ttl time.Duration
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToLower(args[i]); option {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "ex", "px":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return failure("ERR invalid expire time in 'set' command")
+			}
+			ttl = time.Duration(n) * time.Millisecond
+			if option == "ex" {
+				ttl = time.Duration(n) * time.Second
+			}
+			i++
+		default:
+			return errSyntax
+		}
+	}
+	if nx && xx {
+		return errSyntax
+	}
+	_, found, _ := lookup[interface{}](db, key)
+	if (nx && found) || (xx && !found) {
+		return []byte(nil)
+	}
+	db.remove(key)
+	db.keys[key] = value
+	if ttl > 0 {
+		db.expires[key] = time.Now().Add(ttl)
+	}
+	return statusOK
+}
+
+func (ss *session) incr(args []string) interface{} {
+	db := ss.database()
+	value, found, valid := lookup[[]byte](db, args[0])
+	if !valid {
+		return errWrongType
+	}
+	n := int64(0)
+	if found {
+		var err error
+		if n, err = strconv.ParseInt(string(value), 10, 64); err != nil {
+			return errNotInteger
+		}
+	}
+	n++
+	db.keys[args[0]] = []byte(strconv.FormatInt(n, 10))
+	return n
+}
+
+// EOF
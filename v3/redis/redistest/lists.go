@@ -0,0 +1,193 @@
+// Tideland Go Data Management - Redis Client - Fake Server - Lists
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redistest
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+//--------------------
+// COMMANDS
+//--------------------
+
+// list contains the elements of a list, empty lists are removed.
+type list []string
+
+func (ss *session) lpush(args []string) interface{} {
+	return ss.push(args[0], args[1:], true)
+}
+
+func (ss *session) rpush(args []string) interface{} {
+	return ss.push(args[0], args[1:], false)
+}
+
+// push adds the elements at the head or the tail of the list.
+func (ss *session) push(key string, elements []string, head bool) interface{} {
+	db := ss.database()
+	l, _, valid := lookup[list](db, key)
+	if !valid {
+		return errWrongType
+	}
+	for _, element := range elements {
+		if head {
+			l = append(list{element}, l...)
+		} else {
+			l = append(l, element)
+		}
+	}
+	db.keys[key] = l
+	return len(l)
+}
+
+func (ss *session) llen(args []string) interface{} {
+	l, _, valid := lookup[list](ss.database(), args[0])
+	if !valid {
+		return errWrongType
+	}
+	return len(l)
+}
+
+func (ss *session) lrange(args []string) interface{} {
+	l, _, valid := lookup[list](ss.database(), args[0])
+	if !valid {
+		return errWrongType
+	}
+	start, startErr := strconv.Atoi(args[1])
+	stop, stopErr := strconv.Atoi(args[2])
+	if startErr != nil || stopErr != nil {
+		return errNotInteger
+	}
+	if start < 0 {
+		start += len(l)
+	}
+	if stop < 0 {
+		stop += len(l)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= len(l) {
+		stop = len(l) - 1
+	}
+	elements := []interface{}{}
+	for i := start; i <= stop; i++ {
+		elements = append(elements, l[i])
+	}
+	return elements
+}
+
+func (ss *session) lrem(args []string) interface{} {
+	db := ss.database()
+	l, _, valid := lookup[list](db, args[0])
+	if !valid {
+		return errWrongType
+	}
+	count, err := strconv.Atoi(args[1])
+	if err != nil {
+		return errNotInteger
+	}
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	removed := map[int]bool{}
+	for n := 0; n < len(l) && (limit == 0 || len(removed) < limit); n++ {
+		i := n
+		if count < 0 {
+			i = len(l) - 1 - n
+		}
+		if l[i] == args[2] {
+			removed[i] = true
+		}
+	}
+	remaining := list{}
+	for i, element := range l {
+		if !removed[i] {
+			remaining = append(remaining, element)
+		}
+	}
+	ss.store(args[0], remaining)
+	return len(removed)
+}
+
+func (ss *session) lmove(args []string) interface{} {
+	return ss.move(args[0], args[1], args[2], args[3])
+}
+
+// blmove waits for an element to move until the timeout
+// in seconds. A timeout of zero waits forever.
+func (ss *session) blmove(args []string) interface{} {
+	seconds, err := strconv.ParseFloat(args[4], 64)
+	if err != nil {
+		return failure("ERR timeout is not a float or out of range")
+	} else if seconds < 0 {
+		return failure("ERR timeout is negative")
+	}
+	var deadline time.Time
+	if seconds > 0 {
+		deadline = time.Now().Add(time.Duration(seconds * float64(time.Second)))
+	}
+	for {
+		moved := ss.move(args[0], args[1], args[2], args[3])
+		if element, ok := moved.([]byte); !ok || element != nil {
+			return moved
+		}
+		if !ss.wait(deadline) {
+			return []interface{}(nil)
+		}
+	}
+}
+
+// move pops an element from one end of the source and
+// pushes it at one end of the destination.
+func (ss *session) move(source, destination, from, to string) interface{} {
+	db := ss.database()
+	from, to = strings.ToLower(from), strings.ToLower(to)
+	for _, direction := range []string{from, to} {
+		if direction != "left" && direction != "right" {
+			return errSyntax
+		}
+	}
+	l, found, valid := lookup[list](db, source)
+	if !valid {
+		return errWrongType
+	}
+	if _, _, valid := lookup[list](db, destination); !valid {
+		return errWrongType
+	}
+	if !found {
+		return []byte(nil)
+	}
+	var element string
+	if from == "left" {
+		element, l = l[0], l[1:]
+	} else {
+		element, l = l[len(l)-1], l[:len(l)-1]
+	}
+	ss.store(source, l)
+	ss.push(destination, []string{element}, to == "left")
+	return []byte(element)
+}
+
+// store stores the list at the key, empty ones are removed.
+func (ss *session) store(key string, l list) {
+	db := ss.database()
+	if len(l) == 0 {
+		db.remove(key)
+		return
+	}
+	db.keys[key] = l
+}
+
+// EOF
@@ -0,0 +1,178 @@
+// Tideland Go Data Management - Redis Client - Fake Server - Unit Tests
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redistest_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tideland/godm/v3/redis"
+	"github.com/tideland/godm/v3/redis/redistest"
+	"github.com/tideland/gots/v3/asserts"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// Test the recording of commands and the error replies.
+func TestServer(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	srv, err := redistest.NewServer()
+	assert.Nil(err)
+	defer srv.Close()
+	db, err := redis.Open(redis.TcpConnection(srv.Addr(), 0), redis.Index(1, ""))
+	assert.Nil(err)
+	defer db.Close()
+	conn, err := db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+
+	value, err := conn.DoString("echo", "foo")
+	assert.Nil(err)
+	assert.Equal(value, "foo")
+	_, err = conn.Do("pfadd", "hll", "a")
+	assert.Nil(err)
+
+	// Error replies are returned as values.
+	value, err = conn.DoString("geopos", "hll", "a")
+	assert.Nil(err)
+	assert.Equal(value, "-WRONGTYPE Operation against a key holding the wrong kind of value")
+	value, err = conn.DoString("unknown")
+	assert.Nil(err)
+	assert.Equal(value, "-ERR unknown command 'unknown'")
+
+	// Databases are separated.
+	_, err = conn.Do("select", 2)
+	assert.Nil(err)
+	count, err := conn.DoInt("pfcount", "hll")
+	assert.Nil(err)
+	assert.Equal(count, 0)
+
+	assert.Equal(srv.Commands(), [][]string{
+		{"select", "1"},
+		{"echo", "foo"},
+		{"pfadd", "hll", "a"},
+		{"geopos", "hll", "a"},
+		{"unknown"},
+		{"select", "2"},
+		{"pfcount", "hll"},
+	})
+}
+
+// Test lists including blocking moves.
+func TestLists(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	srv, conn, restore := connect(assert)
+	defer restore()
+
+	n, err := conn.DoInt("rpush", "list", "a", "b", "a", "c")
+	assert.Nil(err)
+	assert.Equal(n, 4)
+	n, err = conn.DoInt("lrem", "list", -1, "a")
+	assert.Nil(err)
+	assert.Equal(n, 1)
+	value, err := conn.DoString("lmove", "list", "other", "left", "right")
+	assert.Nil(err)
+	assert.Equal(value, "a")
+	rs, err := conn.Do("lrange", "list", 0, -1)
+	assert.Nil(err)
+	assert.Equal(rs.Strings(), []string{"b", "c"})
+
+	// Blocked moves wait for pushes of other clients.
+	rs, err = conn.DoBlocking("blmove", 100*time.Millisecond, "empty", "other", "left", "right")
+	assert.Nil(err)
+	assert.True(rs.IsNil())
+	db, err := redis.Open(redis.TcpConnection(srv.Addr(), 0))
+	assert.Nil(err)
+	defer db.Close()
+	pusher, err := db.Connection()
+	assert.Nil(err)
+	defer pusher.Return()
+	pushed := make(chan error, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_, err := pusher.Do("rpush", "empty", "d")
+		pushed <- err
+	}()
+	value, err = conn.DoString("blmove", "empty", "other", "left", "right", 0)
+	assert.Nil(err)
+	assert.Equal(value, "d")
+	assert.Nil(<-pushed)
+	n, err = conn.DoInt("exists", "empty")
+	assert.Nil(err)
+	assert.Equal(n, 0)
+}
+
+// Test the expiration of keys, expired ones aren't scanned.
+func TestExpiration(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	_, conn, restore := connect(assert)
+	defer restore()
+
+	ok, err := conn.DoOK("set", "volatile", "foo", "px", 50)
+	assert.Nil(err)
+	assert.True(ok)
+	value, err := conn.DoString("get", "volatile")
+	assert.Nil(err)
+	assert.Equal(value, "foo")
+	ok, err = conn.DoOK("set", "stable", "bar")
+	assert.Nil(err)
+	assert.True(ok)
+	time.Sleep(100 * time.Millisecond)
+	n, err := conn.DoInt("exists", "volatile")
+	assert.Nil(err)
+	assert.Equal(n, 0)
+	cursor, keys, err := conn.DoScan("scan", 0, "match", "*able")
+	assert.Nil(err)
+	assert.Equal(cursor, 0)
+	assert.Equal(keys.Strings(), []string{"stable"})
+}
+
+// Test scripts emulated by Go functions.
+func TestScript(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	srv, conn, restore := connect(assert)
+	defer restore()
+
+	srv.Script("return redis.call('incr', KEYS[1])", func(call redistest.Call, keys, args []string) interface{} {
+		return call("incr", keys[0])
+	})
+	n, err := conn.DoInt("eval", "return redis.call('incr', KEYS[1])", 1, "counter")
+	assert.Nil(err)
+	assert.Equal(n, 1)
+	value, err := conn.DoString("eval", "return 1", 0)
+	assert.Nil(err)
+	assert.Equal(value, "-NOSCRIPT No matching script")
+}
+
+//--------------------
+// HELPER
+//--------------------
+
+// connect starts a server and returns it, a connection, and
+// a function for closing. This function shall be called with defer.
+func connect(assert asserts.Assertion) (*redistest.Server, *redis.Connection, func()) {
+	srv, err := redistest.NewServer()
+	assert.Nil(err)
+	db, err := redis.Open(redis.TcpConnection(srv.Addr(), 0))
+	assert.Nil(err)
+	conn, err := db.Connection()
+	assert.Nil(err)
+	return srv, conn, func() {
+		conn.Return()
+		db.Close()
+		srv.Close()
+	}
+}
+
+// EOF
@@ -0,0 +1,50 @@
+// Tideland Go Data Management - Redis Client - Fake Server - Scripting
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redistest
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"strconv"
+	"strings"
+)
+
+//--------------------
+// SCRIPTING
+//--------------------
+
+// Call executes a command inside of a script like redis.call() and
+// returns the reply. Integers are int or int64, bulk strings string
+// or []byte, and arrays []interface{}.
+type Call func(cmd string, args ...string) interface{}
+
+// ScriptFunc emulates a Lua script for EVAL. It's executed atomically
+// and gets the keys and the arguments. The returned reply is sent to
+// the client, e.g. an int for an integer reply.
+type ScriptFunc func(call Call, keys, args []string) interface{}
+
+func (ss *session) eval(args []string) interface{} {
+	f, ok := ss.server.scripts[args[0]]
+	if !ok {
+		return failure("NOSCRIPT No matching script")
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 0 {
+		return errNotInteger
+	} else if n > len(args)-2 {
+		return failure("ERR Number of keys can't be greater than number of args")
+	}
+	call := func(cmd string, args ...string) interface{} {
+		return ss.call(strings.ToLower(cmd), args)
+	}
+	return f(call, args[2:2+n], args[2+n:])
+}
+
+// EOF
@@ -0,0 +1,407 @@
+// Tideland Go Data Management - Redis Client - Fake Server
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redistest
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tideland/godm/v3/resp"
+)
+
+//--------------------
+// SERVER
+//--------------------
+
+// Server is an in-process fake Redis server.
+type Server struct {
+	listener  net.Listener
+	mux       sync.Mutex
+	changed   *sync.Cond
+	closed    bool
+	databases map[int]*database
+	scripts   map[string]ScriptFunc
+	commands  [][]string
+	clients   map[net.Conn]bool
+	wg        sync.WaitGroup
+}
+
+// NewServer starts a fake server listening on a free local port.
+func NewServer() (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		listener:  l,
+		databases: make(map[int]*database),
+		scripts:   make(map[string]ScriptFunc),
+		clients:   make(map[net.Conn]bool),
+	}
+	s.changed = sync.NewCond(&s.mux)
+	s.wg.Add(1)
+	go s.acceptLoop()
+	return s, nil
+}
+
+// Addr returns the address of the server.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Commands returns the received commands, each one
+// with its name followed by the arguments.
+func (s *Server) Commands() [][]string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	commands := make([][]string, len(s.commands))
+	copy(commands, s.commands)
+	return commands
+}
+
+// Script registers a function emulating the Lua script with
+// the source for EVAL.
+func (s *Server) Script(source string, f ScriptFunc) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.scripts[source] = f
+}
+
+// Close stops the server and closes the connections
+// of the clients. Blocked commands return.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.mux.Lock()
+	s.closed = true
+	s.changed.Broadcast()
+	for conn := range s.clients {
+		conn.Close()
+	}
+	s.mux.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// acceptLoop accepts the connections of the clients.
+func (s *Server) acceptLoop() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mux.Lock()
+		s.clients[conn] = true
+		s.mux.Unlock()
+		s.wg.Add(1)
+		go s.serve(conn)
+	}
+}
+
+// serve reads the commands of a client and writes the replies.
+func (s *Server) serve(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mux.Lock()
+		delete(s.clients, conn)
+		s.mux.Unlock()
+		conn.Close()
+	}()
+	ss := &session{
+		server: s,
+	}
+	reader := resp.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	for {
+		request, err := reader.ReadReply()
+		if err != nil {
+			return
+		}
+		if request.Kind != resp.KindArray || len(request.Elements) == 0 {
+			writeReply(writer, failure("ERR protocol error"))
+			writer.Flush()
+			return
+		}
+		args := make([]string, len(request.Elements))
+		for i, element := range request.Elements {
+			args[i] = string(element.Value)
+		}
+		s.mux.Lock()
+		s.commands = append(s.commands, args)
+		s.mux.Unlock()
+		writeReply(writer, ss.execute(strings.ToLower(args[0]), args[1:]))
+		if err = writer.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// database returns the database with the index.
+func (s *Server) database(index int) *database {
+	db, ok := s.databases[index]
+	if !ok {
+		db = newDatabase()
+		s.databases[index] = db
+	}
+	return db
+}
+
+//--------------------
+// SESSION
+//--------------------
+
+// handler contains the arity and the function executing a
+// command of a session and returning the reply.
+type handler struct {
+	arity int
+	f     func(ss *session, args []string) interface{}
+}
+
+// handlers maps the names of the known commands to their handlers.
+// The arity counts the command name too, negative ones are minimums.
+// It's initialized in init(), as EVAL refers to it.
+var handlers map[string]handler
+
+func init() {
+	handlers = map[string]handler{
+		"auth":                 {-2, (*session).auth},
+		"bitfield":             {-2, (*session).bitfield},
+		"bitfield_ro":          {-2, (*session).bitfieldRO},
+		"blmove":               {6, (*session).blmove},
+		"del":                  {-2, (*session).del},
+		"echo":                 {2, (*session).echo},
+		"eval":                 {-3, (*session).eval},
+		"exists":               {-2, (*session).exists},
+		"flushdb":              {-1, (*session).flushdb},
+		"geoadd":               {-5, (*session).geoadd},
+		"geodist":              {-4, (*session).geodist},
+		"geopos":               {-2, (*session).geopos},
+		"georadius":            {-6, (*session).georadius},
+		"georadius_ro":         {-6, (*session).georadius},
+		"georadiusbymember":    {-5, (*session).georadiusbymember},
+		"georadiusbymember_ro": {-5, (*session).georadiusbymember},
+		"geosearch":            {-7, (*session).geosearch},
+		"get":                  {2, (*session).get},
+		"hdel":                 {-3, (*session).hdel},
+		"hget":                 {3, (*session).hget},
+		"hincrby":              {4, (*session).hincrby},
+		"incr":                 {2, (*session).incr},
+		"llen":                 {2, (*session).llen},
+		"lmove":                {5, (*session).lmove},
+		"lpush":                {-3, (*session).lpush},
+		"lrange":               {4, (*session).lrange},
+		"lrem":                 {4, (*session).lrem},
+		"pfadd":                {-2, (*session).pfadd},
+		"pfcount":              {-2, (*session).pfcount},
+		"pfmerge":              {-2, (*session).pfmerge},
+		"ping":                 {-1, (*session).ping},
+		"pttl":                 {2, (*session).pttl},
+		"rpush":                {-3, (*session).rpush},
+		"sadd":                 {-3, (*session).sadd},
+		"scan":                 {-2, (*session).scan},
+		"select":               {2, (*session).selectDatabase},
+		"set":                  {-3, (*session).set},
+		"smembers":             {2, (*session).smembers},
+		"srem":                 {-3, (*session).srem},
+	}
+}
+
+// session is the state of the connection of a client.
+type session struct {
+	server *Server
+	index  int
+}
+
+// execute executes a command with the server locked. Waiting
+// blocked commands are signalled afterwards.
+func (ss *session) execute(cmd string, args []string) interface{} {
+	ss.server.mux.Lock()
+	defer ss.server.mux.Unlock()
+	defer ss.server.changed.Broadcast()
+	return ss.call(cmd, args)
+}
+
+// call executes a command with the server already locked.
+func (ss *session) call(cmd string, args []string) interface{} {
+	h, ok := handlers[cmd]
+	if !ok {
+		return failure(fmt.Sprintf("ERR unknown command '%s'", cmd))
+	}
+	n := len(args) + 1
+	if (h.arity >= 0 && n != h.arity) || (h.arity < 0 && n < -h.arity) {
+		return failure(fmt.Sprintf("ERR wrong number of arguments for '%s' command", cmd))
+	}
+	return h.f(ss, args)
+}
+
+// wait waits for changes until the deadline, a zero one waits
+// forever. It returns false if the deadline passed or the
+// server has been closed.
+func (ss *session) wait(deadline time.Time) bool {
+	s := ss.server
+	if s.closed || (!deadline.IsZero() && !time.Now().Before(deadline)) {
+		return false
+	}
+	if !deadline.IsZero() {
+		timer := time.AfterFunc(time.Until(deadline), func() {
+			s.mux.Lock()
+			defer s.mux.Unlock()
+			s.changed.Broadcast()
+		})
+		defer timer.Stop()
+	}
+	s.changed.Wait()
+	return !s.closed
+}
+
+// database returns the selected database.
+func (ss *session) database() *database {
+	return ss.server.database(ss.index)
+}
+
+func (ss *session) auth(args []string) interface{} {
+	return statusOK
+}
+
+func (ss *session) echo(args []string) interface{} {
+	return args[0]
+}
+
+func (ss *session) flushdb(args []string) interface{} {
+	delete(ss.server.databases, ss.index)
+	return statusOK
+}
+
+func (ss *session) ping(args []string) interface{} {
+	if len(args) > 0 {
+		return args[0]
+	}
+	return status("PONG")
+}
+
+func (ss *session) selectDatabase(args []string) interface{} {
+	index, err := strconv.Atoi(args[0])
+	if err != nil || index < 0 {
+		return failure("ERR DB index is out of range")
+	}
+	ss.index = index
+	return statusOK
+}
+
+//--------------------
+// DATABASE
+//--------------------
+
+// database contains the keys of one database and
+// the expiration times of the volatile ones.
+type database struct {
+	keys    map[string]interface{}
+	expires map[string]time.Time
+}
+
+func newDatabase() *database {
+	return &database{
+		keys:    make(map[string]interface{}),
+		expires: make(map[string]time.Time),
+	}
+}
+
+// expire removes the key if it has expired.
+func (db *database) expire(key string) {
+	if at, ok := db.expires[key]; ok && !time.Now().Before(at) {
+		db.remove(key)
+	}
+}
+
+// remove deletes the key and its expiration time.
+func (db *database) remove(key string) {
+	delete(db.keys, key)
+	delete(db.expires, key)
+}
+
+// lookup returns the value of the key. Found is false if the key
+// doesn't exist, valid is false if its value has another type.
+func lookup[T any](db *database, key string) (value T, found, valid bool) {
+	db.expire(key)
+	v, ok := db.keys[key]
+	if !ok {
+		return value, false, true
+	}
+	value, valid = v.(T)
+	return value, true, valid
+}
+
+//--------------------
+// REPLIES
+//--------------------
+
+// status is a simple string reply.
+type status string
+
+// failure is an error reply.
+type failure string
+
+// Common replies.
+const (
+	statusOK      = status("OK")
+	errSyntax     = failure("ERR syntax error")
+	errWrongType  = failure("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errNotInteger = failure("ERR value is not an integer or out of range")
+	errNotFloat   = failure("ERR value is not a valid float")
+	errUnit       = failure("ERR unsupported unit provided. please use M, KM, FT, MI")
+)
+
+// formatFloat formats a float for a bulk string reply.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// writeReply writes a reply. Strings are written as bulk strings,
+// nil byte slices and nil slices as null values.
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch r := reply.(type) {
+	case status:
+		fmt.Fprintf(w, "+%s\r\n", r)
+	case failure:
+		fmt.Fprintf(w, "-%s\r\n", r)
+	case int:
+		fmt.Fprintf(w, ":%d\r\n", r)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", r)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(r), r)
+	case []byte:
+		if r == nil {
+			w.WriteString("$-1\r\n")
+			return
+		}
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(r), r)
+	case []interface{}:
+		if r == nil {
+			w.WriteString("*-1\r\n")
+			return
+		}
+		fmt.Fprintf(w, "*%d\r\n", len(r))
+		for _, element := range r {
+			writeReply(w, element)
+		}
+	default:
+		panic(fmt.Sprintf("invalid reply type %T", reply))
+	}
+}
+
+// EOF
@@ -0,0 +1,147 @@
+// Tideland Go Data Management - Redis Client - Fake Server - Sets and Hashes
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redistest
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sort"
+	"strconv"
+)
+
+//--------------------
+// SETS
+//--------------------
+
+// set contains the members of a set, empty sets are removed.
+type set map[string]bool
+
+func (ss *session) sadd(args []string) interface{} {
+	db := ss.database()
+	s, found, valid := lookup[set](db, args[0])
+	if !valid {
+		return errWrongType
+	}
+	if !found {
+		s = set{}
+		db.keys[args[0]] = s
+	}
+	added := 0
+	for _, member := range args[1:] {
+		if !s[member] {
+			s[member] = true
+			added++
+		}
+	}
+	return added
+}
+
+func (ss *session) srem(args []string) interface{} {
+	db := ss.database()
+	s, _, valid := lookup[set](db, args[0])
+	if !valid {
+		return errWrongType
+	}
+	removed := 0
+	for _, member := range args[1:] {
+		if s[member] {
+			delete(s, member)
+			removed++
+		}
+	}
+	if len(s) == 0 {
+		db.remove(args[0])
+	}
+	return removed
+}
+
+// smembers returns the members sorted, so
+// that the replies are reproducible.
+func (ss *session) smembers(args []string) interface{} {
+	s, _, valid := lookup[set](ss.database(), args[0])
+	if !valid {
+		return errWrongType
+	}
+	members := []string{}
+	for member := range s {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	reply := []interface{}{}
+	for _, member := range members {
+		reply = append(reply, member)
+	}
+	return reply
+}
+
+//--------------------
+// HASHES
+//--------------------
+
+// hash contains the fields of a hash, empty hashes are removed.
+type hash map[string]string
+
+func (ss *session) hget(args []string) interface{} {
+	h, _, valid := lookup[hash](ss.database(), args[0])
+	if !valid {
+		return errWrongType
+	}
+	value, ok := h[args[1]]
+	if !ok {
+		return []byte(nil)
+	}
+	return value
+}
+
+func (ss *session) hdel(args []string) interface{} {
+	db := ss.database()
+	h, _, valid := lookup[hash](db, args[0])
+	if !valid {
+		return errWrongType
+	}
+	removed := 0
+	for _, field := range args[1:] {
+		if _, ok := h[field]; ok {
+			delete(h, field)
+			removed++
+		}
+	}
+	if len(h) == 0 {
+		db.remove(args[0])
+	}
+	return removed
+}
+
+func (ss *session) hincrby(args []string) interface{} {
+	db := ss.database()
+	h, found, valid := lookup[hash](db, args[0])
+	if !valid {
+		return errWrongType
+	}
+	increment, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return errNotInteger
+	}
+	n := int64(0)
+	if value, ok := h[args[1]]; ok {
+		if n, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return failure("ERR hash value is not an integer")
+		}
+	}
+	if !found {
+		h = hash{}
+		db.keys[args[0]] = h
+	}
+	n += increment
+	h[args[1]] = strconv.FormatInt(n, 10)
+	return n
+}
+
+// EOF
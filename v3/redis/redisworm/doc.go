@@ -0,0 +1,25 @@
+// Tideland Go Data Management - Redis Client - Write-once / Read-multiple
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// The redisworm package provides persistent and versioned counterparts of
+// the maps and sets of the worm package stored in Redis. So configurations
+// can be shared between the instances of a service.
+//
+// Each version is stored as hash or set under the name of the map or set
+// followed by the version number, e.g. "config:7", while "config:version"
+// contains the current one. A map or set is a snapshot of one version, so
+// its read methods like Get(), Keys(), and ContainsKeys() always return
+// consistent values. Apply() writes a new version atomically out of the
+// current one and the passed values and returns it as new snapshot.
+// Latest() returns the current version, At() a specific one.
+//
+// Only the last versions are retained, 10 by default, see Retained().
+// Reading an older version returns an error. The MultiMap has no
+// counterpart as Redis doesn't keep the types of the values.
+package redisworm
+
+// EOF
@@ -0,0 +1,61 @@
+// Tideland Go Data Management - Redis Client - Write-once / Read-multiple - Errors
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redisworm
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// Error codes.
+const (
+	ErrInvalidConfiguration = iota + 1
+	ErrInvalidVersion
+	ErrVersionExpired
+	ErrBackend
+)
+
+var errorMessages = errors.Messages{
+	ErrInvalidConfiguration: "invalid configuration value in field %q: %v",
+	ErrInvalidVersion:       "version %d of %q does not exist",
+	ErrVersionExpired:       "version %d of %q is not retained anymore",
+	ErrBackend:              "cannot access %q in Redis",
+}
+
+//--------------------
+// ERRORS
+//--------------------
+
+// IsInvalidConfigurationError tests the error type.
+func IsInvalidConfigurationError(err error) bool {
+	return errors.IsError(err, ErrInvalidConfiguration)
+}
+
+// IsInvalidVersionError tests the error type.
+func IsInvalidVersionError(err error) bool {
+	return errors.IsError(err, ErrInvalidVersion)
+}
+
+// IsVersionExpiredError tests the error type.
+func IsVersionExpiredError(err error) bool {
+	return errors.IsError(err, ErrVersionExpired)
+}
+
+// IsBackendError tests the error type.
+func IsBackendError(err error) bool {
+	return errors.IsError(err, ErrBackend)
+}
+
+// EOF
@@ -0,0 +1,391 @@
+// Tideland Go Data Management - Redis Client - Write-once / Read-multiple - Maps
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redisworm
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sort"
+
+	"github.com/tideland/godm/v2/worm"
+	"github.com/tideland/godm/v3/redis"
+)
+
+//--------------------
+// BOOL MAP
+//--------------------
+
+// BoolMap stores string keys and bool values in Redis, see worm.BoolMap.
+type BoolMap struct {
+	*versioned
+}
+
+// NewBoolMap returns the latest version of the bool map with the name.
+func NewBoolMap(db *redis.Database, name string, opts ...Option) (*BoolMap, error) {
+	v, err := newVersioned(db, name, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &BoolMap{v}, nil
+}
+
+// Latest returns the current version of the bool map.
+func (bm *BoolMap) Latest() (*BoolMap, error) {
+	v, err := bm.latest()
+	if err != nil {
+		return nil, err
+	}
+	return &BoolMap{v}, nil
+}
+
+// At returns the passed version of the bool map.
+func (bm *BoolMap) At(version int) (*BoolMap, error) {
+	v, err := bm.at(version)
+	if err != nil {
+		return nil, err
+	}
+	return &BoolMap{v}, nil
+}
+
+// Apply writes a new version of the bool map with all passed values and
+// those of the current version which are not in the values. It's based
+// on the current version, not on the one of this snapshot.
+func (bm *BoolMap) Apply(values worm.BoolMapValues) (*BoolMap, error) {
+	args := make([]interface{}, 0, len(values)*2)
+	for key, value := range values {
+		args = append(args, key, value)
+	}
+	v, err := bm.apply("hset", args)
+	if err != nil {
+		return nil, err
+	}
+	return &BoolMap{v}, nil
+}
+
+// Len returns the length of the bool map.
+func (bm *BoolMap) Len() (int, error) {
+	return bm.hashLen()
+}
+
+// Get returns the value of key in the bool map. If the key doesn't
+// exist the default bool (false) is returned.
+func (bm *BoolMap) Get(key string) (bool, error) {
+	value, err := bm.hashGet(key)
+	if err != nil || value.IsNil() {
+		return false, err
+	}
+	b, err := value.Bool()
+	if err != nil {
+		return false, bm.failed(err)
+	}
+	return b, nil
+}
+
+// Keys returns the sorted keys of the bool map.
+func (bm *BoolMap) Keys() ([]string, error) {
+	return bm.hashKeys()
+}
+
+// ContainsKeys tests if all the passed keys are in the bool map.
+func (bm *BoolMap) ContainsKeys(keys ...string) (bool, error) {
+	return bm.hashContainsKeys(keys)
+}
+
+// CopyAllValues returns a copy of the values of the bool map.
+func (bm *BoolMap) CopyAllValues() (worm.BoolMapValues, error) {
+	kvs, err := bm.hashGetAll()
+	if err != nil {
+		return nil, err
+	}
+	values := worm.BoolMapValues{}
+	for _, kv := range kvs {
+		value, err := kv.Value.Bool()
+		if err != nil {
+			return nil, bm.failed(err)
+		}
+		values[kv.Key] = value
+	}
+	return values, nil
+}
+
+//--------------------
+// INT MAP
+//--------------------
+
+// IntMap stores string keys and int values in Redis, see worm.IntMap.
+type IntMap struct {
+	*versioned
+}
+
+// NewIntMap returns the latest version of the int map with the name.
+func NewIntMap(db *redis.Database, name string, opts ...Option) (*IntMap, error) {
+	v, err := newVersioned(db, name, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &IntMap{v}, nil
+}
+
+// Latest returns the current version of the int map.
+func (im *IntMap) Latest() (*IntMap, error) {
+	v, err := im.latest()
+	if err != nil {
+		return nil, err
+	}
+	return &IntMap{v}, nil
+}
+
+// At returns the passed version of the int map.
+func (im *IntMap) At(version int) (*IntMap, error) {
+	v, err := im.at(version)
+	if err != nil {
+		return nil, err
+	}
+	return &IntMap{v}, nil
+}
+
+// Apply writes a new version of the int map with all passed values and
+// those of the current version which are not in the values. It's based
+// on the current version, not on the one of this snapshot.
+func (im *IntMap) Apply(values worm.IntMapValues) (*IntMap, error) {
+	args := make([]interface{}, 0, len(values)*2)
+	for key, value := range values {
+		args = append(args, key, value)
+	}
+	v, err := im.apply("hset", args)
+	if err != nil {
+		return nil, err
+	}
+	return &IntMap{v}, nil
+}
+
+// Len returns the length of the int map.
+func (im *IntMap) Len() (int, error) {
+	return im.hashLen()
+}
+
+// Get returns the value of key in the int map. If the key doesn't
+// exist the default int (0) is returned.
+func (im *IntMap) Get(key string) (int, error) {
+	value, err := im.hashGet(key)
+	if err != nil || value.IsNil() {
+		return 0, err
+	}
+	i, err := value.Int()
+	if err != nil {
+		return 0, im.failed(err)
+	}
+	return i, nil
+}
+
+// Keys returns the sorted keys of the int map.
+func (im *IntMap) Keys() ([]string, error) {
+	return im.hashKeys()
+}
+
+// ContainsKeys tests if all the passed keys are in the int map.
+func (im *IntMap) ContainsKeys(keys ...string) (bool, error) {
+	return im.hashContainsKeys(keys)
+}
+
+// CopyAllValues returns a copy of the values of the int map.
+func (im *IntMap) CopyAllValues() (worm.IntMapValues, error) {
+	kvs, err := im.hashGetAll()
+	if err != nil {
+		return nil, err
+	}
+	values := worm.IntMapValues{}
+	for _, kv := range kvs {
+		value, err := kv.Value.Int()
+		if err != nil {
+			return nil, im.failed(err)
+		}
+		values[kv.Key] = value
+	}
+	return values, nil
+}
+
+//--------------------
+// STRING MAP
+//--------------------
+
+// StringMap stores string keys and string values in Redis, see worm.StringMap.
+type StringMap struct {
+	*versioned
+}
+
+// NewStringMap returns the latest version of the string map with the name.
+func NewStringMap(db *redis.Database, name string, opts ...Option) (*StringMap, error) {
+	v, err := newVersioned(db, name, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &StringMap{v}, nil
+}
+
+// Latest returns the current version of the string map.
+func (sm *StringMap) Latest() (*StringMap, error) {
+	v, err := sm.latest()
+	if err != nil {
+		return nil, err
+	}
+	return &StringMap{v}, nil
+}
+
+// At returns the passed version of the string map.
+func (sm *StringMap) At(version int) (*StringMap, error) {
+	v, err := sm.at(version)
+	if err != nil {
+		return nil, err
+	}
+	return &StringMap{v}, nil
+}
+
+// Apply writes a new version of the string map with all passed values and
+// those of the current version which are not in the values. It's based
+// on the current version, not on the one of this snapshot.
+func (sm *StringMap) Apply(values worm.StringMapValues) (*StringMap, error) {
+	args := make([]interface{}, 0, len(values)*2)
+	for key, value := range values {
+		args = append(args, key, value)
+	}
+	v, err := sm.apply("hset", args)
+	if err != nil {
+		return nil, err
+	}
+	return &StringMap{v}, nil
+}
+
+// Len returns the length of the string map.
+func (sm *StringMap) Len() (int, error) {
+	return sm.hashLen()
+}
+
+// Get returns the value of key in the string map. If the key doesn't
+// exist the default string ("") is returned.
+func (sm *StringMap) Get(key string) (string, error) {
+	value, err := sm.hashGet(key)
+	if err != nil || value.IsNil() {
+		return "", err
+	}
+	return value.String(), nil
+}
+
+// Keys returns the sorted keys of the string map.
+func (sm *StringMap) Keys() ([]string, error) {
+	return sm.hashKeys()
+}
+
+// ContainsKeys tests if all the passed keys are in the string map.
+func (sm *StringMap) ContainsKeys(keys ...string) (bool, error) {
+	return sm.hashContainsKeys(keys)
+}
+
+// CopyAllValues returns a copy of the values of the string map.
+func (sm *StringMap) CopyAllValues() (worm.StringMapValues, error) {
+	kvs, err := sm.hashGetAll()
+	if err != nil {
+		return nil, err
+	}
+	values := worm.StringMapValues{}
+	for _, kv := range kvs {
+		values[kv.Key] = kv.Value.String()
+	}
+	return values, nil
+}
+
+//--------------------
+// HASH ACCESS
+//--------------------
+
+// hashLen returns the number of fields of the version.
+func (v *versioned) hashLen() (int, error) {
+	rs, err := v.read("hlen")
+	if err != nil {
+		return 0, err
+	}
+	length, err := rs.IntAt(1)
+	if err != nil {
+		return 0, v.failed(err)
+	}
+	return length, nil
+}
+
+// hashGet returns the value of one field of the version.
+func (v *versioned) hashGet(key string) (redis.Value, error) {
+	rs, err := v.read("hget", key)
+	if err != nil {
+		return nil, err
+	}
+	value, err := rs.ValueAt(1)
+	if err != nil {
+		return nil, v.failed(err)
+	}
+	return value, nil
+}
+
+// hashKeys returns the sorted fields of the version.
+func (v *versioned) hashKeys() ([]string, error) {
+	rs, err := v.read("hkeys")
+	if err != nil {
+		return nil, err
+	}
+	fields, err := rs.ResultSetAt(1)
+	if err != nil {
+		return nil, v.failed(err)
+	}
+	keys := fields.Strings()
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// hashContainsKeys tests if all fields exist in the version.
+func (v *versioned) hashContainsKeys(keys []string) (bool, error) {
+	if len(keys) == 0 {
+		return true, nil
+	}
+	rs, err := v.read("hmget", keys)
+	if err != nil {
+		return false, err
+	}
+	values, err := rs.ResultSetAt(1)
+	if err != nil {
+		return false, v.failed(err)
+	}
+	for index := 0; index < values.Len(); index++ {
+		value, err := values.ValueAt(index)
+		if err != nil {
+			return false, v.failed(err)
+		}
+		if value.IsNil() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// hashGetAll returns all fields and values of the version.
+func (v *versioned) hashGetAll() (redis.KeyValues, error) {
+	rs, err := v.read("hgetall")
+	if err != nil {
+		return nil, err
+	}
+	fields, err := rs.ResultSetAt(1)
+	if err != nil {
+		return nil, v.failed(err)
+	}
+	kvs, err := fields.KeyValues()
+	if err != nil {
+		return nil, v.failed(err)
+	}
+	return kvs, nil
+}
+
+// EOF
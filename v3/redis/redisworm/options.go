@@ -0,0 +1,42 @@
+// Tideland Go Data Management - Redis Client - Write-once / Read-multiple - Options
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redisworm
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// OPTIONS
+//--------------------
+
+const defaultRetained = 10
+
+// Option defines a function setting an option of a map or set.
+type Option func(v *versioned) error
+
+// Retained sets the number of versions retained in Redis
+// including the current one. Older versions are deleted
+// when a new one is applied. The default is 10.
+func Retained(retained int) Option {
+	return func(v *versioned) error {
+		if retained < 0 {
+			return errors.New(ErrInvalidConfiguration, errorMessages, "retained", retained)
+		} else if retained == 0 {
+			retained = defaultRetained
+		}
+		v.retained = retained
+		return nil
+	}
+}
+
+// EOF
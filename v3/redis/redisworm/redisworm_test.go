@@ -0,0 +1,210 @@
+// Tideland Go Data Management - Redis Client - Write-once / Read-multiple - Unit Tests
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redisworm_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"testing"
+
+	"github.com/tideland/godm/v2/worm"
+	"github.com/tideland/godm/v3/redis"
+	"github.com/tideland/godm/v3/redis/redisworm"
+	"github.com/tideland/gots/v3/asserts"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// Test the versions of a string map.
+func TestStringMap(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	db, restore := openDatabase(assert)
+	defer restore()
+
+	sm, err := redisworm.NewStringMap(db, "config")
+	assert.Nil(err)
+	assert.Equal(sm.Version(), 0)
+	length, err := sm.Len()
+	assert.Nil(err)
+	assert.Equal(length, 0)
+
+	// Apply new versions.
+	sma, err := sm.Apply(worm.StringMapValues{"a": "1", "b": "2"})
+	assert.Nil(err)
+	assert.Equal(sma.Version(), 1)
+	smb, err := sma.Apply(worm.StringMapValues{"b": "20", "c": "30"})
+	assert.Nil(err)
+	assert.Equal(smb.Version(), 2)
+
+	// Snapshots keep their values.
+	value, err := sma.Get("b")
+	assert.Nil(err)
+	assert.Equal(value, "2")
+	value, err = smb.Get("b")
+	assert.Nil(err)
+	assert.Equal(value, "20")
+	value, err = smb.Get("d")
+	assert.Nil(err)
+	assert.Equal(value, "")
+	keys, err := smb.Keys()
+	assert.Nil(err)
+	assert.Equal(keys, []string{"a", "b", "c"})
+	ok, err := sma.ContainsKeys("a", "b")
+	assert.Nil(err)
+	assert.True(ok)
+	ok, err = sma.ContainsKeys("a", "c")
+	assert.Nil(err)
+	assert.False(ok)
+	values, err := smb.CopyAllValues()
+	assert.Nil(err)
+	assert.Equal(values, worm.StringMapValues{"a": "1", "b": "20", "c": "30"})
+
+	// Other instances read the same versions.
+	other, err := redisworm.NewStringMap(db, "config")
+	assert.Nil(err)
+	assert.Equal(other.Version(), 2)
+	other, err = other.At(1)
+	assert.Nil(err)
+	value, err = other.Get("b")
+	assert.Nil(err)
+	assert.Equal(value, "2")
+	_, err = other.At(3)
+	assert.True(redisworm.IsInvalidVersionError(err))
+
+	// Apply is based on the current version.
+	smc, err := sma.Apply(worm.StringMapValues{"d": "40"})
+	assert.Nil(err)
+	assert.Equal(smc.Version(), 3)
+	ok, err = smc.ContainsKeys("a", "b", "c", "d")
+	assert.Nil(err)
+	assert.True(ok)
+	latest, err := sma.Latest()
+	assert.Nil(err)
+	assert.Equal(latest.Version(), 3)
+}
+
+// Test the typed maps.
+func TestTypedMaps(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	db, restore := openDatabase(assert)
+	defer restore()
+
+	bm, err := redisworm.NewBoolMap(db, "flags")
+	assert.Nil(err)
+	bm, err = bm.Apply(worm.BoolMapValues{"on": true, "off": false})
+	assert.Nil(err)
+	b, err := bm.Get("on")
+	assert.Nil(err)
+	assert.True(b)
+	bvs, err := bm.CopyAllValues()
+	assert.Nil(err)
+	assert.Equal(bvs, worm.BoolMapValues{"on": true, "off": false})
+
+	im, err := redisworm.NewIntMap(db, "limits")
+	assert.Nil(err)
+	im, err = im.Apply(worm.IntMapValues{"min": -5, "max": 5})
+	assert.Nil(err)
+	i, err := im.Get("min")
+	assert.Nil(err)
+	assert.Equal(i, -5)
+	i, err = im.Get("none")
+	assert.Nil(err)
+	assert.Equal(i, 0)
+	length, err := im.Len()
+	assert.Nil(err)
+	assert.Equal(length, 2)
+}
+
+// Test the versions of sets.
+func TestSets(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	db, restore := openDatabase(assert)
+	defer restore()
+
+	is, err := redisworm.NewIntSet(db, "ports")
+	assert.Nil(err)
+	isa, err := is.Apply(worm.Ints{80, 443, 80})
+	assert.Nil(err)
+	isb, err := isa.Apply(worm.Ints{8080})
+	assert.Nil(err)
+	ivs, err := isa.Values()
+	assert.Nil(err)
+	assert.Equal(ivs, worm.Ints{80, 443})
+	ivs, err = isb.Values()
+	assert.Nil(err)
+	assert.Equal(ivs, worm.Ints{80, 443, 8080})
+	ok, err := isb.Contains(80, 8080)
+	assert.Nil(err)
+	assert.True(ok)
+	ok, err = isa.Contains(80, 8080)
+	assert.Nil(err)
+	assert.False(ok)
+
+	ss, err := redisworm.NewStringSet(db, "hosts")
+	assert.Nil(err)
+	ss, err = ss.Apply(worm.Strings{"b", "a"})
+	assert.Nil(err)
+	svs, err := ss.Values()
+	assert.Nil(err)
+	assert.Equal(svs, worm.Strings{"a", "b"})
+	length, err := ss.Len()
+	assert.Nil(err)
+	assert.Equal(length, 2)
+}
+
+// Test the retaining of versions.
+func TestRetained(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	db, restore := openDatabase(assert)
+	defer restore()
+
+	_, err := redisworm.NewStringSet(db, "retained", redisworm.Retained(-1))
+	assert.True(redisworm.IsInvalidConfigurationError(err))
+
+	ss, err := redisworm.NewStringSet(db, "retained", redisworm.Retained(2))
+	assert.Nil(err)
+	first, err := ss.Apply(worm.Strings{"a"})
+	assert.Nil(err)
+	second, err := first.Apply(worm.Strings{"b"})
+	assert.Nil(err)
+	_, err = second.Apply(worm.Strings{"c"})
+	assert.Nil(err)
+
+	_, err = first.Values()
+	assert.True(redisworm.IsVersionExpiredError(err))
+	_, err = ss.At(1)
+	assert.True(redisworm.IsVersionExpiredError(err))
+	values, err := second.Values()
+	assert.Nil(err)
+	assert.Equal(values, worm.Strings{"a", "b"})
+}
+
+//--------------------
+// HELPER
+//--------------------
+
+// testDatabaseIndex defines the database for the tests.
+const testDatabaseIndex = 99
+
+// openDatabase opens and flushes the test database.
+func openDatabase(assert asserts.Assertion) (*redis.Database, func()) {
+	db, err := redis.Open(redis.Index(testDatabaseIndex, ""))
+	assert.Nil(err)
+	conn, err := db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+	_, err = conn.Do("flushdb")
+	assert.Nil(err)
+	return db, func() { db.Close() }
+}
+
+// EOF
@@ -0,0 +1,238 @@
+// Tideland Go Data Management - Redis Client - Write-once / Read-multiple - Sets
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redisworm
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sort"
+
+	"github.com/tideland/godm/v2/worm"
+	"github.com/tideland/godm/v3/redis"
+)
+
+//--------------------
+// INT SET
+//--------------------
+
+// IntSet contains ints only once in Redis, see worm.IntSet.
+type IntSet struct {
+	*versioned
+}
+
+// NewIntSet returns the latest version of the int set with the name.
+func NewIntSet(db *redis.Database, name string, opts ...Option) (*IntSet, error) {
+	v, err := newVersioned(db, name, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &IntSet{v}, nil
+}
+
+// Latest returns the current version of the int set.
+func (i *IntSet) Latest() (*IntSet, error) {
+	v, err := i.latest()
+	if err != nil {
+		return nil, err
+	}
+	return &IntSet{v}, nil
+}
+
+// At returns the passed version of the int set.
+func (i *IntSet) At(version int) (*IntSet, error) {
+	v, err := i.at(version)
+	if err != nil {
+		return nil, err
+	}
+	return &IntSet{v}, nil
+}
+
+// Apply writes a new version of the int set with all passed values and
+// those of the current version. It's based on the current version, not
+// on the one of this snapshot.
+func (i *IntSet) Apply(values worm.Ints) (*IntSet, error) {
+	args := make([]interface{}, len(values))
+	for index, value := range values {
+		args[index] = value
+	}
+	v, err := i.apply("sadd", args)
+	if err != nil {
+		return nil, err
+	}
+	return &IntSet{v}, nil
+}
+
+// Len returns the number of values in the set.
+func (i *IntSet) Len() (int, error) {
+	return i.setLen()
+}
+
+// Values returns the sorted values of the set.
+func (i *IntSet) Values() (worm.Ints, error) {
+	members, err := i.setMembers()
+	if err != nil {
+		return nil, err
+	}
+	values := make(worm.Ints, len(members))
+	for index, member := range members {
+		value, err := member.Int()
+		if err != nil {
+			return nil, i.failed(err)
+		}
+		values[index] = value
+	}
+	sort.Ints(values)
+	return values, nil
+}
+
+// Contains tests if all the passed values are in the set.
+func (i *IntSet) Contains(values ...int) (bool, error) {
+	args := make([]interface{}, len(values))
+	for index, value := range values {
+		args[index] = value
+	}
+	return i.setContains(args)
+}
+
+//--------------------
+// STRING SET
+//--------------------
+
+// StringSet contains strings only once in Redis, see worm.StringSet.
+type StringSet struct {
+	*versioned
+}
+
+// NewStringSet returns the latest version of the string set with the name.
+func NewStringSet(db *redis.Database, name string, opts ...Option) (*StringSet, error) {
+	v, err := newVersioned(db, name, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &StringSet{v}, nil
+}
+
+// Latest returns the current version of the string set.
+func (s *StringSet) Latest() (*StringSet, error) {
+	v, err := s.latest()
+	if err != nil {
+		return nil, err
+	}
+	return &StringSet{v}, nil
+}
+
+// At returns the passed version of the string set.
+func (s *StringSet) At(version int) (*StringSet, error) {
+	v, err := s.at(version)
+	if err != nil {
+		return nil, err
+	}
+	return &StringSet{v}, nil
+}
+
+// Apply writes a new version of the string set with all passed values
+// and those of the current version. It's based on the current version,
+// not on the one of this snapshot.
+func (s *StringSet) Apply(values worm.Strings) (*StringSet, error) {
+	args := make([]interface{}, len(values))
+	for index, value := range values {
+		args[index] = value
+	}
+	v, err := s.apply("sadd", args)
+	if err != nil {
+		return nil, err
+	}
+	return &StringSet{v}, nil
+}
+
+// Len returns the number of values in the set.
+func (s *StringSet) Len() (int, error) {
+	return s.setLen()
+}
+
+// Values returns the sorted values of the set.
+func (s *StringSet) Values() (worm.Strings, error) {
+	members, err := s.setMembers()
+	if err != nil {
+		return nil, err
+	}
+	values := make(worm.Strings, len(members))
+	for index, member := range members {
+		values[index] = member.String()
+	}
+	sort.Strings(values)
+	return values, nil
+}
+
+// Contains tests if all the passed values are in the set.
+func (s *StringSet) Contains(values ...string) (bool, error) {
+	args := make([]interface{}, len(values))
+	for index, value := range values {
+		args[index] = value
+	}
+	return s.setContains(args)
+}
+
+//--------------------
+// SET ACCESS
+//--------------------
+
+// setLen returns the number of members of the version.
+func (v *versioned) setLen() (int, error) {
+	rs, err := v.read("scard")
+	if err != nil {
+		return 0, err
+	}
+	length, err := rs.IntAt(1)
+	if err != nil {
+		return 0, v.failed(err)
+	}
+	return length, nil
+}
+
+// setMembers returns the members of the version.
+func (v *versioned) setMembers() (redis.Values, error) {
+	rs, err := v.read("smembers")
+	if err != nil {
+		return nil, err
+	}
+	members, err := rs.ResultSetAt(1)
+	if err != nil {
+		return nil, v.failed(err)
+	}
+	return members.Values(), nil
+}
+
+// setContains tests if all values are members of the version.
+func (v *versioned) setContains(values []interface{}) (bool, error) {
+	if len(values) == 0 {
+		return true, nil
+	}
+	rs, err := v.read("smismember", values...)
+	if err != nil {
+		return false, err
+	}
+	flags, err := rs.ResultSetAt(1)
+	if err != nil {
+		return false, v.failed(err)
+	}
+	for index := 0; index < flags.Len(); index++ {
+		member, err := flags.BoolAt(index)
+		if err != nil {
+			return false, v.failed(err)
+		}
+		if !member {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// EOF
@@ -0,0 +1,251 @@
+// Tideland Go Data Management - Redis Client - Write-once / Read-multiple - Versions
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redisworm
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"strconv"
+
+	"github.com/tideland/goas/v3/errors"
+	"github.com/tideland/godm/v3/redis"
+)
+
+//--------------------
+// VERSIONED
+//--------------------
+
+// applyScript copies the current version into the next one, adds
+// the values with the passed command, and deletes the version not
+// retained anymore. The keys are the one of the current version, the
+// current, the next, and the expired version. If the current version
+// changed meanwhile -1 is returned. The values are added in chunks,
+// so that the number of arguments of the command stays limited.
+const applyScript = `local current = tonumber(redis.call("get", KEYS[1]) or "0")
+if current ~= tonumber(ARGV[1]) then
+	return -1
+end
+redis.call("copy", KEYS[2], KEYS[3], "replace")
+for i = 3, #ARGV, 1000 do
+	redis.call(ARGV[2], KEYS[3], unpack(ARGV, i, math.min(i + 999, #ARGV)))
+end
+redis.call("set", KEYS[1], current + 1)
+redis.call("del", KEYS[4])
+return current + 1`
+
+// versioned is one version of a map or set stored in Redis.
+type versioned struct {
+	database *redis.Database
+	name     string
+	retained int
+	version  int
+}
+
+// newVersioned creates the latest version of a map or set.
+func newVersioned(db *redis.Database, name string, opts []Option) (*versioned, error) {
+	v := &versioned{
+		database: db,
+		name:     name,
+		retained: defaultRetained,
+	}
+	for _, opt := range opts {
+		if err := opt(v); err != nil {
+			return nil, err
+		}
+	}
+	current, err := v.current()
+	if err != nil {
+		return nil, err
+	}
+	v.version = current
+	return v, nil
+}
+
+// Name returns the name of the map or set.
+func (v *versioned) Name() string {
+	return v.name
+}
+
+// Version returns the version of the snapshot. The version
+// 0 is the empty one before the first Apply().
+func (v *versioned) Version() int {
+	return v.version
+}
+
+// at returns the passed version if it exists and is retained.
+func (v *versioned) at(version int) (*versioned, error) {
+	current, err := v.current()
+	if err != nil {
+		return nil, err
+	}
+	if err = v.check(version, current); err != nil {
+		return nil, err
+	}
+	at := *v
+	at.version = version
+	return &at, nil
+}
+
+// latest returns the current version.
+func (v *versioned) latest() (*versioned, error) {
+	current, err := v.current()
+	if err != nil {
+		return nil, err
+	}
+	latest := *v
+	latest.version = current
+	return &latest, nil
+}
+
+// apply writes a new version out of the current one and the
+// values, they are added with the passed command. If another
+// version has been applied meanwhile it is tried again.
+func (v *versioned) apply(cmd string, values []interface{}) (*versioned, error) {
+	conn, err := v.database.Connection()
+	if err != nil {
+		return nil, v.failed(err)
+	}
+	defer conn.Return()
+	for {
+		value, err := conn.DoValue("get", v.versionKey())
+		if err != nil {
+			return nil, v.failed(err)
+		}
+		current, err := versionOf(value)
+		if err != nil {
+			return nil, err
+		}
+		next := current + 1
+		keys := []interface{}{
+			v.versionKey(),
+			v.keyOf(current),
+			v.keyOf(next),
+			v.keyOf(next - v.retained),
+		}
+		args := append([]interface{}{applyScript, len(keys)}, keys...)
+		args = append(args, current, cmd)
+		rs, err := conn.Do("eval", append(args, values...)...)
+		if err != nil {
+			return nil, v.failed(err)
+		}
+		applied, err := rs.IntAt(0)
+		if err != nil {
+			return nil, v.failed(err)
+		}
+		if applied == next {
+			result := *v
+			result.version = next
+			return &result, nil
+		}
+	}
+}
+
+// read executes a command on the version of the snapshot. The current
+// version is read in the same transaction, so that an expired version
+// is detected. The result of the command is the second item of the
+// returned result set.
+func (v *versioned) read(cmd string, args ...interface{}) (*redis.ResultSet, error) {
+	conn, err := v.database.Connection()
+	if err != nil {
+		return nil, v.failed(err)
+	}
+	defer conn.Return()
+	if _, err = conn.Do("multi"); err != nil {
+		return nil, v.failed(err)
+	}
+	if _, err = conn.Do("get", v.versionKey()); err != nil {
+		conn.Do("discard")
+		return nil, v.failed(err)
+	}
+	if _, err = conn.Do(cmd, append([]interface{}{v.key()}, args...)...); err != nil {
+		conn.Do("discard")
+		return nil, v.failed(err)
+	}
+	rs, err := conn.Do("exec")
+	if err != nil {
+		return nil, v.failed(err)
+	}
+	value, err := rs.ValueAt(0)
+	if err != nil {
+		return nil, v.failed(err)
+	}
+	current, err := versionOf(value)
+	if err != nil {
+		return nil, err
+	}
+	if err = v.check(v.version, current); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// current reads the current version.
+func (v *versioned) current() (int, error) {
+	conn, err := v.database.Connection()
+	if err != nil {
+		return 0, v.failed(err)
+	}
+	defer conn.Return()
+	value, err := conn.DoValue("get", v.versionKey())
+	if err != nil {
+		return 0, v.failed(err)
+	}
+	return versionOf(value)
+}
+
+// check tests if the version exists and is retained.
+func (v *versioned) check(version, current int) error {
+	switch {
+	case version < 0 || version > current:
+		return errors.New(ErrInvalidVersion, errorMessages, version, v.name)
+	case version > 0 && version <= current-v.retained:
+		return errors.New(ErrVersionExpired, errorMessages, version, v.name)
+	}
+	return nil
+}
+
+// failed annotates an error accessing Redis.
+func (v *versioned) failed(err error) error {
+	return errors.Annotate(err, ErrBackend, errorMessages, v.name)
+}
+
+// versionKey returns the key of the current version.
+func (v *versioned) versionKey() string {
+	return v.name + ":version"
+}
+
+// prefix returns the prefix of the keys of the versions.
+func (v *versioned) prefix() string {
+	return v.name + ":"
+}
+
+// key returns the key of the version of the snapshot.
+func (v *versioned) key() string {
+	return v.keyOf(v.version)
+}
+
+// keyOf returns the key of the passed version.
+func (v *versioned) keyOf(version int) string {
+	return v.prefix() + strconv.Itoa(version)
+}
+
+// versionOf converts a read version, a missing one is 0.
+func versionOf(value redis.Value) (int, error) {
+	if value.IsNil() {
+		return 0, nil
+	}
+	version, err := value.Int()
+	if err != nil {
+		return 0, errors.Annotate(err, ErrBackend, errorMessages, "version")
+	}
+	return version, nil
+}
+
+// EOF
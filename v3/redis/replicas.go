@@ -0,0 +1,96 @@
+// Tideland Go Data Management - Redis Client - Replicas
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	stderrors "errors"
+	"sync"
+	"time"
+)
+
+//--------------------
+// REPLICA SET
+//--------------------
+
+// replica contains the pool of one replica and
+// until when it is considered unhealthy.
+type replica struct {
+	pool           *pool
+	unhealthyUntil time.Time
+}
+
+// replicaSet manages the replicas of a database.
+type replicaSet struct {
+	mux       sync.Mutex
+	selection ReplicaSelection
+	downtime  time.Duration
+	replicas  []*replica
+	next      int
+}
+
+// newReplicaSet creates the replica set for the
+// configured replica addresses.
+func newReplicaSet(db *Database) *replicaSet {
+	rs := &replicaSet{
+		selection: db.replicaSelection,
+		downtime:  db.replicaDowntime,
+	}
+	for _, address := range db.replicaAddresses {
+		rs.replicas = append(rs.replicas, &replica{
+			pool: newPool(db, address),
+		})
+	}
+	return rs
+}
+
+// choose selects a healthy replica. It returns nil if
+// none is available.
+func (rs *replicaSet) choose() *replica {
+	rs.mux.Lock()
+	defer rs.mux.Unlock()
+	now := time.Now()
+	var chosen *replica
+	for i := range rs.replicas {
+		r := rs.replicas[(rs.next+i)%len(rs.replicas)]
+		if now.Before(r.unhealthyUntil) {
+			continue
+		}
+		if rs.selection == RoundRobin {
+			rs.next = (rs.next + i + 1) % len(rs.replicas)
+			return r
+		}
+		if chosen == nil || r.pool.load() < chosen.pool.load() {
+			chosen = r
+		}
+	}
+	return chosen
+}
+
+// fail marks a replica as unhealthy for the downtime.
+func (rs *replicaSet) fail(r *replica) {
+	rs.mux.Lock()
+	defer rs.mux.Unlock()
+	r.unhealthyUntil = time.Now().Add(rs.downtime)
+}
+
+// close closes the pools of all replicas.
+func (rs *replicaSet) close() error {
+	rs.mux.Lock()
+	defer rs.mux.Unlock()
+	var errs []error
+	for _, r := range rs.replicas {
+		errs = append(errs, r.pool.close())
+	}
+	return stderrors.Join(errs...)
+}
+
+// EOF
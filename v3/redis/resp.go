@@ -13,267 +13,348 @@ package redis
 
 import (
 	"bufio"
-	"fmt"
+	"bytes"
+	"crypto/tls"
 	"io"
 	"net"
 	"strconv"
 
 	"github.com/tideland/goas/v3/errors"
+	"github.com/tideland/godm/v3/resp"
 )
 
 //--------------------
-// respONSE
+// BULK READER
 //--------------------
 
-// responseKind classifies a response of Redis.
-type responseKind int
-
-const (
-	receivingError responseKind = iota
-	timeoutError
-	statusResponse
-	errorResponse
-	integerResponse
-	bulkResponse
-	nullBulkResponse
-	arrayResponse
-)
-
-var responseKindDescr = map[responseKind]string{
-	receivingError:   "receiving error",
-	timeoutError:     "timeout error",
-	statusResponse:   "status",
-	errorResponse:    "error",
-	integerResponse:  "integer",
-	bulkResponse:     "bulk",
-	nullBulkResponse: "null-bulk",
-	arrayResponse:    "array",
-}
-
-// response contains one Redis response.
-type response struct {
-	kind   responseKind
-	length int
-	data   []byte
-	err    error
+// bulkReader reads the data of a bulk response directly
+// from the connection.
+type bulkReader struct {
+	reader    *bufio.Reader
+	remaining int64
+	done      bool
 }
 
-// value returns the data as value.
-func (r *response) value() Value {
-	return Value(r.data)
+// Read implements the io.Reader interface.
+func (br *bulkReader) Read(p []byte) (int, error) {
+	if br.remaining == 0 {
+		if err := br.finish(); err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > br.remaining {
+		p = p[:br.remaining]
+	}
+	n, err := br.reader.Read(p)
+	br.remaining -= int64(n)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return n, errors.Annotate(err, ErrConnectionBroken, errorMessages)
+	}
+	return n, nil
 }
 
-// errorValue returns the error as value.
-func (r *response) errorValue() Value {
-	errdata := []byte(r.err.Error())
-	return Value(errdata)
+// finish reads the trailing CRLF after the data.
+func (br *bulkReader) finish() error {
+	if br.done {
+		return nil
+	}
+	br.done = true
+	crlf := make([]byte, 2)
+	if _, err := io.ReadFull(br.reader, crlf); err != nil {
+		return errors.Annotate(err, ErrConnectionBroken, errorMessages)
+	}
+	return nil
 }
 
-// String creates a string representation of the response.
-func (r *response) String() string {
-	descr := responseKindDescr[r.kind]
-	return fmt.Sprintf("RESPONSE (Kind: %s / Length: %d / Value: %v / Error: %v)", descr, r.length, r.value(), r.err)
+// drain reads and discards all remaining data.
+func (br *bulkReader) drain() error {
+	_, err := io.Copy(io.Discard, br)
+	return err
 }
 
 //--------------------
 // REDIS SERIALIZATION PROTOCOL
 //--------------------
 
-// resp implements the Redis Serialization Protocol.
-type resp struct {
+// protocol implements the Redis Serialization Protocol.
+type protocol struct {
 	database *Database
 	conn     net.Conn
-	reader   *bufio.Reader
+	reader   *resp.Reader
+	writer   *bufio.Writer
+	scratch  []byte
+	ready    bool
 }
 
-// newResp establishes a connection to a Redis database
-// based on the configuration of the passed database
-// configuration.
-func newResp(db *Database) (*resp, error) {
+// newProtocol establishes a connection to a Redis database
+// at the address based on the configuration of the
+// passed database configuration.
+func newProtocol(db *Database, address string) (*protocol, error) {
 	// Dial the database and create the protocol instance.
-	conn, err := net.DialTimeout(db.network, db.address, db.timeout)
+	var conn net.Conn
+	var err error
+	if db.tls != nil && db.network == "tcp" {
+		dialer := &net.Dialer{Timeout: db.timeout}
+		conn, err = tls.DialWithDialer(dialer, db.network, address, db.tls)
+	} else {
+		conn, err = net.DialTimeout(db.network, address, db.timeout)
+	}
 	if err != nil {
 		return nil, errors.Annotate(err, ErrConnectionEstablishing, errorMessages)
 	}
-	r := &resp{
+	r := &protocol{
 		database: db,
 		conn:     conn,
-		reader:   bufio.NewReader(conn),
+		reader:   resp.NewReader(conn),
+		writer:   bufio.NewWriter(conn),
+		scratch:  make([]byte, 0, 64),
 	}
 	return r, nil
 }
 
 // sendCommand sends a command and possible arguments to the server.
-func (r *resp) sendCommand(cmd string, args ...interface{}) error {
-	lengthPart := r.buildLengthPart(args)
-	cmdPart := r.buildValuePart(cmd)
-	argsPart := r.buildArgumentsPart(args)
-
-	packet := join(lengthPart, cmdPart, argsPart)
-	_, err := r.conn.Write(packet)
-	if err != nil {
+// The command is encoded into the buffered writer of the protocol
+// and flushed at the end. Slices and maps are expanded into multiple
+// arguments, sized readers are streamed to the server.
+func (r *protocol) sendCommand(cmd string, args ...interface{}) error {
+	// First pass counts the arguments and checks if all can be
+	// encoded, so that no incomplete command will be written.
+	length := 1
+	for _, arg := range args {
+		n, err := r.walkArgument(arg, false)
+		if err != nil {
+			return err
+		}
+		length += n
+	}
+	if ci, ok := r.database.commands.lookup(cmd); ok && !ci.CheckArity(length-1) {
+		return errors.New(ErrInvalidArity, errorMessages, length-1, cmd)
+	}
+	// Commands changing the connection state need a new
+	// handshake before the connection is used again.
+	switch cmd {
+	case "auth", "select", "hello", "reset":
+		r.ready = false
+	}
+	// Second pass writes the command. Errors now leave an
+	// incomplete command, so the connection is broken.
+	r.writeHeader('*', length)
+	r.writeString(cmd)
+	for _, arg := range args {
+		if _, err := r.walkArgument(arg, true); err != nil {
+			if errors.IsError(err, ErrConnectionBroken) {
+				return err
+			}
+			return errors.Annotate(err, ErrConnectionBroken, errorMessages)
+		}
+	}
+	if err := r.writer.Flush(); err != nil {
 		return errors.Annotate(err, ErrConnectionBroken, errorMessages)
 	}
 	return nil
 }
 
-// receiveResponse retrieves a response from the server.
-func (r *resp) receiveResponse() *response {
-	// Receive first line.
-	line, err := r.reader.ReadBytes('\n')
+// receiveHeader retrieves the first line of a reply from the
+// server. In case of a bulk reply only the length is set, the
+// data has to be read by the caller.
+func (r *protocol) receiveHeader() (*resp.Reply, error) {
+	reply, err := r.reader.ReadHeader()
 	if err != nil {
-		return &response{receivingError, 0, nil, errors.Annotate(err, ErrConnectionBroken, errorMessages)}
+		return nil, errors.Annotate(err, ErrConnectionBroken, errorMessages)
 	}
-	content := line[1 : len(line)-2]
-	// First byte defines kind.
-	switch line[0] {
-	case '+':
-		// Status response.
-		return &response{statusResponse, 0, line[:len(line)-2], nil}
-	case '-':
-		// Error response.
-		return &response{errorResponse, 0, line[:len(line)-2], nil}
-	case ':':
-		// Integer response.
-		return &response{integerResponse, 0, content, nil}
-	case '$':
-		// Bulk response or null bulk response.
-		count, err := strconv.Atoi(string(content))
-		if err != nil {
-			return &response{receivingError, 0, nil, errors.Annotate(err, ErrServerResponse, errorMessages)}
-		}
-		if count == -1 {
-			// Null bulk response.
-			return &response{nullBulkResponse, 0, nil, nil}
-		}
-		// Receive the bulk data.
-		toRead := count + 2
-		buffer := make([]byte, toRead)
-		n, err := io.ReadFull(r.reader, buffer)
-		if err != nil {
-			return &response{receivingError, 0, nil, err}
-		}
-		if n < toRead {
-			return &response{receivingError, 0, nil, errors.New(ErrServerResponse, errorMessages)}
-		}
-		return &response{bulkResponse, 0, buffer[0:count], nil}
-	case '*':
-		// Array reply. Check for timeout.
-		length, err := strconv.Atoi(string(content))
-		if err != nil {
-			return &response{receivingError, 0, nil, errors.Annotate(err, ErrServerResponse, errorMessages)}
-		}
-		if length == -1 {
-			// Timeout.
-			return &response{timeoutError, 0, nil, nil}
+	return reply, nil
+}
+
+// receiveStream retrieves a reply from the server. A bulk
+// reply is returned as a reader on the connection, it has to
+// be read completely before the next command. All other replies
+// are returned as reader on their value, error replies as
+// error.
+func (r *protocol) receiveStream() (*bulkReader, error) {
+	reply, err := r.receiveHeader()
+	if err != nil {
+		return nil, err
+	}
+	switch reply.Kind {
+	case resp.KindError:
+		return nil, errors.New(ErrServerResponse, errorMessages, string(reply.Value))
+	case resp.KindNullArray:
+		return nil, errors.New(ErrTimeout, errorMessages)
+	case resp.KindNullBulk:
+		return nil, nil
+	case resp.KindBulk:
+		return &bulkReader{reader: r.reader.Buffered(), remaining: int64(reply.Length)}, nil
+	case resp.KindArray:
+		if err := r.reader.ReadElements(reply); err != nil {
+			return nil, errors.Annotate(err, ErrConnectionBroken, errorMessages)
 		}
-		return &response{arrayResponse, length, nil, nil}
+		return nil, errors.New(ErrIllegalItemType, errorMessages, 0, "bulk value")
 	}
-	return &response{receivingError, 0, nil, errors.New(ErrInvalidResponse, errorMessages, string(line))}
+	value := replyValue(reply)
+	return &bulkReader{reader: bufio.NewReader(bytes.NewReader(value)), remaining: int64(len(value)), done: true}, nil
 }
 
-// command sends a command to the server, receives all responses,
-// and converts them into a result set.
-func (r *resp) receiveResultSet() (*ResultSet, error) {
+// receiveResultSet receives a complete reply of a command
+// and converts it into a result set. A null array is the
+// timeout of a blocking command.
+func (r *protocol) receiveResultSet() (*ResultSet, error) {
+	reply, err := r.reader.ReadReply()
+	if err != nil {
+		return nil, errors.Annotate(err, ErrConnectionBroken, errorMessages)
+	}
+	switch reply.Kind {
+	case resp.KindNullArray:
+		return nil, errors.New(ErrTimeout, errorMessages)
+	case resp.KindArray:
+		return replyResultSet(reply), nil
+	}
 	result := newResultSet()
-	current := result
-	for {
-		response := r.receiveResponse()
-		switch response.kind {
-		case receivingError:
-			return nil, response.err
-		case timeoutError:
-			return nil, errors.New(ErrTimeout, errorMessages)
-		case statusResponse, errorResponse, integerResponse, bulkResponse, nullBulkResponse:
-			current.append(response.value())
-		case arrayResponse:
-			switch {
-			case current == result && current.Len() == 0:
-				current.length = response.length
-			case !current.allReceived():
-				next := newResultSet()
-				next.parent = current
-				current.append(next)
-				current = next
-				current.length = response.length
-			}
-		}
-		// Check if all values are received.
-		current = current.nextResultSet()
-		if current == nil {
-			return result, nil
+	result.append(replyValue(reply))
+	result.reply = reply
+	return result, nil
+}
+
+// replyResultSet converts the elements of an array into a
+// result set, nested arrays into nested result sets.
+func replyResultSet(reply *resp.Reply) *ResultSet {
+	if reply.Kind == resp.KindNullArray {
+		result := newNilResultSet()
+		result.reply = reply
+		return result
+	}
+	result := newResultSet()
+	for _, element := range reply.Elements {
+		if element.Kind == resp.KindArray || element.Kind == resp.KindNullArray {
+			result.append(replyResultSet(element))
+			continue
 		}
+		result.append(replyValue(element))
 	}
+	result.reply = reply
+	return result
 }
 
-// buildLengthPart creates the length part of a command.
-func (r *resp) buildLengthPart(args []interface{}) []byte {
-	length := 1
-	for _, arg := range args {
-		switch typedArg := arg.(type) {
-		case valuer:
-			length += typedArg.Len()
-		case Hash:
-			length += typedArg.Len() * 2
-		case Hashable:
-			length += typedArg.Len() * 2
-		default:
-			length++
-		}
+// replyValue returns the value of a reply. Status and error
+// replies keep their type marker.
+func replyValue(reply *resp.Reply) Value {
+	switch reply.Kind {
+	case resp.KindStatus:
+		return append(Value{'+'}, reply.Value...)
+	case resp.KindError:
+		return append(Value{'-'}, reply.Value...)
 	}
-	return join("*", length, "\r\n")
+	return reply.Value
 }
 
-// buildValuePart creates one value part of a command.
-func (r *resp) buildValuePart(value interface{}) []byte {
-	var raw []byte
-	if v, ok := value.(Value); ok {
-		raw = []byte(v)
-	} else {
-		raw = valueToBytes(value)
+// walkArgument walks through the scalars of one argument of a command
+// as expanded by expandArgument(). It returns the number of arguments
+// and writes them if wanted.
+func (r *protocol) walkArgument(arg interface{}, write bool) (int, error) {
+	length := 0
+	err := expandArgument(arg, func(scalar interface{}) error {
+		length++
+		return r.walkScalar(scalar, write)
+	})
+	if err != nil {
+		return 0, err
 	}
-	return join("$", len(raw), "\r\n", raw, "\r\n")
+	return length, nil
 }
 
-// buildArgumentsPart creates the the arguments parts of a command.
-func (r *resp) buildArgumentsPart(args []interface{}) []byte {
-	buildValuesPart := func(vs valuer) []byte {
-		tmp := []byte{}
-		for _, value := range vs.Values() {
-			tmp = append(tmp, r.buildValuePart(value)...)
+// walkScalar writes a single argument if wanted. Otherwise it only
+// checks if the encoding is possible.
+func (r *protocol) walkScalar(arg interface{}, write bool) error {
+	if !write {
+		if resp.EncodingMayFail(arg) {
+			_, err := resp.AppendArgument(r.scratch[:0], arg)
+			return err
 		}
-		return tmp
+		return nil
 	}
-	buildHashPart := func(h Hash) []byte {
-		tmp := []byte{}
-		for key, value := range h {
-			tmp = append(tmp, r.buildValuePart(key)...)
-			tmp = append(tmp, r.buildValuePart(value)...)
+	switch typedArg := arg.(type) {
+	case string:
+		r.writeString(typedArg)
+	case []byte:
+		r.writeBytes(typedArg)
+	case Value:
+		r.writeBytes(typedArg)
+	case *SizedReader:
+		r.writeHeader('$', int(typedArg.Size))
+		n, err := r.writer.ReadFrom(io.LimitReader(typedArg.Reader, typedArg.Size))
+		if err != nil {
+			return errors.Annotate(err, ErrConnectionBroken, errorMessages)
 		}
-		return tmp
-	}
-	tmp := []byte{}
-	part := []byte{}
-	for _, arg := range args {
-		switch typedArg := arg.(type) {
-		case valuer:
-			part = buildValuesPart(typedArg)
-		case Hash:
-			part = buildHashPart(typedArg)
-		case Hashable:
-			part = buildHashPart(typedArg.GetHash())
-		default:
-			part = r.buildValuePart(arg)
+		if n < typedArg.Size {
+			return errors.New(ErrConnectionBroken, errorMessages)
 		}
-		tmp = append(tmp, part...)
+		r.writer.WriteString("\r\n")
+	default:
+		encoded, err := resp.AppendArgument(r.scratch[:0], arg)
+		if err != nil {
+			return err
+		}
+		r.writeEncoded(encoded)
 	}
-	return tmp
+	return nil
+}
+
+// writeHeader writes a type marker followed by a length.
+func (r *protocol) writeHeader(marker byte, length int) {
+	r.scratch = strconv.AppendInt(r.scratch[:0], int64(length), 10)
+	r.writer.WriteByte(marker)
+	r.writer.Write(r.scratch)
+	r.writer.WriteString("\r\n")
+}
+
+// writeString writes a string as bulk value.
+func (r *protocol) writeString(s string) {
+	r.writeHeader('$', len(s))
+	r.writer.WriteString(s)
+	r.writer.WriteString("\r\n")
+}
+
+// writeBytes writes a byte slice as bulk value.
+func (r *protocol) writeBytes(b []byte) {
+	r.writeHeader('$', len(b))
+	r.writer.Write(b)
+	r.writer.WriteString("\r\n")
+}
+
+// writeEncoded writes an argument encoded into the scratch
+// buffer as bulk value.
+func (r *protocol) writeEncoded(b []byte) {
+	r.scratch = b
+	r.writer.WriteByte('$')
+	r.writer.Write(strconv.AppendInt(b[len(b):], int64(len(b)), 10))
+	r.writer.WriteString("\r\n")
+	r.writer.Write(b)
+	r.writer.WriteString("\r\n")
+}
+
+// handshake authenticates and selects the database.
+func (r *protocol) handshake() error {
+	if err := r.authenticate(); err != nil {
+		return err
+	}
+	if err := r.selectDatabase(); err != nil {
+		return err
+	}
+	r.ready = true
+	return nil
 }
 
 // authenticate authenticates against the server if configured.
-func (r *resp) authenticate() error {
+func (r *protocol) authenticate() error {
 	if r.database.password != "" {
-		err := r.sendCommand("auth", r.database.password)
+		args := []interface{}{r.database.password}
+		if r.database.username != "" {
+			args = []interface{}{r.database.username, r.database.password}
+		}
+		err := r.sendCommand("auth", args...)
 		if err != nil {
 			return errors.Annotate(err, ErrAuthenticate, errorMessages)
 		}
@@ -293,7 +374,7 @@ func (r *resp) authenticate() error {
 }
 
 // selectDatabase selects the database.
-func (r *resp) selectDatabase() error {
+func (r *protocol) selectDatabase() error {
 	err := r.sendCommand("select", r.database.index)
 	if err != nil {
 		return errors.Annotate(err, ErrSelectDatabase, errorMessages)
@@ -313,7 +394,7 @@ func (r *resp) selectDatabase() error {
 }
 
 // close ends the connection to Redis.
-func (r *resp) close() error {
+func (r *protocol) close() error {
 	return r.conn.Close()
 }
 
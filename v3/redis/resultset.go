@@ -16,6 +16,7 @@ import (
 	"strings"
 
 	"github.com/tideland/goas/v3/errors"
+	"github.com/tideland/godm/v3/resp"
 )
 
 //--------------------
@@ -24,14 +25,19 @@ import (
 
 // ResultSet contains a number of values or nested result sets.
 type ResultSet struct {
-	parent *ResultSet
-	items  []interface{}
-	length int
+	items []interface{}
+	null  bool
+	reply *resp.Reply
 }
 
 // newResultSet creates a new result set.
 func newResultSet() *ResultSet {
-	return &ResultSet{nil, []interface{}{}, 1}
+	return &ResultSet{[]interface{}{}, false, nil}
+}
+
+// newNilResultSet creates a result set for a nil response.
+func newNilResultSet() *ResultSet {
+	return &ResultSet{[]interface{}{}, true, nil}
 }
 
 // append adds a value/result set to the result set. It panics if it's
@@ -49,21 +55,17 @@ func (rs *ResultSet) append(item interface{}) {
 	}
 }
 
-// allReceived answers with true if all expected items are received.
-func (rs *ResultSet) allReceived() bool {
-	return len(rs.items) >= rs.length
+// IsNil returns true if the result set is the response of a
+// blocking command after its timeout without any data.
+func (rs *ResultSet) IsNil() bool {
+	return rs.null
 }
 
-// nextResultSet returns the parent stack upwards as long as all expected
-// items are received.
-func (rs *ResultSet) nextResultSet() *ResultSet {
-	if !rs.allReceived() {
-		return rs
-	}
-	if rs.parent == nil {
-		return nil
-	}
-	return rs.parent.nextResultSet()
+// Reply returns the reply of the server the result set has been
+// created of, e.g. to tell status and error replies from values.
+// It's nil if the result set hasn't been received from the server.
+func (rs *ResultSet) Reply() *resp.Reply {
+	return rs.reply
 }
 
 // Len returns the number of items in the result set.
@@ -151,7 +153,7 @@ func (rs *ResultSet) KeyValues() (KeyValues, error) {
 		if index%2 == 0 {
 			key = value.String()
 		} else {
-			kvs = append(kvs, KeyValue{key, value})
+			kvs = append(kvs, KeyValue{Key: key, Value: value})
 		}
 	}
 	return kvs, nil
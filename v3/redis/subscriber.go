@@ -0,0 +1,126 @@
+// Tideland Go Data Management - Redis Client - Subscriber
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redis
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"encoding/json"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// SUBSCRIBER
+//--------------------
+
+// Message contains a decoded payload published to a channel. If
+// the payload cannot be decoded Err contains the error while the
+// raw value is still available.
+type Message[T any] struct {
+	Pattern string
+	Channel string
+	Payload T
+	Raw     Value
+	Err     error
+}
+
+// Subscriber wraps a subscription and decodes the payloads of the
+// published values into the type T. Strings, byte slices, and values
+// are taken unchanged, all other types are decoded from JSON.
+type Subscriber[T any] struct {
+	sub *Subscription
+}
+
+// NewSubscriber creates a typed subscriber for the database. It
+// has to be closed with s.Close() after usage.
+func NewSubscriber[T any](db *Database) (*Subscriber[T], error) {
+	sub, err := db.Subscription()
+	if err != nil {
+		return nil, err
+	}
+	return &Subscriber[T]{sub}, nil
+}
+
+// Subscribe adds one or more channels to the subscriber.
+func (s *Subscriber[T]) Subscribe(channels ...string) error {
+	return s.sub.Subscribe(channels...)
+}
+
+// Unsubscribe removes one or more channels from the subscriber.
+func (s *Subscriber[T]) Unsubscribe(channels ...string) error {
+	return s.sub.Unsubscribe(channels...)
+}
+
+// Pop waits for the next message and decodes its payload. The
+// confirmations of (un)subscriptions are skipped. Errors while
+// decoding are returned inside the message, so the subscription
+// stays usable, only errors of the connection are returned.
+func (s *Subscriber[T]) Pop() (*Message[T], error) {
+	for {
+		pv, err := s.sub.Pop()
+		if err != nil {
+			return nil, err
+		}
+		if !pv.Kind.IsMessage() {
+			continue
+		}
+		msg := &Message[T]{
+			Pattern: pv.Pattern,
+			Channel: pv.Channel,
+			Raw:     pv.Value,
+		}
+		if err := decodePayload(pv.Value, &msg.Payload); err != nil {
+			msg.Err = errors.Annotate(err, ErrDecodePayload, errorMessages, pv.Channel)
+		}
+		return msg, nil
+	}
+}
+
+// Close ends the subscriber.
+func (s *Subscriber[T]) Close() error {
+	return s.sub.Close()
+}
+
+//--------------------
+// PAYLOAD
+//--------------------
+
+// encodePayload encodes a value to publish.
+func encodePayload(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case Value:
+		return v, nil
+	}
+	return json.Marshal(value)
+}
+
+// decodePayload decodes a published value into
+// the value pointed at by dest.
+func decodePayload(value Value, dest interface{}) error {
+	switch d := dest.(type) {
+	case *string:
+		*d = value.String()
+		return nil
+	case *[]byte:
+		*d = append([]byte(nil), value...)
+		return nil
+	case *Value:
+		*d = value
+		return nil
+	}
+	return json.Unmarshal(value, dest)
+}
+
+// EOF
@@ -12,8 +12,6 @@ package redis
 //--------------------
 
 import (
-	"strings"
-
 	"github.com/tideland/goas/v3/errors"
 )
 
@@ -25,7 +23,7 @@ import (
 // to subscribe and unsubscribe from channels.
 type Subscription struct {
 	database *Database
-	resp     *resp
+	resp     *protocol
 }
 
 // newSubscription creates a new subscription.
@@ -37,11 +35,13 @@ func newSubscription(db *Database) (*Subscription, error) {
 	if err != nil {
 		return nil, err
 	}
-	// Perform authentication and database selection.
-	err = sub.resp.authenticate()
-	if err != nil {
-		sub.database.pool.kill(sub.resp)
-		return nil, err
+	// Perform authentication and database selection
+	// if the connection is new.
+	if !sub.resp.ready {
+		if err = sub.resp.handshake(); err != nil {
+			sub.database.pool.kill(sub.resp)
+			return nil, err
+		}
 	}
 	return sub, nil
 }
@@ -89,42 +89,42 @@ func (sub *Subscription) Pop() (*PublishedValue, error) {
 		return nil, err
 	}
 	// Analyse the result.
-	kind, err := result.StringAt(0)
+	name, err := result.StringAt(0)
 	if err != nil {
 		return nil, err
 	}
-	switch {
-	case strings.Contains(kind, "message"):
-		channel, err := result.StringAt(1)
-		if err != nil {
+	pv := &PublishedValue{
+		Kind: parsePublishedKind(name),
+	}
+	switch pv.Kind {
+	case KindMessage:
+		if pv.Channel, err = result.StringAt(1); err != nil {
 			return nil, err
 		}
-		value, err := result.ValueAt(2)
-		if err != nil {
+		if pv.Value, err = result.ValueAt(2); err != nil {
 			return nil, err
 		}
-		return &PublishedValue{
-			Kind:    kind,
-			Channel: channel,
-			Value:   value,
-		}, nil
-	case strings.Contains(kind, "subscribe"):
-		channel, err := result.StringAt(1)
-		if err != nil {
+	case KindPMessage:
+		if pv.Pattern, err = result.StringAt(1); err != nil {
 			return nil, err
 		}
-		count, err := result.IntAt(2)
-		if err != nil {
+		if pv.Channel, err = result.StringAt(2); err != nil {
+			return nil, err
+		}
+		if pv.Value, err = result.ValueAt(3); err != nil {
+			return nil, err
+		}
+	case KindSubscribe, KindUnsubscribe, KindPSubscribe, KindPUnsubscribe:
+		if pv.Channel, err = result.StringAt(1); err != nil {
+			return nil, err
+		}
+		if pv.Count, err = result.IntAt(2); err != nil {
 			return nil, err
 		}
-		return &PublishedValue{
-			Kind:    kind,
-			Channel: channel,
-			Count:   count,
-		}, nil
 	default:
 		return nil, errors.New(ErrInvalidResponse, errorMessages, result)
 	}
+	return pv, nil
 }
 
 // Close ends the subscription.
@@ -133,6 +133,12 @@ func (sub *Subscription) Close() error {
 	if err != nil {
 		return err
 	}
+	// Unsubscribe channels and patterns, the last confirmation
+	// has no remaining subscriptions.
+	err = sub.resp.sendCommand("unsubscribe")
+	if err != nil {
+		return err
+	}
 	err = sub.resp.sendCommand("punsubscribe")
 	if err != nil {
 		return err
@@ -142,7 +148,7 @@ func (sub *Subscription) Close() error {
 		if err != nil {
 			return err
 		}
-		if pv.Kind == "punsubscribe" {
+		if pv.Kind == KindPUnsubscribe && pv.Count == 0 {
 			break
 		}
 	}
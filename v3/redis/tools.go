@@ -13,11 +13,12 @@ package redis
 
 import (
 	"fmt"
-	"strconv"
+	"reflect"
 	"strings"
 
 	"github.com/tideland/goas/v2/logger"
 	"github.com/tideland/goas/v3/errors"
+	"github.com/tideland/godm/v3/resp"
 )
 
 //--------------------
@@ -30,52 +31,10 @@ type valuer interface {
 	Values() []Value
 }
 
-// join builds a byte slice out of some parts.
-func join(parts ...interface{}) []byte {
-	tmp := []byte{}
-	for _, part := range parts {
-		switch typedPart := part.(type) {
-		case []byte:
-			tmp = append(tmp, typedPart...)
-		case string:
-			tmp = append(tmp, []byte(typedPart)...)
-		case int:
-			tmp = append(tmp, []byte(strconv.Itoa(typedPart))...)
-		default:
-			tmp = append(tmp, []byte(fmt.Sprintf("%v", typedPart))...)
-		}
-	}
-	return tmp
-}
-
-// valueToBytes converts a value into a byte slice.
+// valueToBytes converts a value into a byte slice like
+// NewValue() does.
 func valueToBytes(value interface{}) []byte {
-	switch typedValue := value.(type) {
-	case string:
-		return []byte(typedValue)
-	case []byte:
-		return typedValue
-	case []string:
-		return []byte(strings.Join(typedValue, "\r\n"))
-	case map[string]string:
-		tmp := make([]string, len(typedValue))
-		i := 0
-		for k, v := range typedValue {
-			tmp[i] = fmt.Sprintf("%v:%v", k, v)
-			i++
-		}
-		return []byte(strings.Join(tmp, "\r\n"))
-	case Hash:
-		tmp := []byte{}
-		for k, v := range typedValue {
-			kb := valueToBytes(k)
-			vb := valueToBytes(v)
-			tmp = append(tmp, kb...)
-			tmp = append(tmp, vb...)
-		}
-		return tmp
-	}
-	return []byte(fmt.Sprintf("%v", value))
+	return resp.NewValue(value)
 }
 
 // keyValueArgsToKeys converts a mixed number of keys and values
@@ -93,26 +52,110 @@ func keyValueArgsToKeys(kvs ...interface{}) []string {
 	return keys
 }
 
-// buildInterfaces creates a slice of interfaces out
-// of the passed arguments. Found string or interface
-// slices are flattened.
-func buildInterfaces(values ...interface{}) []interface{} {
-	ifcs := []interface{}{}
-	for _, value := range values {
-		switch v := value.(type) {
-		case []string:
-			for _, s := range v {
-				ifcs = append(ifcs, s)
+// expandArgument calls f for each scalar of an argument. Slices,
+// arrays, valuers, and hashes are expanded recursively, maps into
+// their keys and values. Byte slices are scalars.
+func expandArgument(arg interface{}, f func(scalar interface{}) error) error {
+	switch typedArg := arg.(type) {
+	case ArgEncoder, *SizedReader, string, []byte, Value, int, int64, uint64, float64, bool:
+		return f(arg)
+	case valuer:
+		for _, value := range typedArg.Values() {
+			if err := f(value); err != nil {
+				return err
+			}
+		}
+		return nil
+	case Values:
+		for _, value := range typedArg {
+			if err := f(value); err != nil {
+				return err
+			}
+		}
+		return nil
+	case Hash:
+		for key, value := range typedArg {
+			if err := f(key); err != nil {
+				return err
+			}
+			if err := f(value); err != nil {
+				return err
+			}
+		}
+		return nil
+	case Hashable:
+		return expandArgument(typedArg.GetHash(), f)
+	case []string:
+		for _, s := range typedArg {
+			if err := f(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	case [][]byte:
+		for _, b := range typedArg {
+			if err := f(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		for _, element := range typedArg {
+			if err := expandArgument(element, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]string:
+		for key, value := range typedArg {
+			if err := f(key); err != nil {
+				return err
+			}
+			if err := f(value); err != nil {
+				return err
 			}
-		case []interface{}:
-			for _, i := range v {
-				ifcs = append(ifcs, i)
+		}
+		return nil
+	}
+	// Expand other slices, arrays, and maps using reflection.
+	rv := reflect.ValueOf(arg)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := expandArgument(rv.Index(i).Interface(), f); err != nil {
+				return err
 			}
-		default:
-			ifcs = append(ifcs, v)
 		}
+		return nil
+	case reflect.Map:
+		iter := rv.MapRange()
+		for iter.Next() {
+			if err := f(iter.Key().Interface()); err != nil {
+				return err
+			}
+			if err := f(iter.Value().Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return f(arg)
+}
+
+// expandArguments returns the scalars of the arguments
+// in the order they are sent to the server.
+func expandArguments(args []interface{}) []interface{} {
+	scalars := make([]interface{}, 0, len(args))
+	for _, arg := range args {
+		expandArgument(arg, func(scalar interface{}) error {
+			scalars = append(scalars, scalar)
+			return nil
+		})
 	}
-	return ifcs
+	return scalars
 }
 
 // containsPatterns checks, if the channel contains a pattern
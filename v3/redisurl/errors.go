@@ -0,0 +1,68 @@
+// Tideland Go Data Management - Redis URL - Errors
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redisurl
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// Error codes. They don't overlap with the codes of the redis
+// packages and of the resp package.
+const (
+	ErrInvalidURL = iota + 2000
+	ErrInvalidValue
+)
+
+var errorMessages = errors.Messages{
+	ErrInvalidURL:   "invalid URL: %v",
+	ErrInvalidValue: "invalid value %q for %s",
+}
+
+//--------------------
+// ERROR
+//--------------------
+
+// IsInvalidURLError checks for an URL which cannot be parsed.
+func IsInvalidURLError(err error) bool {
+	return errors.IsError(err, ErrInvalidURL)
+}
+
+// IsInvalidValueError checks for an invalid value of a setting.
+func IsInvalidValueError(err error) bool {
+	return errors.IsError(err, ErrInvalidValue)
+}
+
+//--------------------
+// REPORT
+//--------------------
+
+// Report is the validation report returned if settings are
+// invalid. It contains one error per invalid value.
+type Report []error
+
+// Error returns the errors of the report as one string.
+func (r Report) Error() string {
+	errs := make([]string, len(r))
+	for i, err := range r {
+		errs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d invalid setting(s): %s", len(r), strings.Join(errs, " / "))
+}
+
+// EOF
@@ -0,0 +1,235 @@
+// Tideland Go Data Management - Redis URL
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package redisurl
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	defaultHost = "127.0.0.1"
+	defaultPort = "6379"
+)
+
+// envKeys maps the suffixes of the environment variables
+// to the keys of the URL query.
+var envKeys = []struct {
+	suffix string
+	key    string
+}{
+	{"DATABASE", "db"},
+	{"USERNAME", "username"},
+	{"PASSWORD", "password"},
+	{"POOL_SIZE", "pool_size"},
+	{"TIMEOUT", "timeout"},
+}
+
+//--------------------
+// SETTINGS
+//--------------------
+
+// Settings contains the values for a Redis connection. Zero
+// values stand for the defaults of the clients.
+type Settings struct {
+	// Network is "tcp" or "unix".
+	Network string
+
+	// Address is the host and port or the path of the
+	// Unix socket.
+	Address string
+
+	// TLS is true if the connection has to use TLS.
+	TLS bool
+
+	// Username and Password are used for the authentication,
+	// the username is only needed for access control lists.
+	Username string
+	Password string
+
+	// Database is the number of the database to select.
+	Database int
+
+	// PoolSize is the number of pooled connections.
+	PoolSize int
+
+	// Timeout is the timeout for connecting the server.
+	Timeout time.Duration
+}
+
+// String returns the settings as URL, the password is hidden.
+func (s *Settings) String() string {
+	u := url.URL{Scheme: "redis", Host: s.Address}
+	switch {
+	case s.Network == "unix":
+		u = url.URL{Scheme: "unix", Path: s.Address}
+	case s.TLS:
+		u.Scheme = "rediss"
+	}
+	if s.Username != "" || s.Password != "" {
+		u.User = url.UserPassword(s.Username, "xxxxx")
+	}
+	query := url.Values{}
+	query.Set("db", strconv.Itoa(s.Database))
+	if s.PoolSize > 0 {
+		query.Set("pool_size", strconv.Itoa(s.PoolSize))
+	}
+	if s.Timeout > 0 {
+		query.Set("timeout", s.Timeout.String())
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// Parse parses a Redis URL. The schemes are "redis" and "rediss"
+// for TCP, the latter with TLS, and "unix" for Unix sockets. The
+// database is the path of TCP URLs or the query parameter "db".
+// Further parameters are "pool_size" and "timeout".
+func Parse(rawurl string) (*Settings, error) {
+	s := &Settings{}
+	if report := s.parseURL(rawurl); len(report) > 0 {
+		return nil, report
+	}
+	return s, nil
+}
+
+// FromEnv reads the settings from environment variables starting
+// with the prefix and an underscore. <PREFIX>_URL is parsed first,
+// <PREFIX>_DATABASE, <PREFIX>_USERNAME, <PREFIX>_PASSWORD,
+// <PREFIX>_POOL_SIZE, and <PREFIX>_TIMEOUT override its values.
+// Without any variable the settings are empty.
+func FromEnv(prefix string) (*Settings, error) {
+	prefix = strings.ToUpper(prefix)
+	s := &Settings{}
+	report := Report{}
+	if rawurl, ok := os.LookupEnv(prefix + "_URL"); ok {
+		report = append(report, s.parseURL(rawurl)...)
+	}
+	for _, envKey := range envKeys {
+		name := prefix + "_" + envKey.suffix
+		if value, ok := os.LookupEnv(name); ok {
+			if err := s.set(name, envKey.key, value); err != nil {
+				report = append(report, err)
+			}
+		}
+	}
+	if len(report) > 0 {
+		return nil, report
+	}
+	return s, nil
+}
+
+// parseURL parses the URL into the settings and
+// returns the invalid parts.
+func (s *Settings) parseURL(rawurl string) Report {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		// Don't return the URL, it may contain the password.
+		return Report{errors.New(ErrInvalidURL, errorMessages, "cannot parse")}
+	}
+	report := Report{}
+	switch u.Scheme {
+	case "redis", "rediss":
+		s.Network = "tcp"
+		s.TLS = u.Scheme == "rediss"
+		host := u.Hostname()
+		if host == "" {
+			host = defaultHost
+		}
+		port := u.Port()
+		if port == "" {
+			port = defaultPort
+		}
+		s.Address = net.JoinHostPort(host, port)
+		if db := strings.Trim(u.Path, "/"); db != "" {
+			if err := s.set("path", "db", db); err != nil {
+				report = append(report, err)
+			}
+		}
+	case "unix":
+		s.Network = "unix"
+		s.Address = u.Path
+		if s.Address == "" {
+			report = append(report, errors.New(ErrInvalidURL, errorMessages, "missing socket path"))
+		}
+	default:
+		report = append(report, errors.New(ErrInvalidURL, errorMessages, fmt.Sprintf("unknown scheme %q", u.Scheme)))
+	}
+	if u.User != nil {
+		s.Username = u.User.Username()
+		s.Password, _ = u.User.Password()
+	}
+	query := u.Query()
+	keys := []string{}
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := s.set(key, key, query.Get(key)); err != nil {
+			report = append(report, err)
+		}
+	}
+	return report
+}
+
+// set validates and sets one value. The name is used
+// for the reporting of invalid values.
+func (s *Settings) set(name, key, value string) error {
+	invalid := func() error {
+		if key == "password" {
+			value = "xxxxx"
+		}
+		return errors.New(ErrInvalidValue, errorMessages, value, name)
+	}
+	switch key {
+	case "db":
+		db, err := strconv.Atoi(value)
+		if err != nil || db < 0 {
+			return invalid()
+		}
+		s.Database = db
+	case "username":
+		s.Username = value
+	case "password":
+		s.Password = value
+	case "pool_size":
+		poolSize, err := strconv.Atoi(value)
+		if err != nil || poolSize < 0 {
+			return invalid()
+		}
+		s.PoolSize = poolSize
+	case "timeout":
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			return invalid()
+		}
+		s.Timeout = timeout
+	default:
+		return errors.New(ErrInvalidURL, errorMessages, fmt.Sprintf("unknown parameter %q", key))
+	}
+	return nil
+}
+
+// EOF
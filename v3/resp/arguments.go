@@ -0,0 +1,133 @@
+// Tideland Go Data Management - Redis Serialization Protocol - Arguments
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package resp
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// ARGUMENT ENCODING
+//--------------------
+
+// ArgEncoder can be implemented by types which shall be passed
+// as command arguments in an own encoding. It takes precedence
+// over all built-in encodings.
+type ArgEncoder interface {
+	// EncodeArg returns the argument as byte slice.
+	EncodeArg() ([]byte, error)
+}
+
+// AppendArgument appends the encoding of a single argument to the
+// buffer. Floats are encoded without exponent, bools as 1 and 0,
+// times in RFC 3339 format with nanoseconds, and durations as
+// milliseconds like needed for PEXPIRE or PX. Types implementing
+// encoding.BinaryMarshaler or encoding.TextMarshaler are marshalled,
+// all others are formatted with %v.
+func AppendArgument(buf []byte, arg interface{}) ([]byte, error) {
+	switch typedArg := arg.(type) {
+	case nil:
+		return buf, nil
+	case ArgEncoder:
+		b, err := typedArg.EncodeArg()
+		if err != nil {
+			return nil, errors.Annotate(err, ErrEncodeArgument, errorMessages, arg)
+		}
+		return append(buf, b...), nil
+	case string:
+		return append(buf, typedArg...), nil
+	case []byte:
+		return append(buf, typedArg...), nil
+	case Value:
+		return append(buf, typedArg...), nil
+	case int:
+		return strconv.AppendInt(buf, int64(typedArg), 10), nil
+	case int8:
+		return strconv.AppendInt(buf, int64(typedArg), 10), nil
+	case int16:
+		return strconv.AppendInt(buf, int64(typedArg), 10), nil
+	case int32:
+		return strconv.AppendInt(buf, int64(typedArg), 10), nil
+	case int64:
+		return strconv.AppendInt(buf, typedArg, 10), nil
+	case uint:
+		return strconv.AppendUint(buf, uint64(typedArg), 10), nil
+	case uint8:
+		return strconv.AppendUint(buf, uint64(typedArg), 10), nil
+	case uint16:
+		return strconv.AppendUint(buf, uint64(typedArg), 10), nil
+	case uint32:
+		return strconv.AppendUint(buf, uint64(typedArg), 10), nil
+	case uint64:
+		return strconv.AppendUint(buf, typedArg, 10), nil
+	case float32:
+		return appendFloat(buf, float64(typedArg), 32), nil
+	case float64:
+		return appendFloat(buf, typedArg, 64), nil
+	case bool:
+		if typedArg {
+			return append(buf, '1'), nil
+		}
+		return append(buf, '0'), nil
+	case time.Time:
+		return typedArg.AppendFormat(buf, time.RFC3339Nano), nil
+	case time.Duration:
+		return strconv.AppendInt(buf, int64(typedArg/time.Millisecond), 10), nil
+	case encoding.BinaryMarshaler:
+		b, err := typedArg.MarshalBinary()
+		if err != nil {
+			return nil, errors.Annotate(err, ErrEncodeArgument, errorMessages, arg)
+		}
+		return append(buf, b...), nil
+	case encoding.TextMarshaler:
+		b, err := typedArg.MarshalText()
+		if err != nil {
+			return nil, errors.Annotate(err, ErrEncodeArgument, errorMessages, arg)
+		}
+		return append(buf, b...), nil
+	}
+	return fmt.Appendf(buf, "%v", arg), nil
+}
+
+// appendFloat appends a float without exponent. Infinite values
+// are encoded the way Redis expects them.
+func appendFloat(buf []byte, f float64, bitSize int) []byte {
+	switch {
+	case math.IsInf(f, 1):
+		return append(buf, "+inf"...)
+	case math.IsInf(f, -1):
+		return append(buf, "-inf"...)
+	}
+	return strconv.AppendFloat(buf, f, 'f', -1, bitSize)
+}
+
+// EncodingMayFail checks if the encoding of the argument
+// may return an error, all others can be encoded directly.
+func EncodingMayFail(arg interface{}) bool {
+	switch arg.(type) {
+	case ArgEncoder:
+		return true
+	case time.Time:
+		return false
+	case encoding.BinaryMarshaler, encoding.TextMarshaler:
+		return true
+	}
+	return false
+}
+
+// EOF
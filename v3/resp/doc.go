@@ -0,0 +1,19 @@
+// Tideland Go Data Management - Redis Serialization Protocol
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// The resp package contains the parts of the Redis Serialization
+// Protocol shared by the versions 2 and 3 of the Redis client.
+//
+// The Reader reads the replies of the server, complete with nested
+// arrays using ReadReply() or step by step using ReadHeader() for
+// streaming. Value, Hash, and KeyValue are the types for the returned
+// data with their conversions. AppendArgument() encodes the arguments
+// of commands, types can provide an own encoding by implementing
+// ArgEncoder.
+package resp
+
+// EOF
@@ -0,0 +1,40 @@
+// Tideland Go Data Management - Redis Serialization Protocol - Errors
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package resp
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// Error codes. They don't overlap with the codes of the redis
+// packages, which provide them under the same names.
+const (
+	ErrInvalidType = iota + 1000
+	ErrInvalidKey
+	ErrEncodeArgument
+	ErrReading
+	ErrInvalidReply
+)
+
+var errorMessages = errors.Messages{
+	ErrInvalidType:    "invalid type conversion of \"%v\" to %q",
+	ErrInvalidKey:     "invalid key %q",
+	ErrEncodeArgument: "cannot encode argument %v",
+	ErrReading:        "cannot read reply",
+	ErrInvalidReply:   "invalid reply: %q",
+}
+
+// EOF
@@ -0,0 +1,216 @@
+// Tideland Go Data Management - Redis Serialization Protocol - Reader
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package resp
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// REPLY
+//--------------------
+
+// Kind classifies a reply of the server.
+type Kind int
+
+// Kinds of replies.
+const (
+	KindStatus Kind = iota + 1
+	KindError
+	KindInteger
+	KindBulk
+	KindNullBulk
+	KindArray
+	KindNullArray
+)
+
+var kindDescr = map[Kind]string{
+	KindStatus:    "status",
+	KindError:     "error",
+	KindInteger:   "integer",
+	KindBulk:      "bulk",
+	KindNullBulk:  "null-bulk",
+	KindArray:     "array",
+	KindNullArray: "null-array",
+}
+
+// String returns the description of the kind.
+func (k Kind) String() string {
+	if descr, ok := kindDescr[k]; ok {
+		return descr
+	}
+	return "unknown"
+}
+
+// Reply contains one reply of the server. Status, error, and
+// integer replies contain their value without the type marker,
+// bulk replies their data. Arrays contain their elements, which
+// may be arrays again.
+type Reply struct {
+	Kind     Kind
+	Length   int
+	Value    Value
+	Elements []*Reply
+}
+
+// Values returns the values of the reply. Nested arrays are
+// expanded in order, null arrays are left out.
+func (r *Reply) Values() []Value {
+	switch r.Kind {
+	case KindArray:
+		values := []Value{}
+		for _, element := range r.Elements {
+			values = append(values, element.Values()...)
+		}
+		return values
+	case KindNullArray:
+		return []Value{}
+	}
+	return []Value{r.Value}
+}
+
+// String creates a string representation of the reply.
+func (r *Reply) String() string {
+	if r.Kind == KindArray {
+		return fmt.Sprintf("REPLY (Kind: %s / Length: %d / Elements: %v)", r.Kind, r.Length, r.Elements)
+	}
+	return fmt.Sprintf("REPLY (Kind: %s / Value: %v)", r.Kind, r.Value)
+}
+
+//--------------------
+// READER
+//--------------------
+
+// Reader reads the replies of the server.
+type Reader struct {
+	reader *bufio.Reader
+}
+
+// NewReader creates a reader for the passed reader, it's
+// used directly if it's already a buffered one.
+func NewReader(r io.Reader) *Reader {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Reader{br}
+}
+
+// Buffered returns the underlying buffered reader, e.g. to
+// stream the data of a bulk reply.
+func (r *Reader) Buffered() *bufio.Reader {
+	return r.reader
+}
+
+// ReadReply reads a complete reply including the data of
+// bulk replies and the elements of arrays.
+func (r *Reader) ReadReply() (*Reply, error) {
+	reply, err := r.ReadHeader()
+	if err != nil {
+		return nil, err
+	}
+	switch reply.Kind {
+	case KindBulk:
+		err = r.ReadBulk(reply)
+	case KindArray:
+		err = r.ReadElements(reply)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// ReadHeader reads the first line of a reply. Bulk replies and
+// arrays only contain their length, the data has to be read with
+// ReadBulk() or directly from the buffered reader, the elements
+// with ReadElements().
+func (r *Reader) ReadHeader() (*Reply, error) {
+	line, err := r.reader.ReadBytes('\n')
+	if err != nil {
+		return nil, errors.Annotate(err, ErrReading, errorMessages)
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New(ErrInvalidReply, errorMessages, line)
+	}
+	content := line[1 : len(line)-2]
+	switch line[0] {
+	case '+':
+		return &Reply{Kind: KindStatus, Value: Value(content)}, nil
+	case '-':
+		return &Reply{Kind: KindError, Value: Value(content)}, nil
+	case ':':
+		return &Reply{Kind: KindInteger, Value: Value(content)}, nil
+	case '$':
+		length, err := r.parseLength(line, content)
+		if err != nil {
+			return nil, err
+		}
+		if length == -1 {
+			return &Reply{Kind: KindNullBulk}, nil
+		}
+		return &Reply{Kind: KindBulk, Length: length}, nil
+	case '*':
+		length, err := r.parseLength(line, content)
+		if err != nil {
+			return nil, err
+		}
+		if length == -1 {
+			return &Reply{Kind: KindNullArray}, nil
+		}
+		return &Reply{Kind: KindArray, Length: length}, nil
+	}
+	return nil, errors.New(ErrInvalidReply, errorMessages, line)
+}
+
+// ReadBulk reads the data of a bulk reply returned by ReadHeader().
+func (r *Reader) ReadBulk(reply *Reply) error {
+	buffer := make([]byte, reply.Length+2)
+	if _, err := io.ReadFull(r.reader, buffer); err != nil {
+		return errors.Annotate(err, ErrReading, errorMessages)
+	}
+	if buffer[reply.Length] != '\r' || buffer[reply.Length+1] != '\n' {
+		return errors.New(ErrInvalidReply, errorMessages, buffer)
+	}
+	reply.Value = Value(buffer[:reply.Length])
+	return nil
+}
+
+// ReadElements reads the elements of an array returned
+// by ReadHeader().
+func (r *Reader) ReadElements(reply *Reply) error {
+	reply.Elements = make([]*Reply, reply.Length)
+	for i := range reply.Elements {
+		element, err := r.ReadReply()
+		if err != nil {
+			return err
+		}
+		reply.Elements[i] = element
+	}
+	return nil
+}
+
+// parseLength parses the length of a bulk reply or an array.
+func (r *Reader) parseLength(line, content []byte) (int, error) {
+	length, err := strconv.Atoi(string(content))
+	if err != nil || length < -1 {
+		return 0, errors.New(ErrInvalidReply, errorMessages, line)
+	}
+	return length, nil
+}
+
+// EOF
@@ -0,0 +1,301 @@
+// Tideland Go Data Management - Redis Serialization Protocol - Unit Tests
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package resp_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tideland/goas/v3/errors"
+	v2redis "github.com/tideland/godm/v2/redis"
+	"github.com/tideland/godm/v3/redis"
+	"github.com/tideland/godm/v3/redis/redistest"
+	"github.com/tideland/godm/v3/resp"
+	"github.com/tideland/gots/v3/asserts"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// fixtures contains server replies and their expected values.
+var fixtures = []struct {
+	input  string
+	kind   resp.Kind
+	values []string
+}{
+	{"+OK\r\n", resp.KindStatus, []string{"OK"}},
+	{"-ERR unknown command\r\n", resp.KindError, []string{"ERR unknown command"}},
+	{":4711\r\n", resp.KindInteger, []string{"4711"}},
+	{"$5\r\nHello\r\n", resp.KindBulk, []string{"Hello"}},
+	{"$0\r\n\r\n", resp.KindBulk, []string{""}},
+	{"$12\r\nHello\r\nWorld\r\n", resp.KindBulk, []string{"Hello\r\nWorld"}},
+	{"$-1\r\n", resp.KindNullBulk, []string{"(nil)"}},
+	{"*0\r\n", resp.KindArray, []string{}},
+	{"*-1\r\n", resp.KindNullArray, []string{}},
+	{"*3\r\n:1\r\n$3\r\nfoo\r\n$-1\r\n", resp.KindArray, []string{"1", "foo", "(nil)"}},
+	{"*2\r\n$1\r\n0\r\n*2\r\n$1\r\na\r\n$1\r\nb\r\n", resp.KindArray, []string{"0", "a", "b"}},
+	{"*3\r\n*1\r\n:1\r\n*-1\r\n*2\r\n*1\r\n+x\r\n:2\r\n", resp.KindArray, []string{"1", "x", "2"}},
+}
+
+// TestReadReply tests reading the replies of the fixtures.
+func TestReadReply(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	for i, fixture := range fixtures {
+		r := resp.NewReader(strings.NewReader(fixture.input))
+		reply, err := r.ReadReply()
+		assert.Nil(err, fmt.Sprintf("fixture %d", i))
+		assert.Equal(reply.Kind, fixture.kind, fmt.Sprintf("fixture %d", i))
+		values := reply.Values()
+		assert.Length(values, len(fixture.values), fmt.Sprintf("fixture %d", i))
+		for j, value := range values {
+			assert.Equal(value.String(), fixture.values[j], fmt.Sprintf("fixture %d", i))
+		}
+	}
+}
+
+// TestReadNested tests the structure of nested arrays.
+func TestReadNested(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	r := resp.NewReader(strings.NewReader("*3\r\n*1\r\n:1\r\n*-1\r\n*2\r\n*1\r\n+x\r\n:2\r\n"))
+	reply, err := r.ReadReply()
+	assert.Nil(err)
+	assert.Equal(reply.Kind, resp.KindArray)
+	assert.Length(reply.Elements, 3)
+	assert.Equal(reply.Elements[0].Kind, resp.KindArray)
+	assert.Equal(reply.Elements[0].Elements[0].Value.String(), "1")
+	assert.Equal(reply.Elements[1].Kind, resp.KindNullArray)
+	assert.Equal(reply.Elements[2].Elements[0].Kind, resp.KindArray)
+	assert.Equal(reply.Elements[2].Elements[0].Elements[0].Kind, resp.KindStatus)
+	assert.Equal(reply.Elements[2].Elements[1].Kind, resp.KindInteger)
+}
+
+// TestReadSequence tests reading multiple replies from one stream.
+func TestReadSequence(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	input := ""
+	for _, fixture := range fixtures {
+		input += fixture.input
+	}
+	r := resp.NewReader(strings.NewReader(input))
+	for i, fixture := range fixtures {
+		reply, err := r.ReadReply()
+		assert.Nil(err, fmt.Sprintf("fixture %d", i))
+		assert.Equal(reply.Kind, fixture.kind, fmt.Sprintf("fixture %d", i))
+	}
+	_, err := r.ReadReply()
+	assert.True(errors.IsError(err, resp.ErrReading))
+}
+
+// TestReadHeader tests reading a bulk reply in steps.
+func TestReadHeader(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	r := resp.NewReader(strings.NewReader("$5\r\nHello\r\n+OK\r\n"))
+	reply, err := r.ReadHeader()
+	assert.Nil(err)
+	assert.Equal(reply.Kind, resp.KindBulk)
+	assert.Equal(reply.Length, 5)
+	assert.Nil(reply.Value)
+	err = r.ReadBulk(reply)
+	assert.Nil(err)
+	assert.Equal(reply.Value.String(), "Hello")
+	reply, err = r.ReadHeader()
+	assert.Nil(err)
+	assert.Equal(reply.Kind, resp.KindStatus)
+}
+
+// TestReadInvalid tests reading invalid replies.
+func TestReadInvalid(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	invalids := []string{
+		"?foo\r\n",
+		"+OK\n",
+		"$abc\r\n",
+		"$-2\r\n",
+		"*x\r\n",
+		"$3\r\nfoobar\r\n",
+	}
+	for i, invalid := range invalids {
+		r := resp.NewReader(strings.NewReader(invalid))
+		_, err := r.ReadReply()
+		assert.True(errors.IsError(err, resp.ErrInvalidReply), fmt.Sprintf("invalid %d", i))
+	}
+
+	truncated := []string{
+		"+OK",
+		"$5\r\nHel",
+		"*2\r\n:1\r\n",
+	}
+	for i, invalid := range truncated {
+		r := resp.NewReader(strings.NewReader(invalid))
+		_, err := r.ReadReply()
+		assert.True(errors.IsError(err, resp.ErrReading), fmt.Sprintf("truncated %d", i))
+	}
+}
+
+// TestValueConversions tests the conversions of values.
+func TestValueConversions(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	b, err := resp.Value("1").Bool()
+	assert.Nil(err)
+	assert.True(b)
+	i, err := resp.Value("-4711").Int()
+	assert.Nil(err)
+	assert.Equal(i, -4711)
+	f, err := resp.Value("8.15").Float64()
+	assert.Nil(err)
+	assert.Equal(f, 8.15)
+	d, err := resp.Value("1500").Duration()
+	assert.Nil(err)
+	assert.Equal(d, 1500*time.Millisecond)
+	_, err = resp.Value("foo").Int()
+	assert.True(errors.IsError(err, resp.ErrInvalidType))
+
+	assert.Equal(resp.Value(nil).String(), "(nil)")
+	assert.True(resp.Value(nil).IsNil())
+	assert.True(resp.Value("+OK").IsOK())
+	assert.Equal(resp.Value("[a b]").Unpack().String(), "a b")
+	assert.Equal(resp.Value("a\r\nb").StringSlice(), []string{"a", "b"})
+	assert.Equal(resp.Value("a:1\r\nb:2").StringMap(), map[string]string{"a": "1", "b": "2"})
+}
+
+// TestNewValue tests the creation of values.
+func TestNewValue(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	assert.Equal(resp.NewValue("foo").String(), "foo")
+	assert.Equal(resp.NewValue(4711).String(), "4711")
+	assert.Equal(resp.NewValue(true).String(), "1")
+	assert.Equal(resp.NewValue(1e21).String(), "1000000000000000000000")
+	assert.Equal(resp.NewValue(2*time.Second).String(), "2000")
+	assert.Equal(resp.NewValue([]string{"a", "b"}).String(), "a\r\nb")
+	assert.Equal(resp.NewValue(map[string]string{"a": "1"}).String(), "a:1")
+}
+
+// point is encoded as text.
+type point struct {
+	x, y int
+}
+
+func (p point) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d,%d", p.x, p.y)), nil
+}
+
+// argumentFixtures contains command arguments and their expected
+// encodings. They are shared by the encoders of both clients.
+var argumentFixtures = []struct {
+	arg     interface{}
+	encoded string
+}{
+	{"foo", "foo"},
+	{"", ""},
+	{"a\r\nb", "a\r\nb"},
+	{[]byte("bar"), "bar"},
+	{resp.Value("baz"), "baz"},
+	{4711, "4711"},
+	{int8(-8), "-8"},
+	{uint64(math.MaxUint64), "18446744073709551615"},
+	{8.15, "8.15"},
+	{float32(0.5), "0.5"},
+	{1e21, "1000000000000000000000"},
+	{math.Inf(-1), "-inf"},
+	{true, "1"},
+	{false, "0"},
+	{1500 * time.Millisecond, "1500"},
+	{time.Date(2014, 1, 2, 3, 4, 5, 6, time.UTC), "2014-01-02T03:04:05.000000006Z"},
+	{point{1, 2}, "1,2"},
+}
+
+// TestAppendArgument tests encoding the argument fixtures.
+func TestAppendArgument(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	for i, fixture := range argumentFixtures {
+		encoded, err := resp.AppendArgument(nil, fixture.arg)
+		assert.Nil(err, fmt.Sprintf("fixture %d", i))
+		assert.Equal(string(encoded), fixture.encoded, fmt.Sprintf("fixture %d", i))
+		assert.Equal(resp.NewValue(fixture.arg).String(), fixture.encoded, fmt.Sprintf("fixture %d", i))
+	}
+}
+
+// TestClientEncoders tests sending the argument fixtures with
+// the clients of version 2 and 3 to a fake server.
+func TestClientEncoders(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	srv, err := redistest.NewServer()
+	assert.Nil(err)
+	defer srv.Close()
+
+	db, err := redis.Open(redis.TcpConnection(srv.Addr(), 0))
+	assert.Nil(err)
+	defer db.Close()
+	conn, err := db.Connection()
+	assert.Nil(err)
+	defer conn.Return()
+	v2db, err := v2redis.Connect(&v2redis.Configuration{Address: srv.Addr()})
+	assert.Nil(err)
+	defer v2db.Close()
+
+	for i, fixture := range argumentFixtures {
+		value, err := conn.DoString("echo", fixture.arg)
+		assert.Nil(err, fmt.Sprintf("v3 fixture %d", i))
+		assert.Equal(value, fixture.encoded, fmt.Sprintf("v3 fixture %d", i))
+		rs, err := v2db.Command("echo", fixture.arg)
+		assert.Nil(err, fmt.Sprintf("v2 fixture %d", i))
+		assert.Equal(rs.FirstValue().String(), fixture.encoded, fmt.Sprintf("v2 fixture %d", i))
+	}
+	echoed := []string{}
+	for _, cmd := range srv.Commands() {
+		if cmd[0] == "echo" {
+			echoed = append(echoed, cmd[1])
+		}
+	}
+	assert.Length(echoed, 2*len(argumentFixtures))
+	for i, fixture := range argumentFixtures {
+		assert.Equal(echoed[2*i], fixture.encoded, fmt.Sprintf("v3 fixture %d", i))
+		assert.Equal(echoed[2*i+1], fixture.encoded, fmt.Sprintf("v2 fixture %d", i))
+	}
+}
+
+// TestHash tests the hash type.
+func TestHash(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	h := resp.NewFilledHash(map[string]interface{}{
+		"a": "foo",
+		"b": 4711,
+		"c": true,
+	})
+	assert.Equal(h.Len(), 3)
+	s, err := h.String("a")
+	assert.Nil(err)
+	assert.Equal(s, "foo")
+	i, err := h.Int("b")
+	assert.Nil(err)
+	assert.Equal(i, 4711)
+	b, err := h.Bool("c")
+	assert.Nil(err)
+	assert.True(b)
+	_, err = h.String("d")
+	assert.True(errors.IsError(err, resp.ErrInvalidKey))
+}
+
+// EOF
@@ -0,0 +1,355 @@
+// Tideland Go Data Management - Redis Serialization Protocol - Values
+//
+// Copyright (C) 2009-2014 Frank Mueller / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package resp
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// VALUE
+//--------------------
+
+// Value is simply a byte slice.
+type Value []byte
+
+// NewValue creates a value out of the passed data. Slices of strings
+// and maps of strings are joined with CRLF to be read with StringSlice()
+// and StringMap(), hashes are concatenated. All others are encoded like
+// arguments, see AppendArgument().
+func NewValue(value interface{}) Value {
+	switch typedValue := value.(type) {
+	case []string:
+		return Value(strings.Join(typedValue, "\r\n"))
+	case map[string]string:
+		tmp := make([]string, 0, len(typedValue))
+		for k, v := range typedValue {
+			tmp = append(tmp, fmt.Sprintf("%v:%v", k, v))
+		}
+		return Value(strings.Join(tmp, "\r\n"))
+	case Hash:
+		tmp := []byte{}
+		for k, v := range typedValue {
+			tmp = append(tmp, k...)
+			tmp = append(tmp, v...)
+		}
+		return Value(tmp)
+	}
+	if value == nil {
+		return nil
+	}
+	// Start with an empty buffer, so that empty
+	// values aren't taken as nil.
+	b, err := AppendArgument([]byte{}, value)
+	if err != nil {
+		return Value(fmt.Sprintf("%v", value))
+	}
+	return Value(b)
+}
+
+// String returns the value as string (alternative to type conversion).
+func (v Value) String() string {
+	if v == nil {
+		return "(nil)"
+	}
+	return string([]byte(v))
+}
+
+// IsOK returns true if the value is the Redis OK value.
+func (v Value) IsOK() bool {
+	return v.String() == "+OK"
+}
+
+// IsNil returns true if the value is the Redis nil value.
+func (v Value) IsNil() bool {
+	return v == nil
+}
+
+// Bool return the value as bool.
+func (v Value) Bool() (bool, error) {
+	b, err := strconv.ParseBool(v.String())
+	if err != nil {
+		return false, v.invalidTypeError(err, "bool")
+	}
+	return b, nil
+}
+
+// Int returns the value as int.
+func (v Value) Int() (int, error) {
+	i, err := strconv.Atoi(v.String())
+	if err != nil {
+		return 0, v.invalidTypeError(err, "int")
+	}
+	return i, nil
+}
+
+// Int64 returns the value as int64.
+func (v Value) Int64() (int64, error) {
+	i, err := strconv.ParseInt(v.String(), 10, 64)
+	if err != nil {
+		return 0, v.invalidTypeError(err, "int64")
+	}
+	return i, nil
+}
+
+// Uint64 returns the value as uint64.
+func (v Value) Uint64() (uint64, error) {
+	i, err := strconv.ParseUint(v.String(), 10, 64)
+	if err != nil {
+		return 0, v.invalidTypeError(err, "uint64")
+	}
+	return i, nil
+}
+
+// Float64 returns the value as float64.
+func (v Value) Float64() (float64, error) {
+	f, err := strconv.ParseFloat(v.String(), 64)
+	if err != nil {
+		return 0.0, v.invalidTypeError(err, "float64")
+	}
+	return f, nil
+}
+
+// Time returns the value as time, it has to be
+// in RFC 3339 format.
+func (v Value) Time() (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, v.String())
+	if err != nil {
+		return time.Time{}, v.invalidTypeError(err, "time")
+	}
+	return t, nil
+}
+
+// Duration returns the value interpreted as
+// milliseconds as duration.
+func (v Value) Duration() (time.Duration, error) {
+	ms, err := strconv.ParseInt(v.String(), 10, 64)
+	if err != nil {
+		return 0, v.invalidTypeError(err, "duration")
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// Bytes returns the value as byte slice.
+func (v Value) Bytes() []byte {
+	return []byte(v)
+}
+
+// StringSlice returns the value as slice of strings when seperated by CRLF.
+func (v Value) StringSlice() []string {
+	return strings.Split(v.String(), "\r\n")
+}
+
+// StringMap returns the value as a map of strings when seperated by CRLF
+// and colons between key and value.
+func (v Value) StringMap() map[string]string {
+	tmp := v.StringSlice()
+	m := make(map[string]string, len(tmp))
+	for _, s := range tmp {
+		kv := strings.Split(s, ":")
+		if len(kv) > 1 {
+			m[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	return m
+}
+
+// Unpack removes the braces of a list value.
+func (v Value) Unpack() Value {
+	if len(v) > 2 && v[0] == '[' && v[len(v)-1] == ']' {
+		return Value(v[1 : len(v)-1])
+	}
+	return v
+}
+
+// invalidTypeError returns an annotated error if a value access has
+// been unsuccessful.
+func (v Value) invalidTypeError(err error, descr string) error {
+	return errors.Annotate(err, ErrInvalidType, errorMessages, v.String(), descr)
+}
+
+// Values is a set of values.
+type Values []Value
+
+// Len returns the number of values.
+func (vs Values) Len() int {
+	return len(vs)
+}
+
+// Strings returns all values as strings.
+func (vs Values) Strings() []string {
+	ss := make([]string, len(vs))
+	for i, v := range vs {
+		ss[i] = v.String()
+	}
+	return ss
+}
+
+//--------------------
+// KEY/VALUE
+//--------------------
+
+// KeyValue combines a key and a value
+type KeyValue struct {
+	Key   string
+	Value Value
+}
+
+// String returs the key/value pair as string.
+func (kv KeyValue) String() string {
+	return fmt.Sprintf("%s = %v", kv.Key, kv.Value)
+}
+
+// KeyValues is a set of KeyValues.
+type KeyValues []KeyValue
+
+// Len returns the number of keys and values in the set.
+func (kvs KeyValues) Len() int {
+	return len(kvs)
+}
+
+// String returs the key/value pairs as string.
+func (kvs KeyValues) String() string {
+	kvss := []string{}
+	for _, kv := range kvs {
+		kvss = append(kvss, kv.String())
+	}
+	return fmt.Sprintf("[%s]", strings.Join(kvss, " / "))
+}
+
+//--------------------
+// HASH
+//--------------------
+
+// Hash maps multiple fields of a hash to the
+// according result values.
+type Hash map[string]Value
+
+// NewHash creates a new empty hash.
+func NewHash() Hash {
+	return make(Hash)
+}
+
+// NewFilledHash creates a hash with the passed keys and values.
+func NewFilledHash(kvs map[string]interface{}) Hash {
+	h := NewHash()
+	for k, v := range kvs {
+		h.Set(k, v)
+	}
+	return h
+}
+
+// Len returns the number of elements in the hash.
+func (h Hash) Len() int {
+	return len(h)
+}
+
+// Set sets a key to the given value.
+func (h Hash) Set(key string, value interface{}) Hash {
+	h[key] = NewValue(value)
+	return h
+}
+
+// String returns the value of a key as string.
+func (h Hash) String(key string) (string, error) {
+	if value, ok := h[key]; ok {
+		return value.String(), nil
+	}
+	return "", errors.New(ErrInvalidKey, errorMessages, key)
+}
+
+// Bool returns the value of a key as bool.
+func (h Hash) Bool(key string) (bool, error) {
+	if value, ok := h[key]; ok {
+		return value.Bool()
+	}
+	return false, errors.New(ErrInvalidKey, errorMessages, key)
+}
+
+// Int returns the value of a key as int.
+func (h Hash) Int(key string) (int, error) {
+	if value, ok := h[key]; ok {
+		return value.Int()
+	}
+	return 0, errors.New(ErrInvalidKey, errorMessages, key)
+}
+
+// Int64 returns the value of a key as int64.
+func (h Hash) Int64(key string) (int64, error) {
+	if value, ok := h[key]; ok {
+		return value.Int64()
+	}
+	return 0, errors.New(ErrInvalidKey, errorMessages, key)
+}
+
+// Uint64 returns the value of a key as uint64.
+func (h Hash) Uint64(key string) (uint64, error) {
+	if value, ok := h[key]; ok {
+		return value.Uint64()
+	}
+	return 0, errors.New(ErrInvalidKey, errorMessages, key)
+}
+
+// Float64 returns the value of a key as float64.
+func (h Hash) Float64(key string) (float64, error) {
+	if value, ok := h[key]; ok {
+		return value.Float64()
+	}
+	return 0.0, errors.New(ErrInvalidKey, errorMessages, key)
+}
+
+// Time returns the value of a key as time.
+func (h Hash) Time(key string) (time.Time, error) {
+	if value, ok := h[key]; ok {
+		return value.Time()
+	}
+	return time.Time{}, errors.New(ErrInvalidKey, errorMessages, key)
+}
+
+// Duration returns the value of a key as duration.
+func (h Hash) Duration(key string) (time.Duration, error) {
+	if value, ok := h[key]; ok {
+		return value.Duration()
+	}
+	return 0, errors.New(ErrInvalidKey, errorMessages, key)
+}
+
+// Bytes returns the value of a key as byte slice.
+func (h Hash) Bytes(key string) []byte {
+	if value, ok := h[key]; ok {
+		return value.Bytes()
+	}
+	return []byte{}
+}
+
+// StringSlice returns the value of a key as string slice.
+func (h Hash) StringSlice(key string) []string {
+	if value, ok := h[key]; ok {
+		return value.StringSlice()
+	}
+	return []string{}
+}
+
+// StringMap returns the value of a key as string map.
+func (h Hash) StringMap(key string) map[string]string {
+	if value, ok := h[key]; ok {
+		return value.StringMap()
+	}
+	return map[string]string{}
+}
+
+// EOF